@@ -0,0 +1,261 @@
+package pkgen
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/samber/lo"
+	"golang.org/x/tools/go/packages"
+)
+
+// ScopeType renders a template for the types annotated with it, see
+// AnnotatedType.
+const ScopeType = "type"
+
+// annotationPrefix starts the annotation of a type, in its doc comment:
+//
+//	//pkgen:gen stringer prefix=Color
+//	type Color int
+const annotationPrefix = "//pkgen:gen "
+
+const defaultTypeOutputNameTemplate = `zz_generated.{{ .TypeName }}.{{ .TemplateName }}.go`
+
+const typedMode = packages.NeedName | packages.NeedFiles | packages.NeedSyntax | packages.NeedTypes
+
+// AnnotatedType is a type annotated for a type scoped template, as {{ .Type }}
+// or in {{ .Types }}.
+type AnnotatedType struct {
+	Name     string
+	TypeName *types.TypeName
+	Args     map[string]string // the k=v args of the annotation.
+	Fields   []*types.Var      // the fields of the underlying struct, if any.
+	Methods  []*types.Func     // the methods of the type and of its pointer, or of the underlying interface.
+	Pos      string            // where the type is declared, e.g. color.go:12.
+}
+
+// TypeString returns how t is written in the package of the annotated type,
+// e.g. {{ $.Type.TypeString .Type }} for a field.
+func (a *AnnotatedType) TypeString(t types.Type) string {
+	return types.TypeString(t, types.RelativeTo(a.TypeName.Pkg()))
+}
+
+// MarshalJSON keeps the names only, the type objects being for templates.
+func (a *AnnotatedType) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Name string
+		Args map[string]string
+		Pos  string
+	}{Name: a.Name, Args: a.Args, Pos: a.Pos})
+}
+
+func newAnnotatedType(obj *types.TypeName, args map[string]string, pos token.Position) *AnnotatedType {
+	a := &AnnotatedType{
+		Name:     obj.Name(),
+		TypeName: obj,
+		Args:     args,
+		Fields:   nil,
+		Methods:  nil,
+		Pos:      fmt.Sprintf("%s:%d", pos.Filename, pos.Line),
+	}
+
+	if s, ok := obj.Type().Underlying().(*types.Struct); ok {
+		for f := range s.Fields() {
+			a.Fields = append(a.Fields, f)
+		}
+	}
+
+	if i, ok := obj.Type().Underlying().(*types.Interface); ok {
+		for m := range i.Methods() {
+			a.Methods = append(a.Methods, m)
+		}
+		return a
+	}
+
+	for sel := range types.NewMethodSet(types.NewPointer(obj.Type())).Methods() {
+		if m, ok := sel.Obj().(*types.Func); ok {
+			a.Methods = append(a.Methods, m)
+		}
+	}
+
+	return a
+}
+
+// annotatedTypes returns the package level types of the files annotated for
+// the template, in their declaration order.
+func annotatedTypes(fset *token.FileSet, pkg *types.Package, files []*ast.File, template string) ([]*AnnotatedType, error) {
+	found := []*AnnotatedType{}
+
+	for _, f := range files {
+		for _, d := range f.Decls {
+			gd, ok := d.(*ast.GenDecl)
+			if !ok || gd.Tok != token.TYPE {
+				continue
+			}
+
+			for _, s := range gd.Specs {
+				ts, ok := s.(*ast.TypeSpec)
+				if !ok {
+					continue
+				}
+
+				doc := ts.Doc
+				// the doc of an ungrouped declaration is the one of the decl.
+				if doc == nil && !gd.Lparen.IsValid() {
+					doc = gd.Doc
+				}
+
+				args, ok, err := annotation(doc, template)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", fset.Position(doc.Pos()), err)
+				}
+				if !ok {
+					continue
+				}
+
+				obj, ok := pkg.Scope().Lookup(ts.Name.Name).(*types.TypeName)
+				if !ok {
+					continue
+				}
+
+				found = append(found, newAnnotatedType(obj, args, fset.Position(ts.Pos())))
+			}
+		}
+	}
+
+	return found, nil
+}
+
+// annotation returns the args of the annotation of a doc comment for the
+// template, if any.
+func annotation(doc *ast.CommentGroup, template string) (map[string]string, bool, error) {
+	if doc == nil {
+		return nil, false, nil
+	}
+
+	for _, c := range doc.List {
+		rest, ok := strings.CutPrefix(c.Text, annotationPrefix)
+		if !ok {
+			continue
+		}
+
+		fields := strings.Fields(rest)
+		if len(fields) == 0 || fields[0] != template {
+			continue
+		}
+
+		args := map[string]string{}
+		for _, kv := range fields[1:] {
+			k, v, ok := strings.Cut(kv, "=")
+			if !ok || k == "" {
+				return nil, false, fmt.Errorf("%w: %s: expected k=v args, got %q", ErrScope, template, kv)
+			}
+			args[k] = v
+		}
+
+		return args, true, nil
+	}
+
+	return nil, false, nil
+}
+
+// loadTypes loads the syntax and the types of the packages annotated for the
+// type scoped templates, all at once and the way the query loaded them, unless
+// the query already did. The type errors are tolerated, as the packages may
+// need the outputs to compile.
+func (r renderer) loadTypes(ctx context.Context, pkgs []packages.Package, tmps []Template, q PackagesQueryConfig) error {
+	if !lo.SomeBy(tmps, func(t Template) bool { return t.FrontMatter.Scope == ScopeType }) {
+		return nil
+	}
+
+	missing := []packages.Package{}
+	for _, p := range pkgs {
+		if r.typedPackage(p) != nil || testMain(p) {
+			continue
+		}
+
+		annotated, err := hasAnnotations(p)
+		if err != nil {
+			return err
+		}
+		if annotated {
+			missing = append(missing, p)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	dirs := lo.Uniq(lo.Map(missing, func(p packages.Package, _ int) string { return p.Dir }))
+	slices.Sort(dirs)
+
+	cfg := &packages.Config{
+		Mode:       typedMode,
+		Context:    ctx,
+		Tests:      lo.SomeBy(missing, testVariant),
+		Dir:        firstNotEmpty(q.Dir, dirs[0]),
+		Env:        append(os.Environ(), q.Env...),
+		BuildFlags: q.BuildFlags,
+	}
+
+	loaded, err := packages.Load(cfg, dirs...)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	if err != nil {
+		return fmt.Errorf("%w: loading the types: %w", ErrScope, err)
+	}
+
+	for _, p := range loaded {
+		if p.Types != nil {
+			r.typed[p.ID] = p
+		}
+	}
+
+	for _, p := range missing {
+		if r.typedPackage(p) == nil {
+			return fmt.Errorf("%w: loading the types of %s: no package found", ErrScope, typedKey(p))
+		}
+	}
+
+	return nil
+}
+
+// typedPackage returns pkg with its syntax and types, or nil when it has no
+// annotations. See loadTypes.
+func (r renderer) typedPackage(pkg packages.Package) *packages.Package {
+	if pkg.Types != nil && len(pkg.Syntax) > 0 {
+		return &pkg
+	}
+
+	return r.typed[typedKey(pkg)]
+}
+
+// typedKey identifies a package, and its test variants apart.
+func typedKey(pkg packages.Package) string {
+	return firstNotEmpty(pkg.ID, pkg.PkgPath)
+}
+
+// hasAnnotations reports whether a Go file of pkg holds an annotation, for
+// any template.
+func hasAnnotations(pkg packages.Package) (bool, error) {
+	for _, p := range pkg.GoFiles {
+		src, err := os.ReadFile(filepath.Clean(p))
+		if err != nil {
+			return false, err
+		}
+		if bytes.Contains(src, []byte(annotationPrefix)) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
@@ -0,0 +1,247 @@
+package pkgen
+
+import (
+	"context"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"testing"
+	"text/template"
+
+	"github.com/ifnotnil/x/tst"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/tools/go/packages"
+)
+
+func TestAnnotation(t *testing.T) {
+	tests := map[string]struct {
+		comments      []string
+		expected      map[string]string
+		found         bool
+		errorAsserter tst.ErrorAssertionFunc
+	}{
+		"no annotation": {
+			comments:      []string{"// Color is a color."},
+			expected:      nil,
+			found:         false,
+			errorAsserter: tst.NoError(),
+		},
+		"annotation": {
+			comments:      []string{"// Color is a color.", "//pkgen:gen stringer"},
+			expected:      map[string]string{},
+			found:         true,
+			errorAsserter: tst.NoError(),
+		},
+		"args": {
+			comments:      []string{"//pkgen:gen stringer prefix=Color trim="},
+			expected:      map[string]string{"prefix": "Color", "trim": ""},
+			found:         true,
+			errorAsserter: tst.NoError(),
+		},
+		"other template": {
+			comments:      []string{"//pkgen:gen enum prefix=Color"},
+			expected:      nil,
+			found:         false,
+			errorAsserter: tst.NoError(),
+		},
+		"not an annotation": {
+			comments:      []string{"// pkgen:gen stringer"},
+			expected:      nil,
+			found:         false,
+			errorAsserter: tst.NoError(),
+		},
+		"malformed args": {
+			comments:      []string{"//pkgen:gen stringer prefix"},
+			expected:      nil,
+			found:         false,
+			errorAsserter: tst.ErrorIs(ErrScope),
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			doc := &ast.CommentGroup{List: nil}
+			for _, c := range tc.comments {
+				doc.List = append(doc.List, &ast.Comment{Slash: token.NoPos, Text: c})
+			}
+
+			got, found, err := annotation(doc, "stringer")
+			tc.errorAsserter(t, err)
+			require.Equal(t, tc.found, found)
+			require.Equal(t, tc.expected, got)
+		})
+	}
+}
+
+func TestAnnotatedTypes(t *testing.T) {
+	src := `package a
+
+//pkgen:gen stringer
+type Color int
+
+func (c Color) Name() string { return "" }
+
+type (
+	// Shape is not annotated.
+	Shape int
+
+	//pkgen:gen stringer kind=point
+	Point struct {
+		X, Y  int
+		Color Color
+	}
+)
+
+func (p *Point) Move() {}
+
+//pkgen:gen stringer
+type Mover interface{ Move() }
+`
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "a.go", src, parser.ParseComments)
+	require.NoError(t, err)
+	pkg, err := (&types.Config{}).Check("example.com/a", fset, []*ast.File{f}, nil)
+	require.NoError(t, err)
+
+	got, err := annotatedTypes(fset, pkg, []*ast.File{f}, "stringer")
+	require.NoError(t, err)
+	require.Len(t, got, 3)
+
+	require.Equal(t, "Color", got[0].Name)
+	require.Equal(t, "a.go:4", got[0].Pos)
+	require.Empty(t, got[0].Fields)
+	require.Len(t, got[0].Methods, 1)
+	require.Equal(t, "Name", got[0].Methods[0].Name())
+
+	require.Equal(t, "Point", got[1].Name)
+	require.Equal(t, map[string]string{"kind": "point"}, got[1].Args)
+	require.Len(t, got[1].Fields, 3)
+	require.Equal(t, "Color", got[1].Fields[2].Name())
+	require.Equal(t, "Color", got[1].TypeString(got[1].Fields[2].Type()), "qualified relative to the package")
+	require.Len(t, got[1].Methods, 1, "the methods of the pointer")
+
+	require.Equal(t, "Mover", got[2].Name)
+	require.Len(t, got[2].Methods, 1, "the methods of the interface")
+}
+
+func TestGenerateTypeScope(t *testing.T) {
+	t.Setenv("GOWORK", "off")
+
+	module := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(module, "go.mod"), []byte("module example.com/m\n\ngo 1.22\n"), 0o600))
+	src := filepath.Join(module, "colors.go")
+	require.NoError(t, os.WriteFile(src, []byte(`package colors
+
+//pkgen:gen stringer prefix=C
+type Color int
+
+const (
+	Red Color = iota
+	Blue
+)
+
+//pkgen:gen stringer
+type Size struct{ W, H int }
+
+// Unused refers to a type that is yet to be generated, which is tolerated.
+var Unused = Generated{}
+`), 0o600))
+	pkgs := []packages.Package{{Name: "colors", PkgPath: "example.com/m", Dir: module, GoFiles: []string{src}}}
+
+	tmp := textTemplate(template.Must(template.New("stringer").Parse(`package {{ .Name }}
+{{ range .Types }}
+func (v {{ .Name }}) String() string { return "{{ index .Args "prefix" }}{{ .Name }}" }
+{{ end }}`)))
+	tmp.FrontMatter.Scope = ScopeType
+
+	t.Run("per package", func(t *testing.T) {
+		files, err := Generator{FileWriter: nil}.Render(t.Context(), logger(t), pkgs, []Template{tmp}, DefaultConfig.Generate)
+		require.NoError(t, err)
+		require.Len(t, files, 1)
+		require.Equal(t, filepath.Join(module, "zz_generated.stringer.go"), files[0].Path)
+		require.Equal(t, "package colors\n\nfunc (v Color) String() string { return \"CColor\" }\n\nfunc (v Size) String() string { return \"Size\" }\n", string(files[0].Content))
+	})
+
+	t.Run("per type", func(t *testing.T) {
+		perType := tmp
+		perType.FrontMatter.PerType = true
+
+		files, err := Generator{FileWriter: nil}.Render(t.Context(), logger(t), pkgs, []Template{perType}, DefaultConfig.Generate)
+		require.NoError(t, err)
+		require.Len(t, files, 2)
+		require.Equal(t, filepath.Join(module, "zz_generated.Color.stringer.go"), files[0].Path)
+		require.Equal(t, "package colors\n\nfunc (v Color) String() string { return \"CColor\" }\n", string(files[0].Content))
+		require.Equal(t, filepath.Join(module, "zz_generated.Size.stringer.go"), files[1].Path)
+	})
+
+	t.Run("not annotated", func(t *testing.T) {
+		other := textTemplate(template.Must(template.New("other").Parse("package {{ .Name }}\n")))
+		other.FrontMatter.Scope = ScopeType
+
+		files, err := Generator{FileWriter: nil}.Render(t.Context(), logger(t), pkgs, []Template{other}, DefaultConfig.Generate)
+		require.NoError(t, err)
+		require.Empty(t, files)
+	})
+
+	t.Run("data", func(t *testing.T) {
+		perType := tmp
+		perType.FrontMatter.PerType = true
+
+		data, err := Generator{FileWriter: nil}.Data(t.Context(), pkgs, []Template{tmp, perType}, DefaultConfig.Generate)
+		require.NoError(t, err)
+		require.Len(t, data, 3)
+		require.Len(t, data[0].Types, 2)
+		require.Nil(t, data[0].Type)
+		require.Equal(t, "Color", data[1].Type.Name)
+		require.Equal(t, "Size", data[2].Type.Name)
+	})
+
+	t.Run("test variant", func(t *testing.T) {
+		test := filepath.Join(module, "colors_test.go")
+		require.NoError(t, os.WriteFile(test, []byte("package colors\n\n//pkgen:gen stringer\ntype Fixture int\n"), 0o600))
+		t.Cleanup(func() { require.NoError(t, os.Remove(test)) })
+
+		variants := []packages.Package{
+			{ID: "example.com/m", Name: "colors", PkgPath: "example.com/m", Dir: module, GoFiles: []string{src}},
+			{ID: "example.com/m [example.com/m.test]", Name: "colors", PkgPath: "example.com/m", Dir: module, GoFiles: []string{src, test}},
+		}
+
+		data, err := Generator{FileWriter: nil}.Data(t.Context(), variants, []Template{tmp}, DefaultConfig.Generate)
+		require.NoError(t, err)
+		require.Len(t, data, 2)
+		require.Equal(t, []string{"Color", "Size"}, lo.Map(data[0].Types, func(a *AnnotatedType, _ int) string { return a.Name }))
+		require.Equal(t, []string{"Color", "Size", "Fixture"}, lo.Map(data[1].Types, func(a *AnnotatedType, _ int) string { return a.Name }), "the test variant is loaded apart")
+	})
+
+	t.Run("build flags", func(t *testing.T) {
+		tagged := filepath.Join(module, "tagged.go")
+		require.NoError(t, os.WriteFile(tagged, []byte("//go:build pkgen\n\npackage colors\n\n//pkgen:gen stringer\ntype Tagged int\n"), 0o600))
+		t.Cleanup(func() { require.NoError(t, os.Remove(tagged)) })
+
+		cnf := DefaultConfig.Generate
+		cnf.Query.BuildFlags = []string{"-tags=pkgen"}
+
+		data, err := Generator{FileWriter: nil}.Data(t.Context(), pkgs, []Template{tmp}, cnf)
+		require.NoError(t, err)
+		require.Len(t, data, 1)
+		require.Equal(t, []string{"Color", "Size", "Tagged"}, lo.Map(data[0].Types, func(a *AnnotatedType, _ int) string { return a.Name }))
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(t.Context())
+		cancel()
+
+		_, err := Generator{FileWriter: nil}.Data(ctx, pkgs, []Template{tmp}, DefaultConfig.Generate)
+		require.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("sample", func(t *testing.T) {
+		sample, err := tmp.Sample()
+		require.NoError(t, err)
+		require.Contains(t, string(sample), "func (v Item) String() string")
+	})
+}
@@ -0,0 +1,456 @@
+package pkgen
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/build/constraint"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/samber/lo"
+	"golang.org/x/mod/module"
+)
+
+var (
+	ErrBundle         = errors.New("malformed bundle")
+	ErrBundleConflict = errors.New("bundle conflict")
+)
+
+// bundleOf maps every bundled template to its bundle.
+func bundleOf(bundles []BundleConfig) (map[string]string, error) {
+	m := map[string]string{}
+
+	for _, b := range bundles {
+		if b.Name == "" || len(b.Templates) == 0 {
+			return nil, fmt.Errorf("%w: a bundle needs a name and templates", ErrBundle)
+		}
+
+		for _, t := range b.Templates {
+			// the templates are known by their name, without the version.
+			t, _ = splitVersion(t)
+			if other, ok := m[t]; ok && other != b.Name {
+				return nil, fmt.Errorf("%w: template %s is in both %s and %s", ErrBundle, t, other, b.Name)
+			}
+			m[t] = b.Name
+		}
+	}
+
+	return m, nil
+}
+
+// bundle merges the parts of the bundles of a package, in the order of the
+// templates, and finishes them.
+func (r renderer) bundle(parts []File, cnf GenerateConfig) ([]File, error) {
+	key := func(f File) string { return r.bundles[f.Template] + "\x00" + f.Path }
+	groups := lo.GroupBy(parts, key)
+
+	files := []File{}
+	for _, k := range lo.Uniq(lo.Map(parts, func(f File, _ int) string { return key(f) })) {
+		group := groups[k]
+		name := r.bundles[group[0].Template]
+
+		f, err := mergeParts(name, group)
+		if err != nil {
+			return nil, err
+		}
+
+		tmp := Template{}
+		tmp.Name = name
+		if f, err = r.finish(f, tmp, cnf.Format); err != nil {
+			return nil, err
+		}
+
+		files = append(files, f)
+	}
+
+	return files, nil
+}
+
+func mergeParts(name string, parts []File) (File, error) {
+	templates := lo.Map(parts, func(f File, _ int) string { return f.Template })
+
+	f := parts[0]
+	f.Template = name
+	f.Origin = "bundle of " + strings.Join(templates, ", ")
+	f.TemplateVersion = ""
+	f.ParamsHash = contentHash([]byte(strings.Join(lo.Map(parts, func(f File, _ int) string { return f.ParamsHash }), "\n")))
+
+	if len(parts) == 1 {
+		return f, nil
+	}
+
+	// the sources of the parts, one after the other, follow the merged content.
+	joined := bytes.Buffer{}
+	sources := []string{}
+	for _, p := range parts {
+		joined.Write(p.Content)
+		if !bytes.HasSuffix(p.Content, []byte("\n")) {
+			joined.WriteString("\n")
+		}
+		lines := len(splitLines(string(p.Content)))
+		sources = append(sources, p.Sources[:min(lines, len(p.Sources))]...)
+		sources = append(sources, make([]string, lines-min(lines, len(p.Sources)))...)
+	}
+
+	if isGoFile(f.Path) {
+		content, err := mergeGo(parts)
+		if err != nil {
+			return File{}, fmt.Errorf("%s (%s): %w", f.Path, name, err)
+		}
+		f.Content = content
+	} else {
+		f.Content = joined.Bytes()
+	}
+	f.Sources = remapSources(joined.Bytes(), sources, f.Content)
+
+	return f, nil
+}
+
+// mergeGo merges Go sources of the same package: the header of the first one
+// is kept, the imports are merged, and the identical declarations, or specs of
+// a declaration group, are kept once. Two different declarations of the same
+// name are a conflict. The comments outside of the declarations are kept with
+// the next declaration, or at the end.
+func mergeGo(parts []File) ([]byte, error) {
+	fset := token.NewFileSet()
+
+	header := []byte(nil)
+	build := ""
+	pkgName := ""
+	m := goMerger{
+		fset:     fset,
+		imports:  nil,
+		decls:    nil,
+		seen:     map[string]bool{},
+		declared: map[string]string{},
+		report:   strings.Builder{},
+	}
+
+	for i, part := range parts {
+		file, err := parser.ParseFile(fset, part.Path, part.Content, parser.ParseComments|parser.SkipObjectResolution)
+		if err != nil {
+			return nil, fmt.Errorf("template %s: %w", part.Template, err)
+		}
+		top := part.Content[:fset.File(file.Pos()).Offset(file.Package)]
+		if i == 0 {
+			header, build, pkgName = top, buildLine(top), file.Name.Name
+		}
+
+		switch {
+		case file.Name.Name != pkgName:
+			fmt.Fprintf(&m.report, "\npackage %s of template %s, and package %s of template %s", pkgName, parts[0].Template, file.Name.Name, part.Template)
+		case buildLine(top) != build:
+			fmt.Fprintf(&m.report, "\nbuild constraint %q of template %s, and %q of template %s", build, parts[0].Template, buildLine(top), part.Template)
+		}
+
+		if err := m.add(file, part.Content, part.Template); err != nil {
+			return nil, err
+		}
+	}
+
+	if m.report.Len() > 0 {
+		return nil, fmt.Errorf("%w:%s", ErrBundleConflict, m.report.String())
+	}
+
+	out := bytes.Buffer{}
+	out.Write(header)
+	fmt.Fprintf(&out, "package %s\n", pkgName)
+	if len(m.imports) > 0 {
+		out.WriteString("\nimport (\n")
+		for _, imp := range m.imports {
+			out.WriteString("\t" + imp.text + "\n")
+		}
+		out.WriteString(")\n")
+	}
+	for _, d := range m.decls {
+		out.WriteString("\n")
+		out.Write(d)
+		out.WriteString("\n")
+	}
+
+	return out.Bytes(), nil
+}
+
+type goImport struct {
+	name     string // the name it is known by in the file, see importName.
+	path     string
+	template string
+	text     string
+}
+
+type goMerger struct {
+	fset     *token.FileSet
+	imports  []goImport
+	decls    [][]byte
+	seen     map[string]bool   // the declarations, or specs, kept, printed without the comments.
+	declared map[string]string // the template each name is declared by.
+	report   strings.Builder
+}
+
+// add merges the imports and the declarations of a file.
+func (m *goMerger) add(file *ast.File, src []byte, template string) error {
+	tf := m.fset.File(file.Pos())
+	text := func(from, to token.Pos) []byte { return src[tf.Offset(from):tf.Offset(to)] }
+
+	// the comments outside of the declarations, and the ones of the imports
+	// that are not merged, go with the next declaration kept.
+	floating := [][]byte{}
+	prev := file.Name.End()
+	for _, decl := range file.Decls {
+		start, end := declRange(tf, file.Comments, decl)
+		for _, c := range commentsIn(file.Comments, prev, start) {
+			floating = append(floating, text(c.Pos(), c.End()))
+		}
+		prev = end
+
+		var kept []byte
+		var err error
+		switch d := decl.(type) {
+		case *ast.GenDecl:
+			if d.Tok == token.IMPORT {
+				m.addImports(d, text, template)
+				continue
+			}
+			kept, err = m.genDecl(d, text, start, end, template)
+		default:
+			kept, err = m.decl(decl, text(start, end), template)
+		}
+		if err != nil {
+			return err
+		}
+
+		if kept != nil {
+			m.decls = append(m.decls, bytes.Join(append(floating, kept), []byte("\n\n")))
+			floating = nil
+		}
+	}
+
+	for _, c := range commentsIn(file.Comments, prev, file.FileEnd) {
+		floating = append(floating, text(c.Pos(), c.End()))
+	}
+	if len(floating) > 0 {
+		m.decls = append(m.decls, bytes.Join(floating, []byte("\n\n")))
+	}
+
+	return nil
+}
+
+// addImports keeps the imports that are not already kept. An import of the
+// same name, or of the same path, as a kept one, but not of both, would not
+// compile, or would not mean the same, and is a conflict.
+func (m *goMerger) addImports(d *ast.GenDecl, text func(from, to token.Pos) []byte, template string) {
+	for _, s := range d.Specs {
+		imp, _ := s.(*ast.ImportSpec)
+		path, _ := strconv.Unquote(imp.Path.Value)
+		name := importName(path)
+		if imp.Name != nil {
+			name = imp.Name.Name
+		}
+
+		if slices.ContainsFunc(m.imports, func(i goImport) bool { return i.path == path && i.name == name }) {
+			continue
+		}
+		// the blank imports declare no name, and the dot ones no name of their own.
+		if i := slices.IndexFunc(m.imports, func(i goImport) bool {
+			return i.name != "_" && name != "_" && (i.path == path || (i.name == name && name != "."))
+		}); i >= 0 {
+			fmt.Fprintf(&m.report, "\nimport %s %q of template %s, and import %s %q of template %s", m.imports[i].name, m.imports[i].path, m.imports[i].template, name, path, template)
+			continue
+		}
+
+		start, end := specRange(s)
+		m.imports = append(m.imports, goImport{name: name, path: path, template: template, text: string(text(start, end))})
+	}
+}
+
+// importName returns the name an import without one is known by, the last
+// element of its path without the major version, as the package name is not
+// known before loading it.
+func importName(path string) string {
+	if prefix, _, ok := module.SplitPathVersion(path); ok {
+		path = prefix
+	}
+
+	return path[strings.LastIndex(path, "/")+1:]
+}
+
+// decl keeps a declaration, unless an identical one is already kept.
+func (m *goMerger) decl(decl ast.Decl, src []byte, template string) ([]byte, error) {
+	norm, err := m.print(decl)
+	if err != nil {
+		return nil, err
+	}
+
+	// every init function runs, even identical ones.
+	fn, isFunc := decl.(*ast.FuncDecl)
+	isInit := isFunc && fn.Recv == nil && fn.Name.Name == "init"
+	if m.seen[norm] && !isInit {
+		return nil, nil
+	}
+	m.seen[norm] = true
+	m.declare(declNames(decl), template)
+
+	return src, nil
+}
+
+// genDecl keeps the specs of a declaration that are not already kept. The
+// const groups that depend on the order of their specs are kept whole.
+func (m *goMerger) genDecl(d *ast.GenDecl, text func(from, to token.Pos) []byte, start, end token.Pos, template string) ([]byte, error) {
+	if !separable(d) {
+		return m.decl(d, text(start, end), template)
+	}
+
+	kept := []ast.Spec{}
+	for _, s := range d.Specs {
+		norm, err := m.print(s)
+		if err != nil {
+			return nil, err
+		}
+
+		key := d.Tok.String() + " " + norm
+		if m.seen[key] {
+			continue
+		}
+		m.seen[key] = true
+		m.declare(specNames(s), template)
+		kept = append(kept, s)
+	}
+
+	switch len(kept) {
+	case 0:
+		return nil, nil
+	case len(d.Specs):
+		return text(start, end), nil
+	}
+
+	out := bytes.Buffer{}
+	out.Write(text(start, d.Pos()))
+	out.WriteString(d.Tok.String() + " (\n")
+	for _, s := range kept {
+		out.Write(text(specRange(s)))
+		out.WriteString("\n")
+	}
+	out.WriteString(")")
+
+	return out.Bytes(), nil
+}
+
+func (m *goMerger) declare(ids []*ast.Ident, template string) {
+	for _, id := range ids {
+		if other, ok := m.declared[id.Name]; ok {
+			fmt.Fprintf(&m.report, "\n%s is declared differently by templates %s and %s", id.Name, other, template)
+		}
+		m.declared[id.Name] = template
+	}
+}
+
+// print prints a node without its comments, to compare it.
+func (m *goMerger) print(node ast.Node) (string, error) {
+	b := strings.Builder{}
+	if err := printer.Fprint(&b, m.fset, node); err != nil {
+		return "", err
+	}
+
+	return b.String(), nil
+}
+
+// separable reports whether the specs of a declaration mean the same out of
+// it, that is all but the const groups with iota or implicit values.
+func separable(d *ast.GenDecl) bool {
+	if d.Tok != token.CONST {
+		return true
+	}
+
+	for _, s := range d.Specs {
+		v, _ := s.(*ast.ValueSpec)
+		if len(v.Values) == 0 {
+			return false
+		}
+		usesIota := false
+		ast.Inspect(v, func(n ast.Node) bool {
+			if id, ok := n.(*ast.Ident); ok && id.Name == "iota" {
+				usesIota = true
+			}
+			return !usesIota
+		})
+		if usesIota {
+			return false
+		}
+	}
+
+	return true
+}
+
+// declRange returns the range of a declaration with its doc, and a comment on
+// its last line.
+func declRange(tf *token.File, comments []*ast.CommentGroup, decl ast.Decl) (token.Pos, token.Pos) {
+	start, end := decl.Pos(), decl.End()
+	if doc := declDoc(decl); doc != nil {
+		start = doc.Pos()
+	}
+
+	for _, c := range comments {
+		if c.Pos() >= end && tf.Line(c.Pos()) == tf.Line(end) {
+			end = c.End()
+			break
+		}
+	}
+
+	return start, end
+}
+
+// specRange returns the range of a spec with its doc and its line comment.
+func specRange(s ast.Spec) (token.Pos, token.Pos) {
+	start, end := s.Pos(), s.End()
+
+	var doc, comment *ast.CommentGroup
+	switch s := s.(type) {
+	case *ast.ImportSpec:
+		doc, comment = s.Doc, s.Comment
+	case *ast.ValueSpec:
+		doc, comment = s.Doc, s.Comment
+	case *ast.TypeSpec:
+		doc, comment = s.Doc, s.Comment
+	}
+	if doc != nil {
+		start = doc.Pos()
+	}
+	if comment != nil {
+		end = comment.End()
+	}
+
+	return start, end
+}
+
+// commentsIn returns the comments between from and to.
+func commentsIn(comments []*ast.CommentGroup, from, to token.Pos) []*ast.CommentGroup {
+	return lo.Filter(comments, func(c *ast.CommentGroup, _ int) bool { return c.Pos() >= from && c.End() <= to })
+}
+
+// buildLine returns the build constraint of a file header, if any.
+func buildLine(top []byte) string {
+	for line := range strings.Lines(string(top)) {
+		if line = strings.TrimSpace(line); constraint.IsGoBuild(line) {
+			return line
+		}
+	}
+
+	return ""
+}
+
+func declDoc(decl ast.Decl) *ast.CommentGroup {
+	switch d := decl.(type) {
+	case *ast.FuncDecl:
+		return d.Doc
+	case *ast.GenDecl:
+		return d.Doc
+	}
+
+	return nil
+}
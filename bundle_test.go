@@ -0,0 +1,212 @@
+package pkgen
+
+import (
+	"os"
+	"testing"
+	"text/template"
+
+	"github.com/ifnotnil/x/tst"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/tools/go/packages"
+)
+
+func TestBundleOf(t *testing.T) {
+	tests := map[string]struct {
+		bundles       []BundleConfig
+		expected      map[string]string
+		errorAsserter tst.ErrorAssertionFunc
+	}{
+		"bundles": {
+			bundles:       []BundleConfig{{Name: "otel", Templates: []string{"pkgpath", "oteltrace"}}, {Name: "x", Templates: []string{"y"}}},
+			expected:      map[string]string{"pkgpath": "otel", "oteltrace": "otel", "y": "x"},
+			errorAsserter: tst.NoError(),
+		},
+		"versioned templates": {
+			bundles:       []BundleConfig{{Name: "otel", Templates: []string{"pkgpath@v1", "oteltrace"}}},
+			expected:      map[string]string{"pkgpath": "otel", "oteltrace": "otel"},
+			errorAsserter: tst.NoError(),
+		},
+		"without a name": {
+			bundles:       []BundleConfig{{Name: "", Templates: []string{"pkgpath"}}},
+			expected:      nil,
+			errorAsserter: tst.ErrorIs(ErrBundle),
+		},
+		"template in two bundles": {
+			bundles:       []BundleConfig{{Name: "a", Templates: []string{"pkgpath"}}, {Name: "b", Templates: []string{"pkgpath"}}},
+			expected:      nil,
+			errorAsserter: tst.ErrorIs(ErrBundle),
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := bundleOf(tc.bundles)
+			tc.errorAsserter(t, err)
+			require.Equal(t, tc.expected, got)
+		})
+	}
+}
+
+func TestGenerateBundle(t *testing.T) {
+	pkgs := []packages.Package{{Name: "pkg", PkgPath: "example.com/pkg", Dir: "/tmp/pkg", GoFiles: []string{"/tmp/pkg/pkg.go"}}}
+
+	pkgpath := textTemplate(template.Must(template.New("pkgpath").Parse("// Code generated by pkgpath. DO NOT EDIT.\n\npackage {{ .Name }}\n\nconst packagePath = \"{{ .PkgPath }}\"\n")))
+	trace := textTemplate(template.Must(template.New("oteltrace").Parse(`package {{ .Name }}
+
+import (
+	"fmt"
+	"strings"
+)
+
+const packagePath = "{{ .PkgPath }}"
+
+// Hello says hello.
+func Hello() { fmt.Println(strings.ToUpper(packagePath)) }
+`)))
+	custom := textTemplate(template.Must(template.New("custom").Parse("package {{ .Name }}\n\nimport \"fmt\"\n\nfunc init() { fmt.Println() }\n")))
+	other := textTemplate(template.Must(template.New("other").Parse("package {{ .Name }}\n")))
+
+	cnf := DefaultConfig.Generate
+	cnf.Bundles = []BundleConfig{{Name: "otel", Templates: []string{"pkgpath", "oteltrace", "custom"}}}
+
+	files, err := Generator{FileWriter: nil}.Render(t.Context(), logger(t), pkgs, []Template{pkgpath, trace, other, custom}, cnf)
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+
+	require.Equal(t, "/tmp/pkg/zz_generated.other.go", files[0].Path)
+
+	require.Equal(t, "/tmp/pkg/zz_generated.otel.go", files[1].Path)
+	require.Equal(t, "otel", files[1].Template)
+	require.Equal(t, "bundle of pkgpath, oteltrace, custom", files[1].Origin)
+	require.Equal(t, os.FileMode(0o644), files[1].Mode)
+	require.Equal(t, `// Code generated by pkgpath. DO NOT EDIT.
+
+package pkg
+
+import (
+	"fmt"
+	"strings"
+)
+
+const packagePath = "example.com/pkg"
+
+// Hello says hello.
+func Hello() { fmt.Println(strings.ToUpper(packagePath)) }
+
+func init() { fmt.Println() }
+`, string(files[1].Content))
+
+	cnf.Bundles = []BundleConfig{{Name: "otel", Templates: []string{"pkgpath", "custom"}}}
+
+	t.Run("conflict", func(t *testing.T) {
+		custom := textTemplate(template.Must(template.New("custom").Parse("package {{ .Name }}\n\nconst packagePath = \"x\"\n")))
+
+		_, err := Generator{FileWriter: nil}.Render(t.Context(), logger(t), pkgs, []Template{pkgpath, custom}, cnf)
+		require.ErrorIs(t, err, ErrBundleConflict)
+		require.ErrorContains(t, err, "packagePath is declared differently by templates pkgpath and custom")
+	})
+
+	t.Run("grouped", func(t *testing.T) {
+		custom := textTemplate(template.Must(template.New("custom").Parse(`package {{ .Name }}
+
+// the path and the name.
+const (
+	packagePath = "{{ .PkgPath }}"
+	packageName = "{{ .Name }}" // the name.
+)
+`)))
+
+		files, err := Generator{FileWriter: nil}.Render(t.Context(), logger(t), pkgs, []Template{pkgpath, custom}, cnf)
+		require.NoError(t, err)
+		require.Len(t, files, 1)
+		require.Equal(t, `// Code generated by pkgpath. DO NOT EDIT.
+
+package pkg
+
+const packagePath = "example.com/pkg"
+
+// the path and the name.
+const (
+	packageName = "pkg" // the name.
+)
+`, string(files[0].Content))
+	})
+
+	t.Run("iota group", func(t *testing.T) {
+		custom := textTemplate(template.Must(template.New("custom").Parse("package {{ .Name }}\n\nconst (\n\tpackagePath = \"{{ .PkgPath }}\"\n\tfirst = iota\n)\n")))
+
+		_, err := Generator{FileWriter: nil}.Render(t.Context(), logger(t), pkgs, []Template{pkgpath, custom}, cnf)
+		require.ErrorIs(t, err, ErrBundleConflict)
+		require.ErrorContains(t, err, "packagePath is declared differently by templates pkgpath and custom")
+	})
+
+	t.Run("comments", func(t *testing.T) {
+		custom := textTemplate(template.Must(template.New("custom").Parse(`package {{ .Name }}
+
+import "fmt" // for Println.
+
+// a free-floating comment.
+
+// Hello says hello.
+func Hello() { fmt.Println() } // a trailing comment.
+
+var x = 1 // x.
+
+// a comment at the end.
+`)))
+
+		files, err := Generator{FileWriter: nil}.Render(t.Context(), logger(t), pkgs, []Template{pkgpath, custom}, cnf)
+		require.NoError(t, err)
+		require.Len(t, files, 1)
+		require.Equal(t, `// Code generated by pkgpath. DO NOT EDIT.
+
+package pkg
+
+import (
+	"fmt" // for Println.
+)
+
+const packagePath = "example.com/pkg"
+
+// a free-floating comment.
+
+// Hello says hello.
+func Hello() { fmt.Println() } // a trailing comment.
+
+var x = 1 // x.
+
+// a comment at the end.
+`, string(files[0].Content))
+	})
+	t.Run("imports", func(t *testing.T) {
+		tests := map[string]struct {
+			imports       string
+			errorAsserter tst.ErrorAssertionFunc
+			report        string
+		}{
+			"same import":         {imports: `f "fmt"; "strings"`, errorAsserter: tst.NoError(), report: ""},
+			"same name spelled":   {imports: `strings "strings"`, errorAsserter: tst.NoError(), report: ""},
+			"blank and dot":       {imports: `_ "fmt"; _ "strings"; . "errors"; . "bytes"`, errorAsserter: tst.NoError(), report: ""},
+			"same name":           {imports: `"crypto/rand"`, errorAsserter: tst.ErrorIs(ErrBundleConflict), report: `import rand "math/rand/v2" of template first, and import rand "crypto/rand" of template second`},
+			"same path":           {imports: `s "strings"`, errorAsserter: tst.ErrorIs(ErrBundleConflict), report: `import strings "strings" of template first, and import s "strings" of template second`},
+			"name of another":     {imports: `strings "example.com/strings"`, errorAsserter: tst.ErrorIs(ErrBundleConflict), report: `import strings "strings" of template first, and import strings "example.com/strings" of template second`},
+			"versioned path name": {imports: `"example.com/f/v2"; "gopkg.in/rand.v3"`, errorAsserter: tst.ErrorIs(ErrBundleConflict), report: `import f "fmt" of template first, and import f "example.com/f/v2" of template second`},
+		}
+
+		cnf := DefaultConfig.Generate
+		cnf.Bundles = []BundleConfig{{Name: "b", Templates: []string{"first", "second"}}}
+		first := textTemplate(template.Must(template.New("first").Parse("package {{ .Name }}\n\nimport (\n\tf \"fmt\"\n\t\"strings\"\n\t\"math/rand/v2\"\n)\n")))
+
+		for name, tc := range tests {
+			t.Run(name, func(t *testing.T) {
+				second := textTemplate(template.Must(template.New("second").Parse("package {{ .Name }}\n\nimport (" + tc.imports + ")\n")))
+
+				_, err := Generator{FileWriter: nil}.Render(t.Context(), logger(t), pkgs, []Template{first, second}, cnf)
+				tc.errorAsserter(t, err)
+				if tc.report != "" {
+					require.ErrorContains(t, err, "\n"+tc.report)
+				}
+			})
+		}
+	})
+}
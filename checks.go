@@ -0,0 +1,419 @@
+package pkgen
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/samber/lo"
+	"golang.org/x/tools/go/packages"
+)
+
+var ErrOutputCollision = errors.New("output path collision")
+
+// checkCollisions fails when more than one template renders to the same path,
+// which would otherwise make the last write silently win.
+func checkCollisions(files []File) error {
+	byPath := lo.GroupBy(files, func(f File) string { return filepath.Clean(f.Path) })
+
+	paths := lo.Keys(byPath)
+	slices.Sort(paths)
+
+	report := strings.Builder{}
+	for _, p := range paths {
+		group := byPath[p]
+		if len(group) < 2 {
+			continue
+		}
+
+		fmt.Fprintf(&report, "\n%s", p)
+		if group[0].Package != "" {
+			fmt.Fprintf(&report, " (package %s)", group[0].Package)
+		}
+		report.WriteString(" is rendered by:")
+		for _, f := range group {
+			fmt.Fprintf(&report, "\n  - %s (%s)", f.Template, f.Origin)
+		}
+	}
+
+	if report.Len() > 0 {
+		return fmt.Errorf("%w:%s", ErrOutputCollision, report.String())
+	}
+
+	return nil
+}
+
+// checkOutputs runs the checks every set of outputs goes through before being
+// written.
+func checkOutputs(files []File, pkgs []packages.Package, cnf GenerateConfig) error {
+	if err := checkCollisions(files); err != nil {
+		return err
+	}
+
+	return checkOutputPaths(files, pkgs, cnf)
+}
+
+// collapseVariants drops the outputs a template renders again, identical, for
+// a test variant of their package.
+func collapseVariants(files []File) []File {
+	return lo.UniqBy(files, func(f File) string {
+		return filepath.Clean(f.Path) + "\x00" + f.Template + "\x00" + f.Origin + "\x00" + contentHash(f.Content)
+	})
+}
+
+var ErrOutputPath = errors.New("output path not allowed")
+
+// outputDir is a directory outputs may be written in, within its module.
+type outputDir struct {
+	dir    string
+	module string // empty when the package is not in a module.
+}
+
+// checkOutputPaths confines every output to the directory of the package it
+// was rendered for, its output root mirror, or to one of the allowed output dirs. Outputs of plugins
+// may target any of the queried packages. Paths are compared with the
+// symlinks resolved, so a link can not lead them out of the module.
+func checkOutputPaths(files []File, pkgs []packages.Package, cnf GenerateConfig) error {
+	byPkg := map[string][]outputDir{}
+	all := []outputDir{}
+	names := outputNames{}
+
+	for _, p := range pkgs {
+		module := ""
+		if p.Module != nil {
+			module = p.Module.Dir
+		}
+
+		dirs := []outputDir{{dir: p.Dir, module: module}}
+		// a failing output root has already failed the rendering.
+		if out, err := outputPackage(p, cnf.OutputRoot, names); err == nil && out.Dir != p.Dir {
+			dirs = append(dirs, outputDir{dir: out.Dir, module: module})
+		}
+		for _, d := range cnf.AllowedOutputDirs {
+			dirs = append(dirs, outputDir{dir: d, module: module})
+		}
+
+		byPkg[p.PkgPath] = dirs
+		all = append(all, dirs...)
+	}
+
+	report := strings.Builder{}
+	for _, f := range files {
+		dirs := all
+		if f.Package != "" {
+			dirs = byPkg[f.Package]
+		}
+
+		if err := checkOutputPath(f.Path, dirs); err != nil {
+			fmt.Fprintf(&report, "\n%s (%s): %s", f.Path, f.Template, err)
+		}
+	}
+
+	if report.Len() > 0 {
+		return fmt.Errorf("%w:%s", ErrOutputPath, report.String())
+	}
+
+	return nil
+}
+
+var (
+	errOutsideDirs   = errors.New("outside of the package directory and of the allowed output dirs")
+	errOutsideModule = errors.New("outside of the module")
+	errReserved      = errors.New("reserved file")
+	errVendor        = errors.New("inside a vendor directory")
+)
+
+func checkOutputPath(path string, dirs []outputDir) error {
+	resolved, err := resolvePath(path)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range dirs {
+		dir, err := resolvePath(d.dir)
+		if err != nil {
+			return err
+		}
+
+		if !within(dir, resolved) {
+			continue
+		}
+
+		root := dir
+		if d.module != "" {
+			if root, err = resolvePath(d.module); err != nil {
+				return err
+			}
+			if !within(root, resolved) {
+				return fmt.Errorf("%w %s", errOutsideModule, d.module)
+			}
+		}
+
+		return checkReserved(root, resolved)
+	}
+
+	return errOutsideDirs
+}
+
+// checkReserved refuses the files owned by the go command.
+func checkReserved(root, path string) error {
+	switch filepath.Base(path) {
+	case "go.mod", "go.sum", "go.work", "go.work.sum":
+		return fmt.Errorf("%w %s", errReserved, filepath.Base(path))
+	}
+
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return err
+	}
+
+	if slices.Contains(strings.Split(filepath.ToSlash(rel), "/"), "vendor") {
+		return errVendor
+	}
+
+	return nil
+}
+
+// within reports whether path is strictly inside dir.
+func within(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+
+	return rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// resolvePath returns the absolute path with the symlinks resolved. The path
+// does not need to exist: only its longest existing prefix is resolved.
+func resolvePath(path string) (string, error) {
+	p, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	rest := ""
+	for {
+		resolved, err := filepath.EvalSymlinks(p)
+		if err == nil {
+			return filepath.Join(resolved, rest), nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+
+		parent := filepath.Dir(p)
+		if parent == p {
+			return filepath.Join(p, rest), nil
+		}
+
+		rest = filepath.Join(filepath.Base(p), rest)
+		p = parent
+	}
+}
+
+var ErrIdentifierCollision = errors.New("identifier collision")
+
+// declaration is where a package scope identifier is declared.
+type declaration struct {
+	pos      token.Position
+	template string // empty in the existing files.
+}
+
+func (d declaration) String() string {
+	if d.template == "" {
+		return d.pos.String()
+	}
+
+	return fmt.Sprintf("%s (template %s)", d.pos, d.template)
+}
+
+// checkIdentifiers fails when an output declares at package scope an
+// identifier that the existing files of the package, or another output of it,
+// declare too. Only the files of the build the packages are queried for are
+// considered, and the outputs replace the files they are written over.
+func checkIdentifiers(files []File, q PackagesQueryConfig) error {
+	outputs := map[string]File{}
+	for _, f := range files {
+		if isGoFile(f.Path) && !f.isManifest() {
+			outputs[filepath.Clean(f.Path)] = f
+		}
+	}
+
+	ctxt := buildContext(q)
+	ctxt.OpenFile = func(path string) (io.ReadCloser, error) {
+		if f, ok := outputs[filepath.Clean(path)]; ok {
+			return io.NopCloser(bytes.NewReader(f.Content)), nil
+		}
+		return os.Open(filepath.Clean(path))
+	}
+
+	dirs := lo.Uniq(lo.FilterMap(lo.Values(outputs), func(f File, _ int) (string, bool) { return filepath.Dir(f.Path), !f.Delete }))
+	slices.Sort(dirs)
+
+	report := strings.Builder{}
+	for _, dir := range dirs {
+		scopes, err := packageScopes(&ctxt, dir, outputs)
+		if err != nil {
+			return err
+		}
+
+		for _, pkg := range slices.Sorted(maps.Keys(scopes)) {
+			scope := scopes[pkg]
+			for _, name := range slices.Sorted(maps.Keys(scope)) {
+				decls := scope[name]
+				if len(decls) < 2 || !slices.ContainsFunc(decls, func(d declaration) bool { return d.template != "" }) {
+					continue
+				}
+
+				fmt.Fprintf(&report, "\n%s of package %s is declared in:", name, pkg)
+				for _, d := range decls {
+					fmt.Fprintf(&report, "\n  - %s", d)
+				}
+			}
+		}
+	}
+
+	if report.Len() > 0 {
+		return fmt.Errorf("%w:%s", ErrIdentifierCollision, report.String())
+	}
+
+	return nil
+}
+
+// buildContext returns the build context of the package query: the GOOS and
+// GOARCH of its env, the last entry winning as in the go command, and the
+// tags of its -tags build flag.
+func buildContext(q PackagesQueryConfig) build.Context {
+	ctxt := build.Default
+
+	for _, e := range q.Env {
+		k, v, ok := strings.Cut(e, "=")
+		if !ok {
+			continue
+		}
+		switch k {
+		case "GOOS":
+			ctxt.GOOS = v
+		case "GOARCH":
+			ctxt.GOARCH = v
+		}
+	}
+
+	for i := 0; i < len(q.BuildFlags); i++ {
+		flag, value, hasValue := strings.Cut(strings.TrimPrefix(q.BuildFlags[i], "-"), "=")
+		if flag != "-tags" && flag != "tags" {
+			continue
+		}
+		if !hasValue && i+1 < len(q.BuildFlags) {
+			i++
+			value = q.BuildFlags[i]
+		}
+		// comma separated, or space separated in the deprecated form.
+		ctxt.BuildTags = strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' })
+	}
+
+	return ctxt
+}
+
+// packageScopes returns the package scope declarations of the Go files of a
+// directory once written, by package name and identifier. The files that do
+// not parse are left to the compiler.
+func packageScopes(ctxt *build.Context, dir string, outputs map[string]File) (map[string]map[string][]declaration, error) {
+	paths := []string{}
+	entries, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	for _, e := range entries {
+		p := filepath.Join(dir, e.Name())
+		if _, ok := outputs[p]; !ok && !e.IsDir() && isGoFile(p) {
+			paths = append(paths, p)
+		}
+	}
+	for p, f := range outputs {
+		if filepath.Dir(p) == dir && !f.Delete {
+			paths = append(paths, p)
+		}
+	}
+	slices.Sort(paths)
+
+	scopes := map[string]map[string][]declaration{}
+	fset := token.NewFileSet()
+
+	for _, p := range paths {
+		if ok, err := ctxt.MatchFile(dir, filepath.Base(p)); err != nil || !ok {
+			continue
+		}
+
+		var src []byte
+		f, isOutput := outputs[p]
+		if isOutput {
+			src = f.Content
+		} else if src, err = os.ReadFile(filepath.Clean(p)); err != nil {
+			return nil, err
+		}
+
+		file, err := parser.ParseFile(fset, p, src, parser.SkipObjectResolution)
+		if err != nil {
+			continue
+		}
+
+		scope, ok := scopes[file.Name.Name]
+		if !ok {
+			scope = map[string][]declaration{}
+			scopes[file.Name.Name] = scope
+		}
+
+		for _, id := range packageScope(file) {
+			scope[id.Name] = append(scope[id.Name], declaration{pos: fset.Position(id.Pos()), template: f.Template})
+		}
+	}
+
+	return scopes, nil
+}
+
+// packageScope returns the identifiers a file declares at package scope.
+func packageScope(file *ast.File) []*ast.Ident {
+	return lo.FlatMap(file.Decls, func(d ast.Decl, _ int) []*ast.Ident { return declNames(d) })
+}
+
+// declNames returns the identifiers a top-level declaration adds to the
+// package scope.
+func declNames(decl ast.Decl) []*ast.Ident {
+	ids := []*ast.Ident{}
+
+	switch d := decl.(type) {
+	case *ast.FuncDecl:
+		if d.Recv == nil && d.Name.Name != "init" {
+			ids = append(ids, d.Name)
+		}
+	case *ast.GenDecl:
+		for _, spec := range d.Specs {
+			ids = append(ids, specNames(spec)...)
+		}
+	}
+
+	return lo.Filter(ids, func(id *ast.Ident, _ int) bool { return id.Name != "_" })
+}
+
+func specNames(spec ast.Spec) []*ast.Ident {
+	switch s := spec.(type) {
+	case *ast.ValueSpec:
+		return lo.Filter(s.Names, func(id *ast.Ident, _ int) bool { return id.Name != "_" })
+	case *ast.TypeSpec:
+		return []*ast.Ident{s.Name}
+	}
+
+	return nil
+}
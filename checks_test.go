@@ -0,0 +1,182 @@
+package pkgen
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/ifnotnil/x/tst"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/tools/go/packages"
+)
+
+func TestCheckCollisions(t *testing.T) {
+	t.Run("no collisions", func(t *testing.T) {
+		files := []File{
+			{Path: "/tmp/a/x.go", Content: nil, Mode: 0, DirMode: 0, Package: "a", Template: "x", Origin: "builtin x", TemplateVersion: "", ParamsHash: "", Delete: false, Sources: nil, Region: ""},
+			{Path: "/tmp/a/y.go", Content: nil, Mode: 0, DirMode: 0, Package: "a", Template: "y", Origin: "builtin y", TemplateVersion: "", ParamsHash: "", Delete: false, Sources: nil, Region: ""},
+			{Path: "/tmp/b/x.go", Content: nil, Mode: 0, DirMode: 0, Package: "b", Template: "x", Origin: "builtin x", TemplateVersion: "", ParamsHash: "", Delete: false, Sources: nil, Region: ""},
+		}
+		require.NoError(t, checkCollisions(files))
+	})
+
+	t.Run("collision", func(t *testing.T) {
+		files := []File{
+			{Path: "/tmp/a/zz_generated.otel.go", Content: nil, Mode: 0, DirMode: 0, Package: "example.com/a", Template: "otel", Origin: "builtin templates/otel@v1.tmpl", TemplateVersion: "", ParamsHash: "", Delete: false, Sources: nil, Region: ""},
+			{Path: "/tmp/a/zz_generated.otel.go", Content: nil, Mode: 0, DirMode: 0, Package: "example.com/a", Template: "otel", Origin: "file a/otel.tmpl", TemplateVersion: "", ParamsHash: "", Delete: false, Sources: nil, Region: ""},
+			{Path: "/tmp/a/other.go", Content: nil, Mode: 0, DirMode: 0, Package: "example.com/a", Template: "other", Origin: "file other.tmpl", TemplateVersion: "", ParamsHash: "", Delete: false, Sources: nil, Region: ""},
+		}
+
+		err := checkCollisions(files)
+		require.ErrorIs(t, err, ErrOutputCollision)
+		require.Equal(t, `output path collision:
+/tmp/a/zz_generated.otel.go (package example.com/a) is rendered by:
+  - otel (builtin templates/otel@v1.tmpl)
+  - otel (file a/otel.tmpl)`, err.Error())
+	})
+
+	t.Run("output pattern without the template name", func(t *testing.T) {
+		pkgs := []packages.Package{{Name: "a", PkgPath: "example.com/a", Dir: "/tmp/a", GoFiles: []string{"/tmp/a/a.go"}}}
+		tmps := []Template{
+			textTemplate(template.Must(template.New("t1").Parse("package {{ .Name }}\n"))),
+			textTemplate(template.Must(template.New("t2").Parse("package {{ .Name }}\n"))),
+		}
+		cnf := GenerateConfig{OutputFile: "zz_generated.go", OutputFileMod: 0o644, Format: "", OutputRoot: "", OutputDirMod: 0, Header: HeaderConfig{LicenseFile: "", Marker: false, Build: "", Checksum: ""}, Manifest: "", Verify: false, Bundles: nil, AddRequires: false, LineDirectives: false, AllowedOutputDirs: nil, TemplateOutputs: nil, Query: PackagesQueryConfig{}}
+
+		// no write expectations: nothing is written on a collision.
+		err := Generator{FileWriter: NewMockFileWriter(t)}.Generate(t.Context(), logger(t), pkgs, tmps, cnf)
+		require.ErrorIs(t, err, ErrOutputCollision)
+	})
+}
+
+func TestCheckOutputPaths(t *testing.T) {
+	module := t.TempDir()
+	outside := t.TempDir()
+	pkgDir := filepath.Join(module, "pkg")
+	require.NoError(t, os.MkdirAll(filepath.Join(pkgDir, "vendor"), 0o755))
+	require.NoError(t, os.MkdirAll(filepath.Join(module, "gen"), 0o755))
+	require.NoError(t, os.Symlink(outside, filepath.Join(pkgDir, "link")))
+
+	pkgs := []packages.Package{{
+		Name:    "pkg",
+		PkgPath: "example.com/m/pkg",
+		Dir:     pkgDir,
+		Module:  &packages.Module{Path: "example.com/m", Dir: module},
+	}}
+
+	tests := map[string]struct {
+		path          string
+		pkg           string
+		allowed       []string
+		errorAsserter tst.ErrorAssertionFunc
+	}{
+		"in the package":             {path: filepath.Join(pkgDir, "zz.go"), pkg: "example.com/m/pkg", allowed: nil, errorAsserter: tst.NoError()},
+		"in a package sub dir":       {path: filepath.Join(pkgDir, "sub", "zz.go"), pkg: "example.com/m/pkg", allowed: nil, errorAsserter: tst.NoError()},
+		"plugin output in a package": {path: filepath.Join(pkgDir, "zz.go"), pkg: "", allowed: nil, errorAsserter: tst.NoError()},
+		"parent dir":                 {path: filepath.Join(pkgDir, "..", "zz.go"), pkg: "example.com/m/pkg", allowed: nil, errorAsserter: tst.ErrorIs(ErrOutputPath)},
+		"plugin output outside":      {path: filepath.Join(outside, "zz.go"), pkg: "", allowed: nil, errorAsserter: tst.ErrorIs(ErrOutputPath)},
+		"symlink out of the module":  {path: filepath.Join(pkgDir, "link", "zz.go"), pkg: "example.com/m/pkg", allowed: nil, errorAsserter: tst.ErrorIs(ErrOutputPath)},
+		"go.mod":                     {path: filepath.Join(pkgDir, "go.mod"), pkg: "example.com/m/pkg", allowed: nil, errorAsserter: tst.ErrorIs(ErrOutputPath)},
+		"go.sum":                     {path: filepath.Join(pkgDir, "go.sum"), pkg: "example.com/m/pkg", allowed: nil, errorAsserter: tst.ErrorIs(ErrOutputPath)},
+		"vendor":                     {path: filepath.Join(pkgDir, "vendor", "zz.go"), pkg: "example.com/m/pkg", allowed: nil, errorAsserter: tst.ErrorIs(ErrOutputPath)},
+		"allowed dir":                {path: filepath.Join(module, "gen", "zz.go"), pkg: "example.com/m/pkg", allowed: []string{filepath.Join(module, "gen")}, errorAsserter: tst.NoError()},
+		"allowed dir out of module":  {path: filepath.Join(outside, "zz.go"), pkg: "example.com/m/pkg", allowed: []string{outside}, errorAsserter: tst.ErrorIs(ErrOutputPath)},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			files := []File{{Path: tc.path, Content: nil, Mode: 0, DirMode: 0, Package: tc.pkg, Template: "t", Origin: "builtin t", TemplateVersion: "", ParamsHash: "", Delete: false, Sources: nil, Region: ""}}
+			cnf := GenerateConfig{OutputFile: "", OutputFileMod: 0, Format: "", OutputRoot: "", OutputDirMod: 0, Header: HeaderConfig{LicenseFile: "", Marker: false, Build: "", Checksum: ""}, Manifest: "", Verify: false, Bundles: nil, AddRequires: false, LineDirectives: false, AllowedOutputDirs: tc.allowed, TemplateOutputs: nil, Query: PackagesQueryConfig{}}
+			tc.errorAsserter(t, checkOutputPaths(files, pkgs, cnf))
+		})
+	}
+
+	t.Run("output name", func(t *testing.T) {
+		tmps := []Template{textTemplate(template.Must(template.New("t").Parse("package {{ .Name }}\n")))}
+		p := pkgs[0]
+		p.GoFiles = []string{filepath.Join(pkgDir, "pkg.go")}
+
+		for _, output := range []string{"../zz.go", "/etc/zz.go", "vendor/zz.go"} {
+			cnf := GenerateConfig{OutputFile: output, OutputFileMod: 0o644, Format: "", OutputRoot: "", OutputDirMod: 0, Header: HeaderConfig{LicenseFile: "", Marker: false, Build: "", Checksum: ""}, Manifest: "", Verify: false, Bundles: nil, AddRequires: false, LineDirectives: false, AllowedOutputDirs: nil, TemplateOutputs: nil, Query: PackagesQueryConfig{}}
+			err := Generator{FileWriter: NewMockFileWriter(t)}.Generate(t.Context(), logger(t), []packages.Package{p}, tmps, cnf)
+			require.ErrorIs(t, err, ErrOutputPath, output)
+		}
+	})
+}
+
+func TestCheckIdentifiers(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		p := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(p, []byte(content), 0o600))
+		return p
+	}
+
+	write("a.go", "package a\n\nvar tracer = 1\n\ntype T struct{}\n\nfunc (T) meter() {}\n\nfunc init() {}\n")
+	write("ignored.go", "//go:build ignore\n\npackage a\n\nvar packagePath = 1\n")
+	old := write("zz_generated.otel.go", "package a\n\nvar logger = 1\n")
+	stale := write("zz_generated.old.go", "package a\n\nvar meter = 1\n")
+
+	output := func(path, template, content string, del bool) File {
+		return File{Path: path, Content: []byte(content), Mode: 0o644, DirMode: 0, Package: "example.com/a", Template: template, Origin: "", TemplateVersion: "", ParamsHash: "", Delete: del, Sources: nil, Region: ""}
+	}
+
+	t.Run("no collisions", func(t *testing.T) {
+		files := []File{
+			output(old, "otel", "package a\n\nvar logger, meter = 1, 2\n\nfunc init() {}\n", false),
+			output(stale, "old", "", true),
+		}
+		require.NoError(t, checkIdentifiers(files, PackagesQueryConfig{}))
+	})
+
+	t.Run("collisions", func(t *testing.T) {
+		files := []File{
+			output(old, "otel", "package a\n\nvar (\n\tpackagePath = 1\n\ttracer      = 2\n)\n", false),
+			output(filepath.Join(dir, "zz_generated.pkgpath.go"), "pkgpath", "package a\n\nconst packagePath = 1\n", false),
+			output(filepath.Join(dir, "zz_generated.test_test.go"), "test", "package a_test\n\nconst packagePath = 1\n", false),
+		}
+
+		err := checkIdentifiers(files, PackagesQueryConfig{})
+		require.ErrorIs(t, err, ErrIdentifierCollision)
+		require.Equal(t, `identifier collision:
+packagePath of package a is declared in:
+  - `+old+`:4:2 (template otel)
+  - `+filepath.Join(dir, "zz_generated.pkgpath.go")+`:3:7 (template pkgpath)
+tracer of package a is declared in:
+  - `+filepath.Join(dir, "a.go")+`:3:5
+  - `+old+`:5:2 (template otel)`, err.Error())
+	})
+	t.Run("build of the query", func(t *testing.T) {
+		write("a_windows.go", "package a\n\nvar windows = 1\n")
+		write("tagged.go", "//go:build tagged\n\npackage a\n\nvar tagged = 1\n")
+		files := []File{output(old, "otel", "package a\n\nvar windows, tagged = 1, 2\n", false)}
+
+		tests := map[string]struct {
+			query      PackagesQueryConfig
+			collisions []string
+		}{
+			"default":          {query: PackagesQueryConfig{IncludeTests: false, Env: []string{"GOOS=linux"}, BuildFlags: nil, Dir: "", Patterns: nil}, collisions: nil},
+			"env":              {query: PackagesQueryConfig{IncludeTests: false, Env: []string{"GOOS=linux", "GOOS=windows"}, BuildFlags: nil, Dir: "", Patterns: nil}, collisions: []string{"windows"}},
+			"tags":             {query: PackagesQueryConfig{IncludeTests: false, Env: []string{"GOOS=linux"}, BuildFlags: []string{"-tags=other,tagged"}, Dir: "", Patterns: nil}, collisions: []string{"tagged"}},
+			"tags as separate": {query: PackagesQueryConfig{IncludeTests: false, Env: []string{"GOOS=windows"}, BuildFlags: []string{"-race", "--tags", "tagged"}, Dir: "", Patterns: nil}, collisions: []string{"tagged", "windows"}},
+		}
+
+		for name, tc := range tests {
+			t.Run(name, func(t *testing.T) {
+				err := checkIdentifiers(files, tc.query)
+				if len(tc.collisions) == 0 {
+					require.NoError(t, err)
+					return
+				}
+
+				require.ErrorIs(t, err, ErrIdentifierCollision)
+				for _, c := range tc.collisions {
+					require.Contains(t, err.Error(), c+" of package a is declared in:")
+				}
+				require.Equal(t, len(tc.collisions), strings.Count(err.Error(), "is declared in:"))
+			})
+		}
+	})
+}
@@ -0,0 +1,119 @@
+package pkgen
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+)
+
+// The policies of HeaderConfig.Checksum, when a target no longer matches its
+// checksum.
+const (
+	ChecksumWarn   = "warn"   // the manual change is reported, and overwritten.
+	ChecksumRefuse = "refuse" // the run fails, nothing is written.
+)
+
+var (
+	ErrManualEdit     = errors.New("generated file edited by hand")
+	ErrChecksumPolicy = errors.New("unknown checksum policy")
+)
+
+const checksumComment = "// pkgen:checksum"
+
+var checksumLine = regexp.MustCompile(`(?m)^// pkgen:checksum(?: (\S+))?\n`)
+
+// withoutChecksum returns the content the checksum is computed on, that is
+// everything but the checksum line, and the recorded checksum.
+func withoutChecksum(src []byte) ([]byte, string, bool) {
+	loc := checksumLine.FindSubmatchIndex(src)
+	if loc == nil {
+		return src, "", false
+	}
+
+	recorded := ""
+	if loc[2] >= 0 {
+		recorded = string(src[loc[2]:loc[3]])
+	}
+
+	body := make([]byte, 0, len(src)-(loc[1]-loc[0]))
+	body = append(body, src[:loc[0]]...)
+	body = append(body, src[loc[1]:]...)
+
+	return body, recorded, true
+}
+
+// seal writes the checksum of the content in its checksum line, once it is
+// formatted.
+func seal(src []byte) []byte {
+	loc := checksumLine.FindIndex(src)
+	if loc == nil {
+		return src
+	}
+
+	body, _, _ := withoutChecksum(src)
+
+	out := make([]byte, 0, len(src)+72)
+	out = append(out, src[:loc[0]]...)
+	out = append(out, checksumComment+" "+contentHash(body)+"\n"...)
+	out = append(out, src[loc[1]:]...)
+
+	return out
+}
+
+// edited reports whether a content no longer matches its checksum. A content
+// without a checksum is never considered edited.
+func edited(src []byte) bool {
+	body, recorded, ok := withoutChecksum(src)
+	if !ok || recorded == "" {
+		return false
+	}
+
+	return recorded != contentHash(body)
+}
+
+// checkEdits looks for targets edited by hand since they were generated, and
+// warns or refuses according to the policy, before they are written over. The
+// report is the diff from the generated content to the edited one, so that
+// the change can be ported back into the template. It is only known while the
+// template renders the content the checksum was computed on.
+func checkEdits(ctx context.Context, logger *slog.Logger, files []File, policy string) error {
+	errs := []error{}
+
+	for _, f := range files {
+		if f.Delete || f.isManifest() || !isGoFile(f.Path) {
+			continue
+		}
+
+		old, err := os.ReadFile(f.Path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if !edited(old) || bytes.Equal(old, f.Content) {
+			continue
+		}
+
+		_, recorded, _ := withoutChecksum(old)
+		_, rendered, _ := withoutChecksum(f.Content)
+		diff := "the content no longer matches its checksum, and the template renders a different one since"
+		if recorded == rendered {
+			diff = unifiedDiff(f.Path+" (generated)", f.Path+" (edited)", f.Content, old)
+		}
+
+		if policy == ChecksumRefuse {
+			errs = append(errs, fmt.Errorf("%w: %s (%s):\n%s", ErrManualEdit, f.Path, f.Template, diff))
+			continue
+		}
+
+		logger.WarnContext(ctx, "generated file edited by hand, the change is overwritten", slog.String("file", f.Path), slog.String("template", f.Template), slog.String("diff", diff))
+	}
+
+	return errors.Join(errs...)
+}
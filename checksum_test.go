@@ -0,0 +1,102 @@
+package pkgen
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/tools/go/packages"
+)
+
+func TestSeal(t *testing.T) {
+	src := []byte("// pkgen:checksum\n\npackage a\n\nconst A = 1\n")
+
+	sealed := seal(src)
+	require.Equal(t, "// pkgen:checksum "+contentHash([]byte("\npackage a\n\nconst A = 1\n"))+"\n\npackage a\n\nconst A = 1\n", string(sealed))
+	require.False(t, edited(sealed))
+	require.Equal(t, sealed, seal(sealed), "sealing is idempotent")
+
+	require.True(t, edited([]byte(strings.Replace(string(sealed), "A = 1", "A = 2", 1))))
+	require.False(t, edited([]byte("package a\n")), "no checksum")
+	require.False(t, edited(src), "no recorded checksum")
+	require.Equal(t, []byte("package a\n"), seal([]byte("package a\n")))
+}
+
+func TestGenerateChecksum(t *testing.T) {
+	dir := t.TempDir()
+	pkgs := []packages.Package{{Name: "a", PkgPath: "example.com/a", Dir: dir, GoFiles: []string{filepath.Join(dir, "a.go")}}}
+	tmps := []Template{textTemplate(template.Must(template.New("t").Parse("package {{ .Name }}\n\nconst A = 1\n")))}
+	target := filepath.Join(dir, "zz_generated.t.go")
+
+	cnf := DefaultConfig.Generate
+	cnf.Header.Marker = true
+	cnf.Header.Checksum = ChecksumRefuse
+
+	g := Generator{FileWriter: nil}
+	require.NoError(t, g.Generate(t.Context(), logger(t), pkgs, tmps, cnf))
+
+	generated, err := os.ReadFile(target)
+	require.NoError(t, err)
+	require.Contains(t, string(generated), "\n// pkgen:checksum sha256:")
+
+	// generating again over an untouched file is fine.
+	require.NoError(t, g.Generate(t.Context(), logger(t), pkgs, tmps, cnf))
+
+	edit := strings.Replace(string(generated), "const A = 1", "const A = 1\n\nconst B = 2", 1)
+	require.NoError(t, os.WriteFile(target, []byte(edit), 0o600))
+
+	t.Run("status", func(t *testing.T) {
+		files, err := g.Render(t.Context(), logger(t), pkgs, tmps, cnf)
+		require.NoError(t, err)
+
+		statuses, err := g.Status(files, cnf)
+		require.NoError(t, err)
+		require.Equal(t, []OutputStatus{{State: StateModified, Path: target, Package: "example.com/a", Template: "t"}}, statuses)
+	})
+
+	t.Run("refuse", func(t *testing.T) {
+		err := g.Generate(t.Context(), logger(t), pkgs, tmps, cnf)
+		require.ErrorIs(t, err, ErrManualEdit)
+		require.Contains(t, err.Error(), "+const B = 2\n")
+
+		got, err := os.ReadFile(target)
+		require.NoError(t, err)
+		require.Equal(t, edit, string(got))
+	})
+
+	t.Run("plan and apply", func(t *testing.T) {
+		files, err := g.Render(t.Context(), logger(t), pkgs, tmps, cnf)
+		require.NoError(t, err)
+		plan, err := g.Plan(files, true)
+		require.NoError(t, err)
+
+		err = g.Apply(t.Context(), logger(t), plan, nil, cnf)
+		require.ErrorIs(t, err, ErrManualEdit)
+		require.Contains(t, err.Error(), "+const B = 2\n")
+
+		got, err := os.ReadFile(target)
+		require.NoError(t, err)
+		require.Equal(t, edit, string(got), "nothing is applied")
+	})
+
+	t.Run("template changed", func(t *testing.T) {
+		changed := []Template{textTemplate(template.Must(template.New("t").Parse("package {{ .Name }}\n\nconst A = 3\n")))}
+
+		err := g.Generate(t.Context(), logger(t), pkgs, changed, cnf)
+		require.ErrorIs(t, err, ErrManualEdit)
+		require.Contains(t, err.Error(), "no longer matches its checksum")
+		require.NotContains(t, err.Error(), "+const B = 2\n", "no diff against a content that was never generated")
+	})
+
+	t.Run("warn", func(t *testing.T) {
+		cnf.Header.Checksum = ChecksumWarn
+		require.NoError(t, g.Generate(t.Context(), logger(t), pkgs, tmps, cnf))
+
+		got, err := os.ReadFile(target)
+		require.NoError(t, err)
+		require.Equal(t, string(generated), string(got))
+	})
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ifnotnil/pkgen"
+	"github.com/samber/lo"
+	"go.yaml.in/yaml/v4"
+)
+
+var ErrUsage = errors.New("usage")
+
+// subcommand splits the leading sub command, if any, from the rest of the arguments.
+func subcommand(args []string) (string, []string) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return "", args
+	}
+
+	return args[0], args[1:]
+}
+
+func (p *PKGen) Command(ctx context.Context, command string, args []string) error {
+	switch command {
+	case "templates":
+		return p.TemplatesCommand(ctx, os.Stdout, args)
+	case "data":
+		return p.Data(ctx, os.Stdout, args)
+	case "plan":
+		return p.Plan(ctx, os.Stdout, args)
+	case "apply":
+		return p.Apply(ctx, args)
+	case "status":
+		return p.Status(ctx, os.Stdout, args)
+	default:
+		return fmt.Errorf("%w: unknown command %q", ErrUsage, command)
+	}
+}
+
+const templatesUsage = `
+  pkgen templates list [--json] [config flags]
+  pkgen templates show <name> [--json] [config flags]
+  pkgen templates diff <name@version> <name@version>`
+
+func (p *PKGen) TemplatesCommand(ctx context.Context, w io.Writer, args []string) error {
+	sub, args := subcommand(args)
+
+	switch sub {
+	case "list":
+		return p.TemplatesList(ctx, w, args)
+	case "show":
+		name, args := subcommand(args)
+		if name == "" {
+			return fmt.Errorf("%w: %s", ErrUsage, templatesUsage)
+		}
+		return p.TemplatesShow(ctx, w, name, args)
+	case "diff":
+		if len(args) != 2 {
+			return fmt.Errorf("%w: %s", ErrUsage, templatesUsage)
+		}
+
+		d, err := p.tm.Diff(args[0], args[1])
+		if err != nil {
+			return err
+		}
+
+		_, err = io.WriteString(w, d)
+		return err
+	default:
+		return fmt.Errorf("%w: %s", ErrUsage, templatesUsage)
+	}
+}
+
+// commandConfig parses the config flags of a sub command, plus its own ones
+// registered by flags. It also returns the positional arguments left after the flags.
+func commandConfig(ctx context.Context, name string, args []string, flags func(fs *flag.FlagSet)) (pkgen.Config, []string, error) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags(fs)
+
+	cnf, err := pkgen.NewConfigGivenCLI(ctx, fs, args)
+	if err != nil {
+		return pkgen.Config{}, nil, err
+	}
+
+	return cnf, fs.Args(), nil
+}
+
+func jsonFlag(dst *bool) func(fs *flag.FlagSet) {
+	return func(fs *flag.FlagSet) {
+		fs.BoolVar(dst, "json", false, "output as json")
+	}
+}
+
+type templateInfo struct {
+	Name        string             `json:"name"`
+	Version     string             `json:"version,omitempty"`
+	Source      string             `json:"source"`
+	Path        string             `json:"path"`
+	Description string             `json:"description,omitempty"`
+	Params      map[string]any     `json:"params,omitempty"`
+	FrontMatter *pkgen.FrontMatter `json:"front_matter,omitempty"`
+	Sample      *string            `json:"sample,omitempty"`
+}
+
+func newTemplateInfo(t pkgen.Template) templateInfo {
+	return templateInfo{
+		Name:        t.Name,
+		Version:     t.Version,
+		Source:      string(t.Source),
+		Path:        t.Path,
+		Description: t.FrontMatter.Description,
+		Params:      t.FrontMatter.Params,
+		FrontMatter: nil,
+		Sample:      nil,
+	}
+}
+
+func (p *PKGen) TemplatesList(ctx context.Context, w io.Writer, args []string) error {
+	jsonOutput := false
+	cnf, _, err := commandConfig(ctx, "templates list", args, jsonFlag(&jsonOutput))
+	if err != nil {
+		return err
+	}
+
+	tmps, err := p.tm.List(cnf.Templates)
+	if err != nil {
+		return err
+	}
+
+	infos := lo.Map(tmps, func(t pkgen.Template, _ int) templateInfo { return newTemplateInfo(t) })
+
+	if jsonOutput {
+		return writeJSON(w, infos)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tVERSION\tSOURCE\tDESCRIPTION")
+	for _, i := range infos {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", i.Name, i.Version, i.Source, i.Description)
+	}
+
+	return tw.Flush()
+}
+
+func (p *PKGen) TemplatesShow(ctx context.Context, w io.Writer, name string, args []string) error {
+	jsonOutput := false
+	cnf, _, err := commandConfig(ctx, "templates show", args, jsonFlag(&jsonOutput))
+	if err != nil {
+		return err
+	}
+
+	tmp, err := p.tm.Find(name, cnf.Templates)
+	if err != nil {
+		return err
+	}
+
+	sample, err := tmp.Sample()
+	if err != nil {
+		return err
+	}
+
+	info := newTemplateInfo(tmp)
+	info.FrontMatter = &tmp.FrontMatter
+	if sample != nil {
+		info.Sample = lo.ToPtr(string(sample))
+	}
+
+	if jsonOutput {
+		return writeJSON(w, info)
+	}
+
+	fm, err := yaml.Marshal(tmp.FrontMatter)
+	if err != nil {
+		return err
+	}
+
+	params := []byte("none\n")
+	if len(info.Params) > 0 {
+		params, err = yaml.Marshal(info.Params)
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(w, "Name:    %s\n", info.Name)
+	if info.Version != "" {
+		fmt.Fprintf(w, "Version: %s\n", info.Version)
+	}
+	fmt.Fprintf(w, "Source:  %s (%s)\n", info.Source, info.Path)
+	fmt.Fprintf(w, "\nParameters:\n%s", indent(string(params)))
+	fmt.Fprintf(w, "\nFront-matter:\n%s", indent(string(fm)))
+	if info.Sample != nil {
+		fmt.Fprintf(w, "\nSample (%s):\n%s", pkgen.SamplePackage().PkgPath, indent(*info.Sample))
+	}
+
+	return nil
+}
+
+func indent(s string) string {
+	lines := strings.SplitAfter(s, "\n")
+	for i, l := range lines {
+		if l != "" && l != "\n" {
+			lines[i] = "    " + l
+		}
+	}
+
+	return strings.Join(lines, "")
+}
+
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+const dataUsage = `pkgen data [--json] [config flags] [pattern...]`
+
+// Data prints the data each configured template receives, for every package
+// matching the patterns (or the configured ones).
+func (p *PKGen) Data(ctx context.Context, w io.Writer, args []string) error {
+	jsonOutput := false
+	cnf, patterns, err := commandConfig(ctx, "data", args, jsonFlag(&jsonOutput))
+	if err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrUsage, dataUsage, err)
+	}
+
+	if len(patterns) > 0 {
+		cnf.PackagesQuery.Patterns = patterns
+	}
+
+	pkgs, err := p.pk.Query(ctx, cnf.PackagesQuery)
+	if err != nil {
+		return err
+	}
+
+	tmps, err := p.tm.GetAll(cnf.Templates)
+	if err != nil {
+		return err
+	}
+
+	// without templates, still show what pkgen adds to the package.
+	if len(tmps) == 0 {
+		tmps = []pkgen.Template{{}}
+	}
+
+	data, err := p.gn.Data(ctx, pkgs, tmps, cnf.GenerateConfig())
+	if err != nil {
+		return err
+	}
+
+	if jsonOutput {
+		return writeJSON(w, data)
+	}
+
+	return writeYAML(w, data)
+}
+
+// writeYAML goes through json, so that the keys are the go field names the
+// templates use, like in the json output.
+func writeYAML(w io.Writer, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	node := yaml.Node{}
+	if err := yaml.Unmarshal(b, &node); err != nil {
+		return err
+	}
+	defaultStyle(&node)
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(&node); err != nil {
+		return err
+	}
+
+	return enc.Close()
+}
+
+// defaultStyle drops the flow and quoting styles kept from the json input.
+func defaultStyle(n *yaml.Node) {
+	n.Style = 0
+	for _, c := range n.Content {
+		defaultStyle(c)
+	}
+}
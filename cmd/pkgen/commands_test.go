@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"text/template"
+
+	"github.com/ifnotnil/pkgen"
+	"github.com/ifnotnil/x/tst"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/tools/go/packages"
+)
+
+func testTemplate(name, text string) pkgen.Template {
+	fm := pkgen.FrontMatter{}
+	fm.Description = "a test template"
+
+	return pkgen.Template{
+		Name:        name,
+		Version:     "v1",
+		Source:      pkgen.SourceBuiltin,
+		Path:        "templates/" + name + "@v1.tmpl",
+		Text:        template.Must(template.New(name).Parse(text)),
+		Plugin:      "",
+		FrontMatter: fm,
+		Params:      nil,
+		Output:      pkgen.OutputConfig{},
+	}
+}
+
+func TestTemplatesCommand(t *testing.T) {
+	tmp := testTemplate("t", "package {{ .Name }}\n")
+
+	tests := map[string]struct {
+		args          []string
+		expectations  func(tm *MockTemplates)
+		expected      string
+		errorAsserter tst.ErrorAssertionFunc
+	}{
+		"list": {
+			args: []string{"list"},
+			expectations: func(tm *MockTemplates) {
+				tm.EXPECT().List(mock.Anything).Return([]pkgen.Template{tmp}, nil)
+			},
+			expected:      "NAME  VERSION  SOURCE   DESCRIPTION\nt     v1       builtin  a test template\n",
+			errorAsserter: tst.NoError(),
+		},
+		"show": {
+			args: []string{"show", "t@v1"},
+			expectations: func(tm *MockTemplates) {
+				tm.EXPECT().Find("t@v1", mock.Anything).Return(tmp, nil)
+			},
+			expected:      "Name:    t\nVersion: v1\nSource:  builtin (templates/t@v1.tmpl)\n\nParameters:\n    none\n\nFront-matter:\n    description: a test template\n\nSample (" + pkgen.SamplePackage().PkgPath + "):\n    package " + pkgen.SamplePackage().Name + "\n",
+			errorAsserter: tst.NoError(),
+		},
+		"show without name": {
+			args:          []string{"show"},
+			expectations:  func(*MockTemplates) {},
+			expected:      "",
+			errorAsserter: tst.ErrorIs(ErrUsage),
+		},
+		"diff": {
+			args: []string{"diff", "t@v1", "t@v2"},
+			expectations: func(tm *MockTemplates) {
+				tm.EXPECT().Diff("t@v1", "t@v2").Return("-a\n+b\n", nil)
+			},
+			expected:      "-a\n+b\n",
+			errorAsserter: tst.NoError(),
+		},
+		"diff one arg": {
+			args:          []string{"diff", "t@v1"},
+			expectations:  func(*MockTemplates) {},
+			expected:      "",
+			errorAsserter: tst.ErrorIs(ErrUsage),
+		},
+		"unknown": {
+			args:          []string{"remove"},
+			expectations:  func(*MockTemplates) {},
+			expected:      "",
+			errorAsserter: tst.ErrorIs(ErrUsage),
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			p, _, tm, _ := testPKGen(t)
+			tc.expectations(tm)
+
+			w := bytes.Buffer{}
+			tc.errorAsserter(t, p.TemplatesCommand(t.Context(), &w, tc.args))
+			require.Equal(t, tc.expected, w.String())
+		})
+	}
+
+	t.Run("list json", func(t *testing.T) {
+		p, _, tm, _ := testPKGen(t)
+		tm.EXPECT().List(mock.Anything).Return([]pkgen.Template{tmp}, nil)
+
+		w := bytes.Buffer{}
+		require.NoError(t, p.TemplatesCommand(t.Context(), &w, []string{"list", "--json"}))
+
+		got := []templateInfo{}
+		require.NoError(t, json.Unmarshal(w.Bytes(), &got))
+		require.Equal(t, []templateInfo{newTemplateInfo(tmp)}, got)
+	})
+}
+
+func TestData(t *testing.T) {
+	pkgs := []packages.Package{{
+		Name:    "a",
+		PkgPath: "example.com/m/a",
+		Dir:     "/tmp/m/a",
+		GoFiles: []string{"/tmp/m/a/a.go"},
+		Module:  &packages.Module{Path: "example.com/m", Dir: "/tmp/m"},
+	}}
+
+	t.Run("patterns", func(t *testing.T) {
+		p, pk, tm, gn := testPKGen(t)
+		pk.EXPECT().Query(mock.Anything, mock.MatchedBy(func(q pkgen.PackagesQueryConfig) bool {
+			return len(q.Patterns) == 1 && q.Patterns[0] == "./a"
+		})).Return(pkgs, nil)
+		tm.EXPECT().GetAll(mock.Anything).Return([]pkgen.Template{testTemplate("t", "package {{ .Name }}\n")}, nil)
+		gn.EXPECT().Data(mock.Anything, pkgs, mock.Anything, mock.Anything).RunAndReturn(pkgen.Generator{FileWriter: nil}.Data)
+
+		w := bytes.Buffer{}
+		require.NoError(t, p.Data(t.Context(), &w, []string{"--json", "./a"}))
+
+		got := []map[string]any{}
+		require.NoError(t, json.Unmarshal(w.Bytes(), &got))
+		require.Len(t, got, 1)
+		require.Equal(t, "a", got[0]["Name"])
+		require.Equal(t, "example.com/m/a", got[0]["PkgPath"])
+		require.Equal(t, "/tmp/m/a", got[0]["Output"].(map[string]any)["Dir"])
+	})
+
+	t.Run("output root", func(t *testing.T) {
+		p, pk, tm, gn := testPKGen(t)
+		pk.EXPECT().Query(mock.Anything, mock.Anything).Return(pkgs, nil)
+		tm.EXPECT().GetAll(mock.Anything).Return([]pkgen.Template{testTemplate("t", "package {{ .Name }}\n")}, nil)
+		gn.EXPECT().Data(mock.Anything, pkgs, mock.Anything, mock.Anything).RunAndReturn(pkgen.Generator{FileWriter: nil}.Data)
+
+		w := bytes.Buffer{}
+		require.NoError(t, p.Data(t.Context(), &w, []string{"--json", "--output-root", "gen", "./a"}))
+
+		got := []map[string]any{}
+		require.NoError(t, json.Unmarshal(w.Bytes(), &got))
+		require.Len(t, got, 1)
+		require.Equal(t, map[string]any{"Name": "a", "PkgPath": "example.com/m/gen/a", "Dir": "/tmp/m/gen/a"}, got[0]["Output"])
+	})
+
+	t.Run("without templates", func(t *testing.T) {
+		p, pk, tm, gn := testPKGen(t)
+		pk.EXPECT().Query(mock.Anything, mock.Anything).Return(pkgs, nil)
+		tm.EXPECT().GetAll(mock.Anything).Return(nil, nil)
+		gn.EXPECT().Data(mock.Anything, pkgs, mock.Anything, mock.Anything).RunAndReturn(pkgen.Generator{FileWriter: nil}.Data)
+
+		w := bytes.Buffer{}
+		require.NoError(t, p.Data(t.Context(), &w, nil))
+		require.Contains(t, w.String(), "PkgPath: example.com/m/a\n")
+	})
+}
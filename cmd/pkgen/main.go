@@ -4,6 +4,8 @@ import (
 	"context"
 	"log/slog"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/ifnotnil/pkgen"
@@ -11,9 +13,9 @@ import (
 	"golang.org/x/term"
 )
 
-func slogHandler(loggerLevel *slog.LevelVar) slog.Handler {
-	if term.IsTerminal(int(os.Stdout.Fd())) { //nolint:gosec // G115: os.Stdout.Fd() is a valid file descriptor, overflow is not a concern here
-		return tint.NewTextHandler(os.Stdout, &tint.Options{
+func slogHandler(out *os.File, loggerLevel *slog.LevelVar) slog.Handler {
+	if term.IsTerminal(int(out.Fd())) { //nolint:gosec // G115: out.Fd() is a valid file descriptor, overflow is not a concern here
+		return tint.NewTextHandler(out, &tint.Options{
 			AddSource:   false,
 			Level:       loggerLevel,
 			ReplaceAttr: nil,
@@ -22,37 +24,77 @@ func slogHandler(loggerLevel *slog.LevelVar) slog.Handler {
 		})
 	}
 
-	return slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+	return slog.NewTextHandler(out, &slog.HandlerOptions{
 		AddSource:   false,
 		Level:       loggerLevel,
 		ReplaceAttr: nil,
 	})
 }
 
+const (
+	exitOK          = 0
+	exitError       = 1
+	exitInterrupted = 130 // as shells report a process terminated by SIGINT.
+)
+
 func main() {
-	ctx := context.Background()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	code := run(ctx)
+	stop()
+	os.Exit(code)
+}
+
+func run(ctx context.Context) int {
+	command, args := subcommand(os.Args[1:])
+
+	// commands print their output on stdout, so their logs go to stderr.
+	logOut := os.Stdout
+	if command != "" {
+		logOut = os.Stderr
+	}
 
 	loggerLevel := &slog.LevelVar{}
 	loggerLevel.Set(slog.LevelInfo)
-	slog.SetDefault(slog.New(slogHandler(loggerLevel)))
+	slog.SetDefault(slog.New(slogHandler(logOut, loggerLevel)))
 	logger := slog.Default()
 
-	// config
-	cnf, err := pkgen.NewConfig(ctx)
-	if err != nil {
-		logger.ErrorContext(ctx, "error while parsing config", errAttr(err))
-		os.Exit(1)
-	}
-
 	p := PKGen{
 		pk: pkgen.Packages{},
-		tm: pkgen.Templates{},
+		tm: pkgen.Templates{Logger: logger},
 		gn: pkgen.Generator{
 			FileWriter: nil,
 		},
 	}
 
+	if command != "" {
+		if err := p.Command(ctx, command, args); err != nil {
+			logger.ErrorContext(ctx, "error while running command", slog.String("command", command), errAttr(err))
+			return exitCode(ctx)
+		}
+		return exitOK
+	}
+
+	// config
+	cnf, err := pkgen.NewConfig(ctx)
+	if err != nil {
+		logger.ErrorContext(ctx, "error while parsing config", errAttr(err))
+		return exitError
+	}
+
 	if err := p.Run(ctx, cnf); err != nil {
-		os.Exit(1)
+		return exitCode(ctx)
+	}
+
+	return exitOK
+}
+
+// exitCode tells apart the failures caused by an interrupt. By then any written
+// file is already restored.
+func exitCode(ctx context.Context) int {
+	if ctx.Err() != nil {
+		slog.Default().ErrorContext(context.WithoutCancel(ctx), "interrupted")
+		return exitInterrupted
 	}
+
+	return exitError
 }
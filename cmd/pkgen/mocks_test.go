@@ -104,23 +104,23 @@ func (_c *MockTemplates_Get_Call) RunAndReturn(run func(name string) (*template.
 }
 
 // GetAll provides a mock function for the type MockTemplates
-func (_mock *MockTemplates) GetAll(c pkgen.TemplateConfigs) ([]*template.Template, error) {
+func (_mock *MockTemplates) GetAll(c pkgen.TemplateConfigs) ([]pkgen.Template, error) {
 	ret := _mock.Called(c)
 
 	if len(ret) == 0 {
 		panic("no return value specified for GetAll")
 	}
 
-	var r0 []*template.Template
+	var r0 []pkgen.Template
 	var r1 error
-	if returnFunc, ok := ret.Get(0).(func(pkgen.TemplateConfigs) ([]*template.Template, error)); ok {
+	if returnFunc, ok := ret.Get(0).(func(pkgen.TemplateConfigs) ([]pkgen.Template, error)); ok {
 		return returnFunc(c)
 	}
-	if returnFunc, ok := ret.Get(0).(func(pkgen.TemplateConfigs) []*template.Template); ok {
+	if returnFunc, ok := ret.Get(0).(func(pkgen.TemplateConfigs) []pkgen.Template); ok {
 		r0 = returnFunc(c)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).([]*template.Template)
+			r0 = ret.Get(0).([]pkgen.Template)
 		}
 	}
 	if returnFunc, ok := ret.Get(1).(func(pkgen.TemplateConfigs) error); ok {
@@ -155,12 +155,206 @@ func (_c *MockTemplates_GetAll_Call) Run(run func(c pkgen.TemplateConfigs)) *Moc
 	return _c
 }
 
-func (_c *MockTemplates_GetAll_Call) Return(templates []*template.Template, err error) *MockTemplates_GetAll_Call {
+func (_c *MockTemplates_GetAll_Call) Return(templates []pkgen.Template, err error) *MockTemplates_GetAll_Call {
 	_c.Call.Return(templates, err)
 	return _c
 }
 
-func (_c *MockTemplates_GetAll_Call) RunAndReturn(run func(c pkgen.TemplateConfigs) ([]*template.Template, error)) *MockTemplates_GetAll_Call {
+func (_c *MockTemplates_GetAll_Call) RunAndReturn(run func(c pkgen.TemplateConfigs) ([]pkgen.Template, error)) *MockTemplates_GetAll_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// Diff provides a mock function for the type MockTemplates
+func (_mock *MockTemplates) Diff(a string, b string) (string, error) {
+	ret := _mock.Called(a, b)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Diff")
+	}
+
+	var r0 string
+	var r1 error
+	if returnFunc, ok := ret.Get(0).(func(string, string) (string, error)); ok {
+		return returnFunc(a, b)
+	}
+	if returnFunc, ok := ret.Get(0).(func(string, string) string); ok {
+		r0 = returnFunc(a, b)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+	if returnFunc, ok := ret.Get(1).(func(string, string) error); ok {
+		r1 = returnFunc(a, b)
+	} else {
+		r1 = ret.Error(1)
+	}
+	return r0, r1
+}
+
+// MockTemplates_Diff_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Diff'
+type MockTemplates_Diff_Call struct {
+	*mock.Call
+}
+
+// Diff is a helper method to define mock.On call
+//   - a string
+//   - b string
+func (_e *MockTemplates_Expecter) Diff(a any, b any) *MockTemplates_Diff_Call {
+	return &MockTemplates_Diff_Call{Call: _e.mock.On("Diff", a, b)}
+}
+
+func (_c *MockTemplates_Diff_Call) Run(run func(a string, b string)) *MockTemplates_Diff_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		var arg0 string
+		if args[0] != nil {
+			arg0 = args[0].(string)
+		}
+		var arg1 string
+		if args[1] != nil {
+			arg1 = args[1].(string)
+		}
+		run(
+			arg0,
+			arg1,
+		)
+	})
+	return _c
+}
+
+func (_c *MockTemplates_Diff_Call) Return(string string, err error) *MockTemplates_Diff_Call {
+	_c.Call.Return(string, err)
+	return _c
+}
+
+func (_c *MockTemplates_Diff_Call) RunAndReturn(run func(a string, b string) (string, error)) *MockTemplates_Diff_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// List provides a mock function for the type MockTemplates
+func (_mock *MockTemplates) List(c pkgen.TemplateConfigs) ([]pkgen.Template, error) {
+	ret := _mock.Called(c)
+
+	if len(ret) == 0 {
+		panic("no return value specified for List")
+	}
+
+	var r0 []pkgen.Template
+	var r1 error
+	if returnFunc, ok := ret.Get(0).(func(pkgen.TemplateConfigs) ([]pkgen.Template, error)); ok {
+		return returnFunc(c)
+	}
+	if returnFunc, ok := ret.Get(0).(func(pkgen.TemplateConfigs) []pkgen.Template); ok {
+		r0 = returnFunc(c)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]pkgen.Template)
+		}
+	}
+	if returnFunc, ok := ret.Get(1).(func(pkgen.TemplateConfigs) error); ok {
+		r1 = returnFunc(c)
+	} else {
+		r1 = ret.Error(1)
+	}
+	return r0, r1
+}
+
+// MockTemplates_List_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'List'
+type MockTemplates_List_Call struct {
+	*mock.Call
+}
+
+// List is a helper method to define mock.On call
+//   - c pkgen.TemplateConfigs
+func (_e *MockTemplates_Expecter) List(c any) *MockTemplates_List_Call {
+	return &MockTemplates_List_Call{Call: _e.mock.On("List", c)}
+}
+
+func (_c *MockTemplates_List_Call) Run(run func(c pkgen.TemplateConfigs)) *MockTemplates_List_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		var arg0 pkgen.TemplateConfigs
+		if args[0] != nil {
+			arg0 = args[0].(pkgen.TemplateConfigs)
+		}
+		run(
+			arg0,
+		)
+	})
+	return _c
+}
+
+func (_c *MockTemplates_List_Call) Return(templates []pkgen.Template, err error) *MockTemplates_List_Call {
+	_c.Call.Return(templates, err)
+	return _c
+}
+
+func (_c *MockTemplates_List_Call) RunAndReturn(run func(c pkgen.TemplateConfigs) ([]pkgen.Template, error)) *MockTemplates_List_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// Find provides a mock function for the type MockTemplates
+func (_mock *MockTemplates) Find(name string, c pkgen.TemplateConfigs) (pkgen.Template, error) {
+	ret := _mock.Called(name, c)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Find")
+	}
+
+	var r0 pkgen.Template
+	var r1 error
+	if returnFunc, ok := ret.Get(0).(func(string, pkgen.TemplateConfigs) (pkgen.Template, error)); ok {
+		return returnFunc(name, c)
+	}
+	if returnFunc, ok := ret.Get(0).(func(string, pkgen.TemplateConfigs) pkgen.Template); ok {
+		r0 = returnFunc(name, c)
+	} else {
+		r0 = ret.Get(0).(pkgen.Template)
+	}
+	if returnFunc, ok := ret.Get(1).(func(string, pkgen.TemplateConfigs) error); ok {
+		r1 = returnFunc(name, c)
+	} else {
+		r1 = ret.Error(1)
+	}
+	return r0, r1
+}
+
+// MockTemplates_Find_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Find'
+type MockTemplates_Find_Call struct {
+	*mock.Call
+}
+
+// Find is a helper method to define mock.On call
+//   - name string
+//   - c pkgen.TemplateConfigs
+func (_e *MockTemplates_Expecter) Find(name any, c any) *MockTemplates_Find_Call {
+	return &MockTemplates_Find_Call{Call: _e.mock.On("Find", name, c)}
+}
+
+func (_c *MockTemplates_Find_Call) Run(run func(name string, c pkgen.TemplateConfigs)) *MockTemplates_Find_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		var arg0 string
+		if args[0] != nil {
+			arg0 = args[0].(string)
+		}
+		var arg1 pkgen.TemplateConfigs
+		if args[1] != nil {
+			arg1 = args[1].(pkgen.TemplateConfigs)
+		}
+		run(
+			arg0,
+			arg1,
+		)
+	})
+	return _c
+}
+
+func (_c *MockTemplates_Find_Call) Return(template1 pkgen.Template, err error) *MockTemplates_Find_Call {
+	_c.Call.Return(template1, err)
+	return _c
+}
+
+func (_c *MockTemplates_Find_Call) RunAndReturn(run func(name string, c pkgen.TemplateConfigs) (pkgen.Template, error)) *MockTemplates_Find_Call {
 	_c.Call.Return(run)
 	return _c
 }
@@ -288,7 +482,7 @@ func (_m *MockGenerator) EXPECT() *MockGenerator_Expecter {
 }
 
 // Generate provides a mock function for the type MockGenerator
-func (_mock *MockGenerator) Generate(ctx context.Context, logger *slog.Logger, pkgs []packages.Package, tmps []*template.Template, cnf pkgen.GenerateConfig) error {
+func (_mock *MockGenerator) Generate(ctx context.Context, logger *slog.Logger, pkgs []packages.Package, tmps []pkgen.Template, cnf pkgen.GenerateConfig) error {
 	ret := _mock.Called(ctx, logger, pkgs, tmps, cnf)
 
 	if len(ret) == 0 {
@@ -296,7 +490,7 @@ func (_mock *MockGenerator) Generate(ctx context.Context, logger *slog.Logger, p
 	}
 
 	var r0 error
-	if returnFunc, ok := ret.Get(0).(func(context.Context, *slog.Logger, []packages.Package, []*template.Template, pkgen.GenerateConfig) error); ok {
+	if returnFunc, ok := ret.Get(0).(func(context.Context, *slog.Logger, []packages.Package, []pkgen.Template, pkgen.GenerateConfig) error); ok {
 		r0 = returnFunc(ctx, logger, pkgs, tmps, cnf)
 	} else {
 		r0 = ret.Error(0)
@@ -313,13 +507,13 @@ type MockGenerator_Generate_Call struct {
 //   - ctx context.Context
 //   - logger *slog.Logger
 //   - pkgs []packages.Package
-//   - tmps []*template.Template
+//   - tmps []pkgen.Template
 //   - cnf pkgen.GenerateConfig
 func (_e *MockGenerator_Expecter) Generate(ctx any, logger any, pkgs any, tmps any, cnf any) *MockGenerator_Generate_Call {
 	return &MockGenerator_Generate_Call{Call: _e.mock.On("Generate", ctx, logger, pkgs, tmps, cnf)}
 }
 
-func (_c *MockGenerator_Generate_Call) Run(run func(ctx context.Context, logger *slog.Logger, pkgs []packages.Package, tmps []*template.Template, cnf pkgen.GenerateConfig)) *MockGenerator_Generate_Call {
+func (_c *MockGenerator_Generate_Call) Run(run func(ctx context.Context, logger *slog.Logger, pkgs []packages.Package, tmps []pkgen.Template, cnf pkgen.GenerateConfig)) *MockGenerator_Generate_Call {
 	_c.Call.Run(func(args mock.Arguments) {
 		var arg0 context.Context
 		if args[0] != nil {
@@ -333,9 +527,9 @@ func (_c *MockGenerator_Generate_Call) Run(run func(ctx context.Context, logger
 		if args[2] != nil {
 			arg2 = args[2].([]packages.Package)
 		}
-		var arg3 []*template.Template
+		var arg3 []pkgen.Template
 		if args[3] != nil {
-			arg3 = args[3].([]*template.Template)
+			arg3 = args[3].([]pkgen.Template)
 		}
 		var arg4 pkgen.GenerateConfig
 		if args[4] != nil {
@@ -357,7 +551,382 @@ func (_c *MockGenerator_Generate_Call) Return(err error) *MockGenerator_Generate
 	return _c
 }
 
-func (_c *MockGenerator_Generate_Call) RunAndReturn(run func(ctx context.Context, logger *slog.Logger, pkgs []packages.Package, tmps []*template.Template, cnf pkgen.GenerateConfig) error) *MockGenerator_Generate_Call {
+func (_c *MockGenerator_Generate_Call) RunAndReturn(run func(ctx context.Context, logger *slog.Logger, pkgs []packages.Package, tmps []pkgen.Template, cnf pkgen.GenerateConfig) error) *MockGenerator_Generate_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// Render provides a mock function for the type MockGenerator
+func (_mock *MockGenerator) Render(ctx context.Context, logger *slog.Logger, pkgs []packages.Package, tmps []pkgen.Template, cnf pkgen.GenerateConfig) ([]pkgen.File, error) {
+	ret := _mock.Called(ctx, logger, pkgs, tmps, cnf)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Render")
+	}
+
+	var r0 []pkgen.File
+	var r1 error
+	if returnFunc, ok := ret.Get(0).(func(context.Context, *slog.Logger, []packages.Package, []pkgen.Template, pkgen.GenerateConfig) ([]pkgen.File, error)); ok {
+		return returnFunc(ctx, logger, pkgs, tmps, cnf)
+	}
+	if returnFunc, ok := ret.Get(0).(func(context.Context, *slog.Logger, []packages.Package, []pkgen.Template, pkgen.GenerateConfig) []pkgen.File); ok {
+		r0 = returnFunc(ctx, logger, pkgs, tmps, cnf)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]pkgen.File)
+		}
+	}
+	if returnFunc, ok := ret.Get(1).(func(context.Context, *slog.Logger, []packages.Package, []pkgen.Template, pkgen.GenerateConfig) error); ok {
+		r1 = returnFunc(ctx, logger, pkgs, tmps, cnf)
+	} else {
+		r1 = ret.Error(1)
+	}
+	return r0, r1
+}
+
+// MockGenerator_Render_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Render'
+type MockGenerator_Render_Call struct {
+	*mock.Call
+}
+
+// Render is a helper method to define mock.On call
+//   - ctx context.Context
+//   - logger *slog.Logger
+//   - pkgs []packages.Package
+//   - tmps []pkgen.Template
+//   - cnf pkgen.GenerateConfig
+func (_e *MockGenerator_Expecter) Render(ctx any, logger any, pkgs any, tmps any, cnf any) *MockGenerator_Render_Call {
+	return &MockGenerator_Render_Call{Call: _e.mock.On("Render", ctx, logger, pkgs, tmps, cnf)}
+}
+
+func (_c *MockGenerator_Render_Call) Run(run func(ctx context.Context, logger *slog.Logger, pkgs []packages.Package, tmps []pkgen.Template, cnf pkgen.GenerateConfig)) *MockGenerator_Render_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		var arg0 context.Context
+		if args[0] != nil {
+			arg0 = args[0].(context.Context)
+		}
+		var arg1 *slog.Logger
+		if args[1] != nil {
+			arg1 = args[1].(*slog.Logger)
+		}
+		var arg2 []packages.Package
+		if args[2] != nil {
+			arg2 = args[2].([]packages.Package)
+		}
+		var arg3 []pkgen.Template
+		if args[3] != nil {
+			arg3 = args[3].([]pkgen.Template)
+		}
+		var arg4 pkgen.GenerateConfig
+		if args[4] != nil {
+			arg4 = args[4].(pkgen.GenerateConfig)
+		}
+		run(
+			arg0,
+			arg1,
+			arg2,
+			arg3,
+			arg4,
+		)
+	})
+	return _c
+}
+
+func (_c *MockGenerator_Render_Call) Return(files []pkgen.File, err error) *MockGenerator_Render_Call {
+	_c.Call.Return(files, err)
+	return _c
+}
+
+func (_c *MockGenerator_Render_Call) RunAndReturn(run func(ctx context.Context, logger *slog.Logger, pkgs []packages.Package, tmps []pkgen.Template, cnf pkgen.GenerateConfig) ([]pkgen.File, error)) *MockGenerator_Render_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// Plan provides a mock function for the type MockGenerator
+func (_mock *MockGenerator) Plan(files []pkgen.File, withContent bool) (pkgen.Plan, error) {
+	ret := _mock.Called(files, withContent)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Plan")
+	}
+
+	var r0 pkgen.Plan
+	var r1 error
+	if returnFunc, ok := ret.Get(0).(func([]pkgen.File, bool) (pkgen.Plan, error)); ok {
+		return returnFunc(files, withContent)
+	}
+	if returnFunc, ok := ret.Get(0).(func([]pkgen.File, bool) pkgen.Plan); ok {
+		r0 = returnFunc(files, withContent)
+	} else {
+		r0 = ret.Get(0).(pkgen.Plan)
+	}
+	if returnFunc, ok := ret.Get(1).(func([]pkgen.File, bool) error); ok {
+		r1 = returnFunc(files, withContent)
+	} else {
+		r1 = ret.Error(1)
+	}
+	return r0, r1
+}
+
+// MockGenerator_Plan_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Plan'
+type MockGenerator_Plan_Call struct {
+	*mock.Call
+}
+
+// Plan is a helper method to define mock.On call
+//   - files []pkgen.File
+//   - withContent bool
+func (_e *MockGenerator_Expecter) Plan(files any, withContent any) *MockGenerator_Plan_Call {
+	return &MockGenerator_Plan_Call{Call: _e.mock.On("Plan", files, withContent)}
+}
+
+func (_c *MockGenerator_Plan_Call) Run(run func(files []pkgen.File, withContent bool)) *MockGenerator_Plan_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		var arg0 []pkgen.File
+		if args[0] != nil {
+			arg0 = args[0].([]pkgen.File)
+		}
+		var arg1 bool
+		if args[1] != nil {
+			arg1 = args[1].(bool)
+		}
+		run(
+			arg0,
+			arg1,
+		)
+	})
+	return _c
+}
+
+func (_c *MockGenerator_Plan_Call) Return(plan pkgen.Plan, err error) *MockGenerator_Plan_Call {
+	_c.Call.Return(plan, err)
+	return _c
+}
+
+func (_c *MockGenerator_Plan_Call) RunAndReturn(run func(files []pkgen.File, withContent bool) (pkgen.Plan, error)) *MockGenerator_Plan_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// Apply provides a mock function for the type MockGenerator
+func (_mock *MockGenerator) Apply(ctx context.Context, logger *slog.Logger, plan pkgen.Plan, files []pkgen.File, cnf pkgen.GenerateConfig) error {
+	ret := _mock.Called(ctx, logger, plan, files, cnf)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Apply")
+	}
+
+	var r0 error
+	if returnFunc, ok := ret.Get(0).(func(context.Context, *slog.Logger, pkgen.Plan, []pkgen.File, pkgen.GenerateConfig) error); ok {
+		r0 = returnFunc(ctx, logger, plan, files, cnf)
+	} else {
+		r0 = ret.Error(0)
+	}
+	return r0
+}
+
+// MockGenerator_Apply_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Apply'
+type MockGenerator_Apply_Call struct {
+	*mock.Call
+}
+
+// Apply is a helper method to define mock.On call
+//   - ctx context.Context
+//   - logger *slog.Logger
+//   - plan pkgen.Plan
+//   - files []pkgen.File
+//   - cnf pkgen.GenerateConfig
+func (_e *MockGenerator_Expecter) Apply(ctx any, logger any, plan any, files any, cnf any) *MockGenerator_Apply_Call {
+	return &MockGenerator_Apply_Call{Call: _e.mock.On("Apply", ctx, logger, plan, files, cnf)}
+}
+
+func (_c *MockGenerator_Apply_Call) Run(run func(ctx context.Context, logger *slog.Logger, plan pkgen.Plan, files []pkgen.File, cnf pkgen.GenerateConfig)) *MockGenerator_Apply_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		var arg0 context.Context
+		if args[0] != nil {
+			arg0 = args[0].(context.Context)
+		}
+		var arg1 *slog.Logger
+		if args[1] != nil {
+			arg1 = args[1].(*slog.Logger)
+		}
+		var arg2 pkgen.Plan
+		if args[2] != nil {
+			arg2 = args[2].(pkgen.Plan)
+		}
+		var arg3 []pkgen.File
+		if args[3] != nil {
+			arg3 = args[3].([]pkgen.File)
+		}
+		var arg4 pkgen.GenerateConfig
+		if args[4] != nil {
+			arg4 = args[4].(pkgen.GenerateConfig)
+		}
+		run(
+			arg0,
+			arg1,
+			arg2,
+			arg3,
+			arg4,
+		)
+	})
+	return _c
+}
+
+func (_c *MockGenerator_Apply_Call) Return(err error) *MockGenerator_Apply_Call {
+	_c.Call.Return(err)
+	return _c
+}
+
+func (_c *MockGenerator_Apply_Call) RunAndReturn(run func(ctx context.Context, logger *slog.Logger, plan pkgen.Plan, files []pkgen.File, cnf pkgen.GenerateConfig) error) *MockGenerator_Apply_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// Status provides a mock function for the type MockGenerator
+func (_mock *MockGenerator) Status(files []pkgen.File, cnf pkgen.GenerateConfig) ([]pkgen.OutputStatus, error) {
+	ret := _mock.Called(files, cnf)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Status")
+	}
+
+	var r0 []pkgen.OutputStatus
+	var r1 error
+	if returnFunc, ok := ret.Get(0).(func([]pkgen.File, pkgen.GenerateConfig) ([]pkgen.OutputStatus, error)); ok {
+		return returnFunc(files, cnf)
+	}
+	if returnFunc, ok := ret.Get(0).(func([]pkgen.File, pkgen.GenerateConfig) []pkgen.OutputStatus); ok {
+		r0 = returnFunc(files, cnf)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]pkgen.OutputStatus)
+		}
+	}
+	if returnFunc, ok := ret.Get(1).(func([]pkgen.File, pkgen.GenerateConfig) error); ok {
+		r1 = returnFunc(files, cnf)
+	} else {
+		r1 = ret.Error(1)
+	}
+	return r0, r1
+}
+
+// MockGenerator_Status_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Status'
+type MockGenerator_Status_Call struct {
+	*mock.Call
+}
+
+// Status is a helper method to define mock.On call
+//   - files []pkgen.File
+//   - cnf pkgen.GenerateConfig
+func (_e *MockGenerator_Expecter) Status(files any, cnf any) *MockGenerator_Status_Call {
+	return &MockGenerator_Status_Call{Call: _e.mock.On("Status", files, cnf)}
+}
+
+func (_c *MockGenerator_Status_Call) Run(run func(files []pkgen.File, cnf pkgen.GenerateConfig)) *MockGenerator_Status_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		var arg0 []pkgen.File
+		if args[0] != nil {
+			arg0 = args[0].([]pkgen.File)
+		}
+		var arg1 pkgen.GenerateConfig
+		if args[1] != nil {
+			arg1 = args[1].(pkgen.GenerateConfig)
+		}
+		run(
+			arg0,
+			arg1,
+		)
+	})
+	return _c
+}
+
+func (_c *MockGenerator_Status_Call) Return(outputStatuss []pkgen.OutputStatus, err error) *MockGenerator_Status_Call {
+	_c.Call.Return(outputStatuss, err)
+	return _c
+}
+
+func (_c *MockGenerator_Status_Call) RunAndReturn(run func(files []pkgen.File, cnf pkgen.GenerateConfig) ([]pkgen.OutputStatus, error)) *MockGenerator_Status_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// Data provides a mock function for the type MockGenerator
+func (_mock *MockGenerator) Data(ctx context.Context, pkgs []packages.Package, tmps []pkgen.Template, cnf pkgen.GenerateConfig) ([]pkgen.TemplateData, error) {
+	ret := _mock.Called(ctx, pkgs, tmps, cnf)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Data")
+	}
+
+	var r0 []pkgen.TemplateData
+	var r1 error
+	if returnFunc, ok := ret.Get(0).(func(context.Context, []packages.Package, []pkgen.Template, pkgen.GenerateConfig) ([]pkgen.TemplateData, error)); ok {
+		return returnFunc(ctx, pkgs, tmps, cnf)
+	}
+	if returnFunc, ok := ret.Get(0).(func(context.Context, []packages.Package, []pkgen.Template, pkgen.GenerateConfig) []pkgen.TemplateData); ok {
+		r0 = returnFunc(ctx, pkgs, tmps, cnf)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]pkgen.TemplateData)
+		}
+	}
+	if returnFunc, ok := ret.Get(1).(func(context.Context, []packages.Package, []pkgen.Template, pkgen.GenerateConfig) error); ok {
+		r1 = returnFunc(ctx, pkgs, tmps, cnf)
+	} else {
+		r1 = ret.Error(1)
+	}
+	return r0, r1
+}
+
+// MockGenerator_Data_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Data'
+type MockGenerator_Data_Call struct {
+	*mock.Call
+}
+
+// Data is a helper method to define mock.On call
+//   - ctx context.Context
+//   - pkgs []packages.Package
+//   - tmps []pkgen.Template
+//   - cnf pkgen.GenerateConfig
+func (_e *MockGenerator_Expecter) Data(ctx any, pkgs any, tmps any, cnf any) *MockGenerator_Data_Call {
+	return &MockGenerator_Data_Call{Call: _e.mock.On("Data", ctx, pkgs, tmps, cnf)}
+}
+
+func (_c *MockGenerator_Data_Call) Run(run func(ctx context.Context, pkgs []packages.Package, tmps []pkgen.Template, cnf pkgen.GenerateConfig)) *MockGenerator_Data_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		var arg0 context.Context
+		if args[0] != nil {
+			arg0 = args[0].(context.Context)
+		}
+		var arg1 []packages.Package
+		if args[1] != nil {
+			arg1 = args[1].([]packages.Package)
+		}
+		var arg2 []pkgen.Template
+		if args[2] != nil {
+			arg2 = args[2].([]pkgen.Template)
+		}
+		var arg3 pkgen.GenerateConfig
+		if args[3] != nil {
+			arg3 = args[3].(pkgen.GenerateConfig)
+		}
+		run(
+			arg0,
+			arg1,
+			arg2,
+			arg3,
+		)
+	})
+	return _c
+}
+
+func (_c *MockGenerator_Data_Call) Return(templateDatas []pkgen.TemplateData, err error) *MockGenerator_Data_Call {
+	_c.Call.Return(templateDatas, err)
+	return _c
+}
+
+func (_c *MockGenerator_Data_Call) RunAndReturn(run func(ctx context.Context, pkgs []packages.Package, tmps []pkgen.Template, cnf pkgen.GenerateConfig) ([]pkgen.TemplateData, error)) *MockGenerator_Data_Call {
 	_c.Call.Return(run)
 	return _c
 }
@@ -18,7 +18,10 @@ type PKGen struct {
 
 type Templates interface {
 	Get(name string) (*template.Template, error)
-	GetAll(c pkgen.TemplateConfigs) ([]*template.Template, error)
+	GetAll(c pkgen.TemplateConfigs) ([]pkgen.Template, error)
+	Diff(a, b string) (string, error)
+	List(c pkgen.TemplateConfigs) ([]pkgen.Template, error)
+	Find(name string, c pkgen.TemplateConfigs) (pkgen.Template, error)
 }
 
 type Packages interface {
@@ -26,7 +29,12 @@ type Packages interface {
 }
 
 type Generator interface {
-	Generate(ctx context.Context, logger *slog.Logger, pkgs []packages.Package, tmps []*template.Template, cnf pkgen.GenerateConfig) error
+	Generate(ctx context.Context, logger *slog.Logger, pkgs []packages.Package, tmps []pkgen.Template, cnf pkgen.GenerateConfig) error
+	Render(ctx context.Context, logger *slog.Logger, pkgs []packages.Package, tmps []pkgen.Template, cnf pkgen.GenerateConfig) ([]pkgen.File, error)
+	Plan(files []pkgen.File, withContent bool) (pkgen.Plan, error)
+	Apply(ctx context.Context, logger *slog.Logger, plan pkgen.Plan, files []pkgen.File, cnf pkgen.GenerateConfig) error
+	Status(files []pkgen.File, cnf pkgen.GenerateConfig) ([]pkgen.OutputStatus, error)
+	Data(ctx context.Context, pkgs []packages.Package, tmps []pkgen.Template, cnf pkgen.GenerateConfig) ([]pkgen.TemplateData, error)
 }
 
 func (p *PKGen) Run(ctx context.Context, cnf pkgen.Config) error {
@@ -50,7 +58,7 @@ func (p *PKGen) Run(ctx context.Context, cnf pkgen.Config) error {
 	}
 
 	// generate file
-	err = p.gn.Generate(ctx, logger, packages, tmps, cnf.Generate)
+	err = p.gn.Generate(ctx, logger, packages, tmps, cnf.GenerateConfig())
 	if err != nil {
 		logger.ErrorContext(ctx, "error while generating files", errAttr(err))
 		return err
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/ifnotnil/pkgen"
+)
+
+const planUsage = `pkgen plan [--content] [--out plan.json] [config flags]`
+
+// Plan writes the json plan of the actions a generation would perform.
+func (p *PKGen) Plan(ctx context.Context, w io.Writer, args []string) error {
+	withContent := false
+	out := ""
+
+	cnf, _, err := commandConfig(ctx, "plan", args, func(fs *flag.FlagSet) {
+		fs.BoolVar(&withContent, "content", false, "include the rendered content in the plan")
+		fs.StringVar(&out, "out", "", "write the plan to this file instead of the stdout")
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrUsage, planUsage, err)
+	}
+
+	files, err := p.render(ctx, cnf)
+	if err != nil {
+		return err
+	}
+
+	plan, err := p.gn.Plan(files, withContent)
+	if err != nil {
+		return err
+	}
+
+	summary := plan.Summary()
+	for _, kind := range slices.Sorted(maps.Keys(summary)) {
+		slog.Default().InfoContext(ctx, "plan", slog.String("action", string(kind)), slog.Int("files", summary[kind]))
+	}
+
+	if out == "" {
+		return writeJSON(w, plan)
+	}
+
+	f, err := os.Create(filepath.Clean(out))
+	if err != nil {
+		return err
+	}
+
+	if err := writeJSON(f, plan); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+const applyUsage = `pkgen apply [config flags] <plan.json>`
+
+// Apply executes a plan made by the plan command.
+func (p *PKGen) Apply(ctx context.Context, args []string) error {
+	cnf, rest, err := commandConfig(ctx, "apply", args, func(*flag.FlagSet) {})
+	if err != nil || len(rest) != 1 {
+		return fmt.Errorf("%w: %s", ErrUsage, applyUsage)
+	}
+
+	b, err := os.ReadFile(filepath.Clean(rest[0]))
+	if err != nil {
+		return err
+	}
+
+	plan := pkgen.Plan{}
+	if err := json.Unmarshal(b, &plan); err != nil {
+		return fmt.Errorf("%w: %w", pkgen.ErrPlanMalformed, err)
+	}
+
+	// a plan without content is rendered again, and must still match.
+	var files []pkgen.File
+	if !plan.HasContent() {
+		files, err = p.render(ctx, cnf)
+		if err != nil {
+			return err
+		}
+	}
+
+	return p.gn.Apply(ctx, slog.Default(), plan, files, cnf.GenerateConfig())
+}
+
+func (p *PKGen) render(ctx context.Context, cnf pkgen.Config) ([]pkgen.File, error) {
+	logger := slog.Default()
+
+	pkgs, err := p.pk.Query(ctx, cnf.PackagesQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	tmps, err := p.tm.GetAll(cnf.Templates)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.gn.Render(ctx, logger, pkgs, tmps, cnf.GenerateConfig())
+}
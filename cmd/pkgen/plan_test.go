@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ifnotnil/pkgen"
+	"github.com/ifnotnil/x/tst"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/tools/go/packages"
+)
+
+func testPKGen(t *testing.T) (*PKGen, *MockPackages, *MockTemplates, *MockGenerator) {
+	t.Helper()
+
+	pk := NewMockPackages(t)
+	tm := NewMockTemplates(t)
+	gn := NewMockGenerator(t)
+
+	return &PKGen{pk: pk, tm: tm, gn: gn}, pk, tm, gn
+}
+
+func testFile(path, content string) pkgen.File {
+	return pkgen.File{Path: path, Content: []byte(content), Mode: 0o644, DirMode: 0, Package: "example.com/a", Template: "t", Origin: "", TemplateVersion: "", ParamsHash: "", Delete: false, Sources: nil, Region: ""}
+}
+
+func testAction(kind pkgen.PlanActionKind, path string, content *string) pkgen.PlanAction {
+	return pkgen.PlanAction{Action: kind, Path: path, Package: "example.com/a", Template: "t", Mode: 0o644, DirMode: 0, OldHash: "", NewHash: "sha256:new", Content: content}
+}
+
+// expectRender sets the expectations of a render of files.
+func expectRender(pk *MockPackages, tm *MockTemplates, gn *MockGenerator, files []pkgen.File) {
+	pkgs := []packages.Package{{Name: "a", PkgPath: "example.com/a", Dir: "/tmp/a"}}
+	tmps := []pkgen.Template{{Name: "t", Version: "", Source: pkgen.SourceFile, Path: "t.tmpl", Text: nil, Plugin: "", FrontMatter: pkgen.FrontMatter{}, Params: nil, Output: pkgen.OutputConfig{}}}
+
+	pk.EXPECT().Query(mock.Anything, mock.Anything).Return(pkgs, nil)
+	tm.EXPECT().GetAll(mock.Anything).Return(tmps, nil)
+	gn.EXPECT().Render(mock.Anything, mock.Anything, pkgs, tmps, mock.Anything).Return(files, nil)
+}
+
+func TestPlan(t *testing.T) {
+	files := []pkgen.File{testFile("/tmp/a/zz_generated.t.go", "package a\n")}
+	plan := pkgen.Plan{
+		Version: pkgen.PlanFormatVersion,
+		Actions: []pkgen.PlanAction{
+			testAction(pkgen.ActionModify, "/tmp/a/zz_generated.t.go", nil),
+			testAction(pkgen.ActionCreate, "/tmp/a/zz_generated.u.go", nil),
+		},
+	}
+
+	t.Run("stdout", func(t *testing.T) {
+		p, pk, tm, gn := testPKGen(t)
+		expectRender(pk, tm, gn, files)
+		gn.EXPECT().Plan(files, true).Return(plan, nil)
+
+		w := &bytes.Buffer{}
+		require.NoError(t, p.Plan(t.Context(), w, []string{"--content"}))
+
+		got := pkgen.Plan{}
+		require.NoError(t, json.Unmarshal(w.Bytes(), &got))
+		require.Equal(t, plan, got)
+	})
+
+	t.Run("out file", func(t *testing.T) {
+		p, pk, tm, gn := testPKGen(t)
+		expectRender(pk, tm, gn, files)
+		gn.EXPECT().Plan(files, false).Return(plan, nil)
+
+		out := filepath.Join(t.TempDir(), "plan.json")
+		w := &bytes.Buffer{}
+		require.NoError(t, p.Plan(t.Context(), w, []string{"--out", out}))
+		require.Empty(t, w.Bytes())
+
+		b, err := os.ReadFile(out)
+		require.NoError(t, err)
+		got := pkgen.Plan{}
+		require.NoError(t, json.Unmarshal(b, &got))
+		require.Equal(t, plan, got)
+	})
+
+	t.Run("out file error", func(t *testing.T) {
+		p, pk, tm, gn := testPKGen(t)
+		expectRender(pk, tm, gn, files)
+		gn.EXPECT().Plan(files, false).Return(plan, nil)
+
+		out := filepath.Join(t.TempDir(), "missing", "plan.json")
+		err := p.Plan(t.Context(), &bytes.Buffer{}, []string{"--out", out})
+		require.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("bad flag", func(t *testing.T) {
+		p, _, _, _ := testPKGen(t)
+		err := p.Plan(t.Context(), &bytes.Buffer{}, []string{"--unknown"})
+		require.ErrorIs(t, err, ErrUsage)
+	})
+}
+
+func TestApply(t *testing.T) {
+	content := "package a\n"
+	files := []pkgen.File{testFile("/tmp/a/zz_generated.t.go", content)}
+
+	tests := map[string]struct {
+		plan          pkgen.Plan
+		args          func(path string) []string
+		expectations  func(pk *MockPackages, tm *MockTemplates, gn *MockGenerator, plan pkgen.Plan)
+		errorAsserter tst.ErrorAssertionFunc
+	}{
+		"with content": {
+			plan: pkgen.Plan{Version: pkgen.PlanFormatVersion, Actions: []pkgen.PlanAction{
+				testAction(pkgen.ActionCreate, "/tmp/a/zz_generated.t.go", &content),
+			}},
+			args: func(path string) []string { return []string{path} },
+			expectations: func(_ *MockPackages, _ *MockTemplates, gn *MockGenerator, plan pkgen.Plan) {
+				gn.EXPECT().Apply(mock.Anything, mock.Anything, plan, []pkgen.File(nil), mock.Anything).Return(nil)
+			},
+			errorAsserter: tst.NoError(),
+		},
+		"rendered again": {
+			plan: pkgen.Plan{Version: pkgen.PlanFormatVersion, Actions: []pkgen.PlanAction{
+				testAction(pkgen.ActionCreate, "/tmp/a/zz_generated.t.go", nil),
+			}},
+			args: func(path string) []string { return []string{path} },
+			expectations: func(pk *MockPackages, tm *MockTemplates, gn *MockGenerator, plan pkgen.Plan) {
+				expectRender(pk, tm, gn, files)
+				gn.EXPECT().Apply(mock.Anything, mock.Anything, plan, files, mock.Anything).Return(pkgen.ErrPlanStale)
+			},
+			errorAsserter: tst.ErrorIs(pkgen.ErrPlanStale),
+		},
+		"no plan": {
+			plan:          pkgen.Plan{Version: pkgen.PlanFormatVersion, Actions: nil},
+			args:          func(string) []string { return nil },
+			expectations:  func(*MockPackages, *MockTemplates, *MockGenerator, pkgen.Plan) {},
+			errorAsserter: tst.ErrorIs(ErrUsage),
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			p, pk, tm, gn := testPKGen(t)
+			tc.expectations(pk, tm, gn, tc.plan)
+
+			b, err := json.Marshal(tc.plan)
+			require.NoError(t, err)
+			path := filepath.Join(t.TempDir(), "plan.json")
+			require.NoError(t, os.WriteFile(path, b, 0o600))
+
+			tc.errorAsserter(t, p.Apply(t.Context(), tc.args(path)))
+		})
+	}
+
+	t.Run("malformed", func(t *testing.T) {
+		p, _, _, _ := testPKGen(t)
+		path := filepath.Join(t.TempDir(), "plan.json")
+		require.NoError(t, os.WriteFile(path, []byte("{"), 0o600))
+
+		require.ErrorIs(t, p.Apply(t.Context(), []string{path}), pkgen.ErrPlanMalformed)
+	})
+}
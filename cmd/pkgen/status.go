@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/ifnotnil/pkgen"
+	"github.com/samber/lo"
+)
+
+var ErrOutdated = errors.New("generated files are not up to date")
+
+const statusUsage = `pkgen status [--all] [--json] [config flags]`
+
+// Status lists the outputs that are missing, stale or modified by hand. It
+// fails when there is any, so that it can guard a CI.
+func (p *PKGen) Status(ctx context.Context, w io.Writer, args []string) error {
+	jsonOutput := false
+	all := false
+
+	cnf, _, err := commandConfig(ctx, "status", args, func(fs *flag.FlagSet) {
+		jsonFlag(&jsonOutput)(fs)
+		fs.BoolVar(&all, "all", false, "list the up to date outputs too")
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrUsage, statusUsage, err)
+	}
+
+	files, err := p.render(ctx, cnf)
+	if err != nil {
+		return err
+	}
+
+	statuses, err := p.gn.Status(files, cnf.GenerateConfig())
+	if err != nil {
+		return err
+	}
+
+	outdated := lo.CountBy(statuses, func(s pkgen.OutputStatus) bool { return s.State != pkgen.StateOK })
+	if !all {
+		statuses = lo.Filter(statuses, func(s pkgen.OutputStatus, _ int) bool { return s.State != pkgen.StateOK })
+	}
+
+	if jsonOutput {
+		err = writeJSON(w, statuses)
+	} else {
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "STATE\tPATH\tTEMPLATE")
+		for _, s := range statuses {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", s.State, s.Path, s.Template)
+		}
+		err = tw.Flush()
+	}
+	if err != nil {
+		return err
+	}
+
+	if outdated > 0 {
+		return fmt.Errorf("%w: %d files", ErrOutdated, outdated)
+	}
+
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/ifnotnil/pkgen"
+	"github.com/ifnotnil/x/tst"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatus(t *testing.T) {
+	files := []pkgen.File{testFile("/tmp/a/zz_generated.t.go", "package a\n"), testFile("/tmp/a/zz_generated.u.go", "package a\n")}
+
+	tests := map[string]struct {
+		statuses      []pkgen.OutputStatus
+		args          []string
+		expected      string
+		errorAsserter tst.ErrorAssertionFunc
+	}{
+		"up to date": {
+			statuses: []pkgen.OutputStatus{
+				{State: pkgen.StateOK, Path: "/tmp/a/zz_generated.t.go", Package: "example.com/a", Template: "t"},
+			},
+			args:          nil,
+			expected:      "STATE  PATH  TEMPLATE\n",
+			errorAsserter: tst.NoError(),
+		},
+		"all": {
+			statuses: []pkgen.OutputStatus{
+				{State: pkgen.StateOK, Path: "/tmp/a/zz_generated.t.go", Package: "example.com/a", Template: "t"},
+			},
+			args:          []string{"--all"},
+			expected:      "STATE  PATH                      TEMPLATE\nok     /tmp/a/zz_generated.t.go  t\n",
+			errorAsserter: tst.NoError(),
+		},
+		"outdated": {
+			statuses: []pkgen.OutputStatus{
+				{State: pkgen.StateOK, Path: "/tmp/a/zz_generated.t.go", Package: "example.com/a", Template: "t"},
+				{State: pkgen.StateModified, Path: "/tmp/a/zz_generated.u.go", Package: "example.com/a", Template: "u"},
+			},
+			args:          nil,
+			expected:      "STATE     PATH                      TEMPLATE\nmodified  /tmp/a/zz_generated.u.go  u\n",
+			errorAsserter: tst.ErrorIs(ErrOutdated),
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			p, pk, tm, gn := testPKGen(t)
+			expectRender(pk, tm, gn, files)
+			gn.EXPECT().Status(files, mock.Anything).Return(tc.statuses, nil)
+
+			w := bytes.Buffer{}
+			tc.errorAsserter(t, p.Status(t.Context(), &w, tc.args))
+			require.Equal(t, tc.expected, w.String())
+		})
+	}
+
+	t.Run("json", func(t *testing.T) {
+		statuses := []pkgen.OutputStatus{
+			{State: pkgen.StateMissing, Path: "/tmp/a/zz_generated.t.go", Package: "example.com/a", Template: "t"},
+		}
+
+		p, pk, tm, gn := testPKGen(t)
+		expectRender(pk, tm, gn, files)
+		gn.EXPECT().Status(files, mock.Anything).Return(statuses, nil)
+
+		w := bytes.Buffer{}
+		require.ErrorIs(t, p.Status(t.Context(), &w, []string{"--json"}), ErrOutdated)
+
+		got := []pkgen.OutputStatus{}
+		require.NoError(t, json.Unmarshal(w.Bytes(), &got))
+		require.Equal(t, statuses, got)
+	})
+}
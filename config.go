@@ -4,9 +4,14 @@ import (
 	"context"
 	"errors"
 	"flag"
+	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"strconv"
+	"strings"
 
 	"go.yaml.in/yaml/v4"
 )
@@ -71,8 +76,20 @@ var DefaultConfig = Config{
 	},
 	Templates: TemplateConfigs{},
 	Generate: GenerateConfig{
-		OutputFile:    defaultOutputNameTemplate,
-		OutputFileMod: os.FileMode(0o644),
+		OutputFile:        defaultOutputNameTemplate,
+		OutputFileMod:     os.FileMode(0o644),
+		Format:            "",
+		OutputRoot:        "",
+		OutputDirMod:      os.FileMode(0o755),
+		Header:            HeaderConfig{LicenseFile: "", Marker: false, Build: "", Checksum: ""},
+		Manifest:          "",
+		Verify:            false,
+		Bundles:           nil,
+		AddRequires:       false,
+		LineDirectives:    false,
+		AllowedOutputDirs: nil,
+		TemplateOutputs:   nil,
+		Query:             PackagesQueryConfig{},
 	},
 	Verbose:    false,
 	configFile: "",
@@ -96,6 +113,15 @@ func (c *Config) RegisterFlags(fs *flag.FlagSet) {
 	fs.BoolVar(&c.Verbose, "verbose", false, "verbose output")
 }
 
+// GenerateConfig returns the generate config, set to load the packages again
+// the way the packages query did.
+func (c Config) GenerateConfig() GenerateConfig {
+	g := c.Generate
+	g.Query = c.PackagesQuery
+
+	return g
+}
+
 const defaultConfigFile = ".pkgen.yml"
 
 func NewConfig(ctx context.Context) (Config, error) {
@@ -166,22 +192,208 @@ func (c *PackagesQueryConfig) RegisterFlags(fs *flag.FlagSet) {
 }
 
 type GenerateConfig struct {
-	OutputFile    string      `yaml:"output"` // the default pattern is zz_generated.{{template name}}.go
-	OutputFileMod os.FileMode `yaml:"mod"`
+	OutputFile        string                  `yaml:"output"` // the default pattern is zz_generated.{{template name}}.go
+	OutputFileMod     os.FileMode             `yaml:"mod"`
+	Format            string                  `yaml:"format"`      // the formatter of the outputs, chosen by their extension when empty. See Formatter.
+	OutputRoot        string                  `yaml:"output_root"` // a directory of the module that mirrors the packages, to write the outputs in.
+	OutputDirMod      os.FileMode             `yaml:"dir_mod"`     // the mode of the created output directories.
+	Header            HeaderConfig            `yaml:"header"`
+	Manifest          string                  `yaml:"manifest"`            // the file, relative to the module root, recording the outputs. e.g. .pkgen.lock
+	Verify            bool                    `yaml:"verify"`              // type checks the packages once written, restoring the failing ones.
+	Bundles           []BundleConfig          `yaml:"bundles"`             // templates combined into a single output per package.
+	AddRequires       bool                    `yaml:"add_requires"`        // adds the module requirements of the templates found in the module cache.
+	LineDirectives    bool                    `yaml:"line_directives"`     // emits //line directives pointing at the template lines in the Go outputs.
+	AllowedOutputDirs []string                `yaml:"allowed_output_dirs"` // directories, besides the package one, that outputs may be written in.
+	TemplateOutputs   map[string]OutputConfig `yaml:"-"`                   // per template name, set by the <template>=<value> form of the flags.
+	Query             PackagesQueryConfig     `yaml:"-"`                   // the query the packages were loaded with, to load them again the same way.
+}
+
+// HeaderConfig is the header policy applied to every Go output, so that the
+// templates do not have to take care of it.
+type HeaderConfig struct {
+	LicenseFile string `yaml:"license_file"` // prepended to the outputs, as line comments unless it already is.
+	Marker      bool   `yaml:"marker"`       // ensures the generated code marker is present exactly once.
+	Build       string `yaml:"build"`        // a build constraint expression, combined with the one of the template if any.
+	Checksum    string `yaml:"checksum"`     // embeds a checksum of the content, and what to do when a target no longer matches it: warn or refuse.
+}
+
+// BundleConfig combines the main outputs of several templates into a single
+// one per package, named after the bundle like a template output.
+type BundleConfig struct {
+	Name      string   `yaml:"name"`
+	Templates []string `yaml:"templates"`
+}
+
+// OutputConfig is the output of a single template, set in its config entry or
+// in its front-matter. The empty fields fall back to the generate config.
+type OutputConfig struct {
+	Output string      `json:"output,omitempty" yaml:"output,omitempty"`
+	Mod    os.FileMode `json:"mod,omitempty"    yaml:"mod,omitempty"`
+	Format string      `json:"format,omitempty" yaml:"format,omitempty"`
+	Region string      `json:"region,omitempty" yaml:"region,omitempty"` // the region of the output file to render into, instead of the whole file.
+}
+
+func mergeOutputConfig(a, b OutputConfig) OutputConfig {
+	return OutputConfig{
+		Output: firstNotEmpty(a.Output, b.Output),
+		Mod:    firstNotEmpty(a.Mod, b.Mod),
+		Format: firstNotEmpty(a.Format, b.Format),
+		Region: firstNotEmpty(a.Region, b.Region),
+	}
+}
+
+// forTemplate returns the config that applies to tmp: the per template flags
+// first, then the template config entry and front-matter, then the defaults.
+func (c GenerateConfig) forTemplate(tmp Template) GenerateConfig {
+	o := mergeOutputConfig(c.templateOutput(tmp), tmp.Output)
+
+	c.OutputFile = firstNotEmpty(o.Output, c.OutputFile)
+	// the package wide default would be the same for every file.
+	switch {
+	case tmp.FrontMatter.Scope == ScopeFile:
+		c.OutputFile = firstNotEmpty(o.Output, defaultFileOutputNameTemplate)
+	case tmp.FrontMatter.PerType:
+		c.OutputFile = firstNotEmpty(o.Output, defaultTypeOutputNameTemplate)
+	}
+	c.OutputFileMod = firstNotEmpty(o.Mod, c.OutputFileMod)
+	c.Format = firstNotEmpty(o.Format, c.Format)
+
+	return c
+}
+
+// regionOf returns the region of the output file tmp renders into, if any.
+func (c GenerateConfig) regionOf(tmp Template) string {
+	return mergeOutputConfig(c.templateOutput(tmp), tmp.Output).Region
+}
+
+// templateOutput returns the per template flags of tmp, given for its name or
+// for its name@version, which takes precedence.
+func (c GenerateConfig) templateOutput(tmp Template) OutputConfig {
+	o := c.TemplateOutputs[tmp.Name]
+	if tmp.Version != "" {
+		o = mergeOutputConfig(c.TemplateOutputs[tmp.Name+versionSeparator+tmp.Version], o)
+	}
+
+	return o
+}
+
+// checkTemplateOutputs fails for the per template flags that match none of
+// the templates, which would otherwise be silently ignored.
+func (c GenerateConfig) checkTemplateOutputs(tmps []Template) error {
+	for _, key := range slices.Sorted(maps.Keys(c.TemplateOutputs)) {
+		name, version := splitVersion(key)
+		if !slices.ContainsFunc(tmps, func(t Template) bool { return t.Name == name && (version == "" || version == t.Version) }) {
+			return fmt.Errorf("%w: %s, in the <template>=<value> flags", ErrTemplateNotFound, key)
+		}
+	}
+
+	return nil
+}
+
+// checkBundles fails for the bundle members that match none of the templates,
+// which would otherwise render a part of the bundle only. Plugins render
+// their own outputs and are not bundled.
+func (c GenerateConfig) checkBundles(tmps []Template) error {
+	for _, b := range c.Bundles {
+		for _, member := range b.Templates {
+			name, version := splitVersion(member)
+			i := slices.IndexFunc(tmps, func(t Template) bool { return t.Name == name && (version == "" || version == t.Version) })
+			switch {
+			case i < 0:
+				return fmt.Errorf("%w: %s, in bundle %s", ErrTemplateNotFound, member, b.Name)
+			case tmps[i].IsPlugin():
+				return fmt.Errorf("%w: %s of bundle %s is a plugin", ErrBundle, member, b.Name)
+			}
+		}
+	}
+
+	return nil
+}
+
+var templateFlagRegexp = regexp.MustCompile(`^([\w.@/-]+)=(.*)$`)
+
+// templateFlag sets, for the <template>=<value> form, the value of a single
+// template, and the default otherwise.
+func (c *GenerateConfig) templateFlag(s string, set func(o *OutputConfig, v string) error, def func(v string) error) error {
+	m := templateFlagRegexp.FindStringSubmatch(s)
+	if m == nil {
+		return def(s)
+	}
+
+	if c.TemplateOutputs == nil {
+		c.TemplateOutputs = map[string]OutputConfig{}
+	}
+
+	o := c.TemplateOutputs[m[1]]
+	if err := set(&o, m[2]); err != nil {
+		return err
+	}
+	c.TemplateOutputs[m[1]] = o
+
+	return nil
 }
 
 func (c *GenerateConfig) RegisterFlags(fs *flag.FlagSet) {
-	fs.StringVar(&c.OutputFile, "output", DefaultConfig.Generate.OutputFile, "The generated file name. The default pattern is zz_generated.{{template name}}.go")
-	fs.Func("mod", "The generated file mode in octal format.", func(s string) error {
-		oc, err := parseOctal(s)
-		if err != nil {
-			return err
+	fs.Func("output", "The generated file name, or <template>=<name> for a single template. The default pattern is zz_generated.{{template name}}.go", func(s string) error {
+		return c.templateFlag(s,
+			func(o *OutputConfig, v string) error { o.Output = v; return nil },
+			func(v string) error { c.OutputFile = v; return nil },
+		)
+	})
+	fs.Func("mod", "The generated file mode in octal format, or <template>=<mode> for a single template.", func(s string) error {
+		return c.templateFlag(s,
+			func(o *OutputConfig, v string) (err error) { o.Mod, err = parseFileMode(v); return err },
+			func(v string) (err error) { c.OutputFileMod, err = parseFileMode(v); return err },
+		)
+	})
+	fs.Func("format", "The formatter of the generated files (gofmt, none), or <template>=<formatter> for a single template. By default it is chosen by the file extension: gofmt for .go files, none otherwise.", func(s string) error {
+		return c.templateFlag(s,
+			func(o *OutputConfig, v string) error { o.Format = v; return nil },
+			func(v string) error { c.Format = v; return nil },
+		)
+	})
+	fs.Func("region", "Render a template into a region of its output file, as <template>=<region>: the lines between the // pkgen:begin <region> and // pkgen:end <region> markers are replaced.", func(s string) error {
+		return c.templateFlag(s,
+			func(o *OutputConfig, v string) error { o.Region = v; return nil },
+			func(string) error { return fmt.Errorf("%w: expected <template>=<region>", ErrRegion) },
+		)
+	})
+	fs.StringVar(&c.OutputRoot, "output-root", "", "A directory of the module that mirrors the packages tree, to write the generated files in instead of the packages.")
+	fs.Func("dir-mod", "The mode of the created output directories in octal format.", func(s string) (err error) {
+		c.OutputDirMod, err = parseFileMode(s)
+		return err
+	})
+	fs.StringVar(&c.Header.LicenseFile, "header-license", "", "A license file to prepend to the generated Go files.")
+	fs.BoolVar(&c.Header.Marker, "header-marker", false, "Ensure the generated code marker is present exactly once in the generated Go files.")
+	fs.StringVar(&c.Header.Build, "header-build", "", "A build constraint expression to add to the generated Go files.")
+	fs.StringVar(&c.Header.Checksum, "header-checksum", "", "Embed a checksum of the content in the generated Go files, and warn or refuse (warn, refuse) when a file was edited by hand.")
+	fs.StringVar(&c.Manifest, "manifest", "", "A file, relative to the module root, recording the generated files, e.g. .pkgen.lock. Outputs no longer generated are then removed.")
+	fs.BoolVar(&c.Verify, "verify", false, "Type check the packages with generated files once written, and restore the ones that fail.")
+	fs.Func("bundle", "Combine templates into a single output per package, as <bundle name>=<template>,<template>. Can be used multiple times.", func(s string) error {
+		name, templates, ok := strings.Cut(s, "=")
+		if !ok || name == "" || templates == "" {
+			return fmt.Errorf("%w: expected <bundle name>=<template>,<template>", ErrBundle)
 		}
-		c.OutputFileMod = os.FileMode(oc) //nolint:gosec // reason: safe conversion for this use case
+		c.Bundles = append(c.Bundles, BundleConfig{Name: name, Templates: strings.Split(templates, ",")})
+		return nil
+	})
+	fs.BoolVar(&c.AddRequires, "add-requires", false, "Add the modules the templates require to go.mod, when a version is already in the module cache.")
+	fs.BoolVar(&c.LineDirectives, "line-directives", false, "Emit //line directives in the generated Go files, so that errors point at the template lines.")
+	fs.Func("allow-output-dir", "Allow outputs to be written in this directory, besides the package one. Can be used multiple times.", func(s string) error {
+		c.AllowedOutputDirs = append(c.AllowedOutputDirs, s)
 		return nil
 	})
 }
 
+func parseFileMode(s string) (os.FileMode, error) {
+	oc, err := parseOctal(s)
+	if err != nil {
+		return 0, err
+	}
+
+	return os.FileMode(oc), nil //nolint:gosec // reason: safe conversion for this use case
+}
+
 func parseOctal(s string) (uint64, error) {
 	if len(s) >= 2 && (s[0:2] == "0o" || s[0:2] == "0O") {
 		return strconv.ParseUint(s[2:], 8, 32)
@@ -190,8 +402,13 @@ func parseOctal(s string) (uint64, error) {
 }
 
 type TemplateConfig struct {
-	Name               string `yaml:"name"`
-	CustomTemplateFile string `yaml:"template_file"`
+	Name               string         `yaml:"name"`
+	CustomTemplateFile string         `yaml:"template_file"`
+	Plugin             string         `yaml:"plugin"` // executable speaking the plugin protocol, see PluginRequest.
+	Params             map[string]any `yaml:"params"` // overrides the params declared in the template front-matter.
+
+	// overrides the output declared in the template front-matter.
+	OutputConfig `yaml:",inline"`
 }
 
 func (tc *TemplateConfig) UnmarshalYAML(value *yaml.Node) error {
@@ -210,6 +427,9 @@ func (tc *TemplateConfig) UnmarshalYAML(value *yaml.Node) error {
 	*tc = TemplateConfig{
 		Name:               str,
 		CustomTemplateFile: "",
+		Plugin:             "",
+		Params:             nil,
+		OutputConfig:       OutputConfig{},
 	}
 	return nil
 }
@@ -218,11 +438,15 @@ type TemplateConfigs []TemplateConfig
 
 func (tc *TemplateConfigs) RegisterFlags(fs *flag.FlagSet) {
 	fs.Func("template", "Add a template to use. Can be used multiple times.", func(s string) error {
-		(*tc) = append((*tc), TemplateConfig{Name: s, CustomTemplateFile: ""})
+		(*tc) = append((*tc), TemplateConfig{Name: s, CustomTemplateFile: "", Plugin: "", Params: nil, OutputConfig: OutputConfig{}})
 		return nil
 	})
 	fs.Func("template-file", "Add a path to a custom template to use. Can be used multiple times.", func(s string) error {
-		(*tc) = append((*tc), TemplateConfig{Name: "", CustomTemplateFile: s})
+		(*tc) = append((*tc), TemplateConfig{Name: "", CustomTemplateFile: s, Plugin: "", Params: nil, OutputConfig: OutputConfig{}})
+		return nil
+	})
+	fs.Func("plugin", "Add an external generator plugin executable to use. Can be used multiple times.", func(s string) error {
+		(*tc) = append((*tc), TemplateConfig{Name: "", CustomTemplateFile: "", Plugin: s, Params: nil, OutputConfig: OutputConfig{}})
 		return nil
 	})
 }
@@ -271,23 +495,44 @@ func mergeAll(c ...Config) Config {
 
 func merge(a, b Config) Config {
 	return Config{
-		PackagesQuery: PackagesQueryConfig{
-			IncludeTests: firstNotEmpty(a.PackagesQuery.IncludeTests, b.PackagesQuery.IncludeTests),
-			Env:          firstNotEmptySlice(a.PackagesQuery.Env, b.PackagesQuery.Env),
-			BuildFlags:   firstNotEmptySlice(a.PackagesQuery.BuildFlags, b.PackagesQuery.BuildFlags),
-			Dir:          firstNotEmpty(a.PackagesQuery.Dir, b.PackagesQuery.Dir),
-			Patterns:     firstNotEmptySlice(a.PackagesQuery.Patterns, b.PackagesQuery.Patterns),
-		},
-		Templates: firstNotEmptySlice(a.Templates, b.Templates),
+		PackagesQuery: mergeQuery(a.PackagesQuery, b.PackagesQuery),
+		Templates:     firstNotEmptySlice(a.Templates, b.Templates),
 		Generate: GenerateConfig{
 			OutputFile:    firstNotEmpty(a.Generate.OutputFile, b.Generate.OutputFile),
 			OutputFileMod: firstNotEmpty(a.Generate.OutputFileMod, b.Generate.OutputFileMod),
+			Format:        firstNotEmpty(a.Generate.Format, b.Generate.Format),
+			OutputRoot:    firstNotEmpty(a.Generate.OutputRoot, b.Generate.OutputRoot),
+			OutputDirMod:  firstNotEmpty(a.Generate.OutputDirMod, b.Generate.OutputDirMod),
+			Header: HeaderConfig{
+				LicenseFile: firstNotEmpty(a.Generate.Header.LicenseFile, b.Generate.Header.LicenseFile),
+				Marker:      firstNotEmpty(a.Generate.Header.Marker, b.Generate.Header.Marker),
+				Build:       firstNotEmpty(a.Generate.Header.Build, b.Generate.Header.Build),
+				Checksum:    firstNotEmpty(a.Generate.Header.Checksum, b.Generate.Header.Checksum),
+			},
+			Manifest:          firstNotEmpty(a.Generate.Manifest, b.Generate.Manifest),
+			Verify:            firstNotEmpty(a.Generate.Verify, b.Generate.Verify),
+			Bundles:           firstNotEmptySlice(a.Generate.Bundles, b.Generate.Bundles),
+			AddRequires:       firstNotEmpty(a.Generate.AddRequires, b.Generate.AddRequires),
+			LineDirectives:    firstNotEmpty(a.Generate.LineDirectives, b.Generate.LineDirectives),
+			AllowedOutputDirs: firstNotEmptySlice(a.Generate.AllowedOutputDirs, b.Generate.AllowedOutputDirs),
+			TemplateOutputs:   firstNotEmptyMap(a.Generate.TemplateOutputs, b.Generate.TemplateOutputs),
+			Query:             mergeQuery(a.Generate.Query, b.Generate.Query),
 		},
 		Verbose:    firstNotEmpty(a.Verbose, b.Verbose),
 		configFile: firstNotEmpty(a.configFile, b.configFile),
 	}
 }
 
+func mergeQuery(a, b PackagesQueryConfig) PackagesQueryConfig {
+	return PackagesQueryConfig{
+		IncludeTests: firstNotEmpty(a.IncludeTests, b.IncludeTests),
+		Env:          firstNotEmptySlice(a.Env, b.Env),
+		BuildFlags:   firstNotEmptySlice(a.BuildFlags, b.BuildFlags),
+		Dir:          firstNotEmpty(a.Dir, b.Dir),
+		Patterns:     firstNotEmptySlice(a.Patterns, b.Patterns),
+	}
+}
+
 func firstNotEmpty[T comparable](a, b T) T { //nolint: ireturn
 	var empty T
 	if a == empty {
@@ -304,3 +549,11 @@ func firstNotEmptySlice[S ~[]E, E any](a, b S) S { //nolint: ireturn
 
 	return b
 }
+
+func firstNotEmptyMap[M ~map[K]V, K comparable, V any](a, b M) M { //nolint: ireturn
+	if len(a) > 0 {
+		return a
+	}
+
+	return b
+}
@@ -100,39 +100,77 @@ func TestGenerateConfigFlags(t *testing.T) {
 	}{
 		{
 			arguments: []string{},
-			expected:  GenerateConfig{OutputFile: defaultOutputNameTemplate, OutputFileMod: os.FileMode(0o644)},
+			expected:  GenerateConfig{OutputFile: defaultOutputNameTemplate, OutputFileMod: os.FileMode(0o644), Format: "", OutputRoot: "", OutputDirMod: os.FileMode(0o755), Header: HeaderConfig{LicenseFile: "", Marker: false, Build: "", Checksum: ""}, Manifest: "", Verify: false, Bundles: nil, AddRequires: false, LineDirectives: false, AllowedOutputDirs: nil, TemplateOutputs: nil, Query: PackagesQueryConfig{}},
 		},
 		{
 			arguments: []string{"-output", "custom.go"},
-			expected:  GenerateConfig{OutputFile: "custom.go", OutputFileMod: os.FileMode(0o644)},
+			expected:  GenerateConfig{OutputFile: "custom.go", OutputFileMod: os.FileMode(0o644), Format: "", OutputRoot: "", OutputDirMod: os.FileMode(0o755), Header: HeaderConfig{LicenseFile: "", Marker: false, Build: "", Checksum: ""}, Manifest: "", Verify: false, Bundles: nil, AddRequires: false, LineDirectives: false, AllowedOutputDirs: nil, TemplateOutputs: nil, Query: PackagesQueryConfig{}},
 		},
 		{
 			arguments: []string{"--output", "custom.go"},
-			expected:  GenerateConfig{OutputFile: "custom.go", OutputFileMod: os.FileMode(0o644)},
+			expected:  GenerateConfig{OutputFile: "custom.go", OutputFileMod: os.FileMode(0o644), Format: "", OutputRoot: "", OutputDirMod: os.FileMode(0o755), Header: HeaderConfig{LicenseFile: "", Marker: false, Build: "", Checksum: ""}, Manifest: "", Verify: false, Bundles: nil, AddRequires: false, LineDirectives: false, AllowedOutputDirs: nil, TemplateOutputs: nil, Query: PackagesQueryConfig{}},
 		},
 		{
 			arguments: []string{"-mod", "0o755"},
-			expected:  GenerateConfig{OutputFile: defaultOutputNameTemplate, OutputFileMod: os.FileMode(0o755)},
+			expected:  GenerateConfig{OutputFile: defaultOutputNameTemplate, OutputFileMod: os.FileMode(0o755), Format: "", OutputRoot: "", OutputDirMod: os.FileMode(0o755), Header: HeaderConfig{LicenseFile: "", Marker: false, Build: "", Checksum: ""}, Manifest: "", Verify: false, Bundles: nil, AddRequires: false, LineDirectives: false, AllowedOutputDirs: nil, TemplateOutputs: nil, Query: PackagesQueryConfig{}},
 		},
 		{
 			arguments: []string{"--mod", "0o755"},
-			expected:  GenerateConfig{OutputFile: defaultOutputNameTemplate, OutputFileMod: os.FileMode(0o755)},
+			expected:  GenerateConfig{OutputFile: defaultOutputNameTemplate, OutputFileMod: os.FileMode(0o755), Format: "", OutputRoot: "", OutputDirMod: os.FileMode(0o755), Header: HeaderConfig{LicenseFile: "", Marker: false, Build: "", Checksum: ""}, Manifest: "", Verify: false, Bundles: nil, AddRequires: false, LineDirectives: false, AllowedOutputDirs: nil, TemplateOutputs: nil, Query: PackagesQueryConfig{}},
 		},
 		{
 			arguments: []string{"-mod", "0O644"},
-			expected:  GenerateConfig{OutputFile: defaultOutputNameTemplate, OutputFileMod: os.FileMode(0o644)},
+			expected:  GenerateConfig{OutputFile: defaultOutputNameTemplate, OutputFileMod: os.FileMode(0o644), Format: "", OutputRoot: "", OutputDirMod: os.FileMode(0o755), Header: HeaderConfig{LicenseFile: "", Marker: false, Build: "", Checksum: ""}, Manifest: "", Verify: false, Bundles: nil, AddRequires: false, LineDirectives: false, AllowedOutputDirs: nil, TemplateOutputs: nil, Query: PackagesQueryConfig{}},
 		},
 		{
 			arguments: []string{"-mod", "600"},
-			expected:  GenerateConfig{OutputFile: defaultOutputNameTemplate, OutputFileMod: os.FileMode(0o600)},
+			expected:  GenerateConfig{OutputFile: defaultOutputNameTemplate, OutputFileMod: os.FileMode(0o600), Format: "", OutputRoot: "", OutputDirMod: os.FileMode(0o755), Header: HeaderConfig{LicenseFile: "", Marker: false, Build: "", Checksum: ""}, Manifest: "", Verify: false, Bundles: nil, AddRequires: false, LineDirectives: false, AllowedOutputDirs: nil, TemplateOutputs: nil, Query: PackagesQueryConfig{}},
 		},
 		{
 			arguments: []string{"-output", "test.go", "-mod", "0o755"},
-			expected:  GenerateConfig{OutputFile: "test.go", OutputFileMod: os.FileMode(0o755)},
+			expected:  GenerateConfig{OutputFile: "test.go", OutputFileMod: os.FileMode(0o755), Format: "", OutputRoot: "", OutputDirMod: os.FileMode(0o755), Header: HeaderConfig{LicenseFile: "", Marker: false, Build: "", Checksum: ""}, Manifest: "", Verify: false, Bundles: nil, AddRequires: false, LineDirectives: false, AllowedOutputDirs: nil, TemplateOutputs: nil, Query: PackagesQueryConfig{}},
 		},
 		{
 			arguments: []string{"--output", "test.go", "--mod", "0o755"},
-			expected:  GenerateConfig{OutputFile: "test.go", OutputFileMod: os.FileMode(0o755)},
+			expected:  GenerateConfig{OutputFile: "test.go", OutputFileMod: os.FileMode(0o755), Format: "", OutputRoot: "", OutputDirMod: os.FileMode(0o755), Header: HeaderConfig{LicenseFile: "", Marker: false, Build: "", Checksum: ""}, Manifest: "", Verify: false, Bundles: nil, AddRequires: false, LineDirectives: false, AllowedOutputDirs: nil, TemplateOutputs: nil, Query: PackagesQueryConfig{}},
+		},
+		{
+			arguments: []string{"--format", "gofmt"},
+			expected:  GenerateConfig{OutputFile: defaultOutputNameTemplate, OutputFileMod: os.FileMode(0o644), Format: "gofmt", OutputRoot: "", OutputDirMod: os.FileMode(0o755), Header: HeaderConfig{LicenseFile: "", Marker: false, Build: "", Checksum: ""}, Manifest: "", Verify: false, Bundles: nil, AddRequires: false, LineDirectives: false, AllowedOutputDirs: nil, TemplateOutputs: nil, Query: PackagesQueryConfig{}},
+		},
+		{
+			arguments: []string{"--output", "otel=zz_otel.go", "--mod", "otel=0o600", "--format", "pkgpath=none", "--output", "x.go"},
+			expected: GenerateConfig{
+				OutputFile:        "x.go",
+				OutputFileMod:     os.FileMode(0o644),
+				Format:            "",
+				OutputRoot:        "",
+				OutputDirMod:      os.FileMode(0o755),
+				Header:            HeaderConfig{LicenseFile: "", Marker: false, Build: "", Checksum: ""},
+				Manifest:          "",
+				Verify:            false,
+				Bundles:           nil,
+				AddRequires:       false,
+				LineDirectives:    false,
+				AllowedOutputDirs: nil,
+				TemplateOutputs: map[string]OutputConfig{
+					"otel":    {Output: "zz_otel.go", Mod: 0o600, Format: "", Region: ""},
+					"pkgpath": {Output: "", Mod: 0, Format: "none", Region: ""},
+				},
+				Query: PackagesQueryConfig{},
+			},
+		},
+		{
+			arguments: []string{"--output", "wire=wire.go", "--region", "wire=providers"},
+			expected:  GenerateConfig{OutputFile: defaultOutputNameTemplate, OutputFileMod: os.FileMode(0o644), Format: "", OutputRoot: "", OutputDirMod: os.FileMode(0o755), Header: HeaderConfig{LicenseFile: "", Marker: false, Build: "", Checksum: ""}, Manifest: "", Verify: false, Bundles: nil, AddRequires: false, LineDirectives: false, AllowedOutputDirs: nil, TemplateOutputs: map[string]OutputConfig{"wire": {Output: "wire.go", Mod: 0, Format: "", Region: "providers"}}, Query: PackagesQueryConfig{}},
+		},
+		{
+			arguments: []string{"--bundle", "otel=pkgpath,oteltrace", "--bundle", "x=y"},
+			expected:  GenerateConfig{OutputFile: defaultOutputNameTemplate, OutputFileMod: os.FileMode(0o644), Format: "", OutputRoot: "", OutputDirMod: os.FileMode(0o755), Header: HeaderConfig{LicenseFile: "", Marker: false, Build: "", Checksum: ""}, Manifest: "", Verify: false, Bundles: []BundleConfig{{Name: "otel", Templates: []string{"pkgpath", "oteltrace"}}, {Name: "x", Templates: []string{"y"}}}, AddRequires: false, LineDirectives: false, AllowedOutputDirs: nil, TemplateOutputs: nil, Query: PackagesQueryConfig{}},
+		},
+		{
+			arguments: []string{"--output", `{{ .TemplateName }}.go`},
+			expected:  GenerateConfig{OutputFile: `{{ .TemplateName }}.go`, OutputFileMod: os.FileMode(0o644), Format: "", OutputRoot: "", OutputDirMod: os.FileMode(0o755), Header: HeaderConfig{LicenseFile: "", Marker: false, Build: "", Checksum: ""}, Manifest: "", Verify: false, Bundles: nil, AddRequires: false, LineDirectives: false, AllowedOutputDirs: nil, TemplateOutputs: nil, Query: PackagesQueryConfig{}},
 		},
 	}
 
@@ -148,6 +186,34 @@ func TestGenerateConfigFlags(t *testing.T) {
 	}
 }
 
+func TestGenerateConfigCheckBundles(t *testing.T) {
+	tmp := func(name, version, plugin string) Template {
+		return Template{Name: name, Version: version, Source: SourceBuiltin, Path: "", Text: nil, Plugin: plugin, FrontMatter: FrontMatter{}, Params: nil, Output: OutputConfig{}}
+	}
+	tmps := []Template{tmp("otel", "v1", ""), tmp("pkgpath", "", ""), tmp("gen", "", "./bin/gen")}
+
+	tests := map[string]struct {
+		bundles       []BundleConfig
+		errorAsserter tst.ErrorAssertionFunc
+	}{
+		"no bundles":        {bundles: nil, errorAsserter: tst.NoError()},
+		"members":           {bundles: []BundleConfig{{Name: "b", Templates: []string{"otel", "pkgpath"}}}, errorAsserter: tst.NoError()},
+		"versioned member":  {bundles: []BundleConfig{{Name: "b", Templates: []string{"otel@v1", "pkgpath"}}}, errorAsserter: tst.NoError()},
+		"unknown member":    {bundles: []BundleConfig{{Name: "b", Templates: []string{"otel", "pkgpth"}}}, errorAsserter: tst.ErrorIs(ErrTemplateNotFound)},
+		"unknown version":   {bundles: []BundleConfig{{Name: "b", Templates: []string{"otel@v2", "pkgpath"}}}, errorAsserter: tst.ErrorIs(ErrTemplateNotFound)},
+		"plugin as member":  {bundles: []BundleConfig{{Name: "b", Templates: []string{"otel", "gen"}}}, errorAsserter: tst.ErrorIs(ErrBundle)},
+		"in another bundle": {bundles: []BundleConfig{{Name: "a", Templates: []string{"otel"}}, {Name: "b", Templates: []string{"missing"}}}, errorAsserter: tst.ErrorIs(ErrTemplateNotFound)},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			c := DefaultConfig.Generate
+			c.Bundles = tc.bundles
+			tc.errorAsserter(t, c.checkBundles(tmps))
+		})
+	}
+}
+
 func TestTemplateConfigYAMLUnmarshal(t *testing.T) {
 	tests := map[string]struct {
 		input    string
@@ -155,16 +221,33 @@ func TestTemplateConfigYAMLUnmarshal(t *testing.T) {
 	}{
 		"string": {
 			input:    `"a single string"`,
-			expected: TemplateConfigs{TemplateConfig{Name: "a single string", CustomTemplateFile: ""}},
+			expected: TemplateConfigs{TemplateConfig{Name: "a single string", CustomTemplateFile: "", Plugin: "", Params: nil, OutputConfig: OutputConfig{}}},
 		},
 		"string array": {
 			input:    `[ "abc", "def" ]`,
-			expected: TemplateConfigs{TemplateConfig{Name: "abc", CustomTemplateFile: ""}, TemplateConfig{Name: "def", CustomTemplateFile: ""}},
+			expected: TemplateConfigs{TemplateConfig{Name: "abc", CustomTemplateFile: "", Plugin: "", Params: nil, OutputConfig: OutputConfig{}}, TemplateConfig{Name: "def", CustomTemplateFile: "", Plugin: "", Params: nil, OutputConfig: OutputConfig{}}},
 		},
 		"object array": {
 			input: `- name: "abc"
 - template_file: "/abc/def"`,
-			expected: TemplateConfigs{TemplateConfig{Name: "abc", CustomTemplateFile: ""}, TemplateConfig{Name: "", CustomTemplateFile: "/abc/def"}},
+			expected: TemplateConfigs{TemplateConfig{Name: "abc", CustomTemplateFile: "", Plugin: "", Params: nil, OutputConfig: OutputConfig{}}, TemplateConfig{Name: "", CustomTemplateFile: "/abc/def", Plugin: "", Params: nil, OutputConfig: OutputConfig{}}},
+		},
+		"params": {
+			input: `- name: "abc"
+  params:
+    prefix: def`,
+			expected: TemplateConfigs{TemplateConfig{Name: "abc", CustomTemplateFile: "", Plugin: "", Params: map[string]any{"prefix": "def"}, OutputConfig: OutputConfig{}}},
+		},
+		"plugin": {
+			input:    `- plugin: "./bin/gen"`,
+			expected: TemplateConfigs{TemplateConfig{Name: "", CustomTemplateFile: "", Plugin: "./bin/gen", Params: nil, OutputConfig: OutputConfig{}}},
+		},
+		"output": {
+			input: `- name: "pkgpath"
+  output: pkgpath.go
+  mod: 0o600
+  format: gofmt`,
+			expected: TemplateConfigs{TemplateConfig{Name: "pkgpath", CustomTemplateFile: "", Plugin: "", Params: nil, OutputConfig: OutputConfig{Output: "pkgpath.go", Mod: 0o600, Format: "gofmt", Region: ""}}},
 		},
 	}
 
@@ -185,35 +268,39 @@ func TestTemplateConfigFlags(t *testing.T) {
 	}{
 		{
 			arguments: []string{"--template", "abc"},
-			expected:  TemplateConfigs{TemplateConfig{Name: "abc", CustomTemplateFile: ""}},
+			expected:  TemplateConfigs{TemplateConfig{Name: "abc", CustomTemplateFile: "", Plugin: "", Params: nil, OutputConfig: OutputConfig{}}},
 		},
 		{
 			arguments: []string{"-template", "abc"},
-			expected:  TemplateConfigs{TemplateConfig{Name: "abc", CustomTemplateFile: ""}},
+			expected:  TemplateConfigs{TemplateConfig{Name: "abc", CustomTemplateFile: "", Plugin: "", Params: nil, OutputConfig: OutputConfig{}}},
 		},
 		{
 			arguments: []string{"-template", "abc", "-template", "def"},
-			expected:  TemplateConfigs{TemplateConfig{Name: "abc", CustomTemplateFile: ""}, TemplateConfig{Name: "def", CustomTemplateFile: ""}},
+			expected:  TemplateConfigs{TemplateConfig{Name: "abc", CustomTemplateFile: "", Plugin: "", Params: nil, OutputConfig: OutputConfig{}}, TemplateConfig{Name: "def", CustomTemplateFile: "", Plugin: "", Params: nil, OutputConfig: OutputConfig{}}},
 		},
 		{
 			arguments: []string{"-template-file", "abc"},
-			expected:  TemplateConfigs{TemplateConfig{Name: "", CustomTemplateFile: "abc"}},
+			expected:  TemplateConfigs{TemplateConfig{Name: "", CustomTemplateFile: "abc", Plugin: "", Params: nil, OutputConfig: OutputConfig{}}},
 		},
 		{
 			arguments: []string{"-template-file", "abc", "-template-file", "def"},
-			expected:  TemplateConfigs{TemplateConfig{Name: "", CustomTemplateFile: "abc"}, TemplateConfig{Name: "", CustomTemplateFile: "def"}},
+			expected:  TemplateConfigs{TemplateConfig{Name: "", CustomTemplateFile: "abc", Plugin: "", Params: nil, OutputConfig: OutputConfig{}}, TemplateConfig{Name: "", CustomTemplateFile: "def", Plugin: "", Params: nil, OutputConfig: OutputConfig{}}},
 		},
 		{
 			arguments: []string{"-template", "abc", "-template-file", "def"},
-			expected:  TemplateConfigs{TemplateConfig{Name: "abc", CustomTemplateFile: ""}, TemplateConfig{Name: "", CustomTemplateFile: "def"}},
+			expected:  TemplateConfigs{TemplateConfig{Name: "abc", CustomTemplateFile: "", Plugin: "", Params: nil, OutputConfig: OutputConfig{}}, TemplateConfig{Name: "", CustomTemplateFile: "def", Plugin: "", Params: nil, OutputConfig: OutputConfig{}}},
 		},
 		{
 			arguments: []string{"-template-file", "abc", "-template", "def"},
-			expected:  TemplateConfigs{TemplateConfig{Name: "", CustomTemplateFile: "abc"}, TemplateConfig{Name: "def", CustomTemplateFile: ""}},
+			expected:  TemplateConfigs{TemplateConfig{Name: "", CustomTemplateFile: "abc", Plugin: "", Params: nil, OutputConfig: OutputConfig{}}, TemplateConfig{Name: "def", CustomTemplateFile: "", Plugin: "", Params: nil, OutputConfig: OutputConfig{}}},
+		},
+		{
+			arguments: []string{"-plugin", "./bin/gen", "-template", "def"},
+			expected:  TemplateConfigs{TemplateConfig{Name: "", CustomTemplateFile: "", Plugin: "./bin/gen", Params: nil, OutputConfig: OutputConfig{}}, TemplateConfig{Name: "def", CustomTemplateFile: "", Plugin: "", Params: nil, OutputConfig: OutputConfig{}}},
 		},
 		{
 			arguments: []string{"--template-file", "abc", "--template", "def"},
-			expected:  TemplateConfigs{TemplateConfig{Name: "", CustomTemplateFile: "abc"}, TemplateConfig{Name: "def", CustomTemplateFile: ""}},
+			expected:  TemplateConfigs{TemplateConfig{Name: "", CustomTemplateFile: "abc", Plugin: "", Params: nil, OutputConfig: OutputConfig{}}, TemplateConfig{Name: "def", CustomTemplateFile: "", Plugin: "", Params: nil, OutputConfig: OutputConfig{}}},
 		},
 	}
 
@@ -228,7 +315,7 @@ func TestTemplateConfigFlags(t *testing.T) {
 	}
 }
 
-//go:embed testdata/*
+//go:embed testdata/*.yml
 var testData embed.FS
 
 func tdFile(name string) string {
@@ -273,8 +360,8 @@ func TestConfigEndToEnd(t *testing.T) {
 					Dir:          "",
 					Patterns:     []string{"./internal/app", "./internal/domain/..."},
 				},
-				Templates:  TemplateConfigs{TemplateConfig{Name: "otel", CustomTemplateFile: ""}},
-				Generate:   GenerateConfig{OutputFile: "zz_generated.{{ .TemplateName }}.go", OutputFileMod: os.FileMode(0o644)},
+				Templates:  TemplateConfigs{TemplateConfig{Name: "otel", CustomTemplateFile: "", Plugin: "", Params: nil, OutputConfig: OutputConfig{}}},
+				Generate:   GenerateConfig{OutputFile: "zz_generated.{{ .TemplateName }}.go", OutputFileMod: os.FileMode(0o644), Format: "", OutputRoot: "", OutputDirMod: os.FileMode(0o755), Header: HeaderConfig{LicenseFile: "", Marker: false, Build: "", Checksum: ""}, Manifest: "", Verify: false, Bundles: nil, AddRequires: false, LineDirectives: false, AllowedOutputDirs: nil, TemplateOutputs: nil, Query: PackagesQueryConfig{}},
 				Verbose:    false,
 				configFile: "cfg.yml",
 			},
@@ -303,8 +390,8 @@ func TestConfigEndToEnd(t *testing.T) {
 					Dir:          "",
 					Patterns:     []string{"./internal/app", "./internal/domain/..."},
 				},
-				Templates:  TemplateConfigs{TemplateConfig{Name: "otel", CustomTemplateFile: ""}},
-				Generate:   GenerateConfig{OutputFile: "zz_generated.{{ .TemplateName }}.go", OutputFileMod: os.FileMode(0o644)},
+				Templates:  TemplateConfigs{TemplateConfig{Name: "otel", CustomTemplateFile: "", Plugin: "", Params: nil, OutputConfig: OutputConfig{}}},
+				Generate:   GenerateConfig{OutputFile: "zz_generated.{{ .TemplateName }}.go", OutputFileMod: os.FileMode(0o644), Format: "", OutputRoot: "", OutputDirMod: os.FileMode(0o755), Header: HeaderConfig{LicenseFile: "", Marker: false, Build: "", Checksum: ""}, Manifest: "", Verify: false, Bundles: nil, AddRequires: false, LineDirectives: false, AllowedOutputDirs: nil, TemplateOutputs: nil, Query: PackagesQueryConfig{}},
 				Verbose:    false,
 				configFile: "",
 			},
@@ -324,8 +411,8 @@ func TestConfigEndToEnd(t *testing.T) {
 					Dir:          "",
 					Patterns:     []string{"./internal/app", "./internal/domain/..."},
 				},
-				Templates:  TemplateConfigs{TemplateConfig{Name: "pkgpath", CustomTemplateFile: ""}, TemplateConfig{Name: "", CustomTemplateFile: "./custom.tmpl"}},
-				Generate:   GenerateConfig{OutputFile: "zz_generated.{{ .TemplateName }}.go", OutputFileMod: os.FileMode(0o644)},
+				Templates:  TemplateConfigs{TemplateConfig{Name: "pkgpath", CustomTemplateFile: "", Plugin: "", Params: nil, OutputConfig: OutputConfig{}}, TemplateConfig{Name: "", CustomTemplateFile: "./custom.tmpl", Plugin: "", Params: nil, OutputConfig: OutputConfig{}}},
+				Generate:   GenerateConfig{OutputFile: "zz_generated.{{ .TemplateName }}.go", OutputFileMod: os.FileMode(0o644), Format: "", OutputRoot: "", OutputDirMod: os.FileMode(0o755), Header: HeaderConfig{LicenseFile: "", Marker: false, Build: "", Checksum: ""}, Manifest: "", Verify: false, Bundles: nil, AddRequires: false, LineDirectives: false, AllowedOutputDirs: nil, TemplateOutputs: nil, Query: PackagesQueryConfig{}},
 				Verbose:    false,
 				configFile: "cfg.yml",
 			},
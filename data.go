@@ -0,0 +1,180 @@
+package pkgen
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// TemplateData is what a template is rendered with. The package fields are
+// promoted, so {{ .Name }} or {{ .PkgPath }} refer to the package.
+type TemplateData struct {
+	packages.Package
+	Params map[string]any
+	Run    RunInfo
+	Output OutputPackage
+	File   *ScopedFile      // the Go file a file scoped template is rendered for, nil otherwise.
+	Types  []*AnnotatedType // the types a type scoped template is rendered for.
+	Type   *AnnotatedType   // the type a per type template is rendered for, nil otherwise.
+}
+
+// OutputPackage is the package the outputs are written in: the package itself,
+// or its mirror under the output root.
+type OutputPackage struct {
+	Name    string
+	PkgPath string
+	Dir     string
+}
+
+// RunInfo describes the pkgen run and the template being rendered.
+type RunInfo struct {
+	Mode            string
+	Version         string
+	Template        string
+	TemplateVersion string
+}
+
+func NewTemplateData(pkg packages.Package, tmp Template) TemplateData {
+	return TemplateData{
+		Package: pkg,
+		Params:  tmp.Params,
+		Run: RunInfo{
+			Mode:            GetRunningMode().String(),
+			Version:         Version(),
+			Template:        tmp.Name,
+			TemplateVersion: tmp.Version,
+		},
+		Output: OutputPackage{
+			Name:    pkg.Name,
+			PkgPath: pkg.PkgPath,
+			Dir:     pkg.Dir,
+		},
+		File:  nil,
+		Types: nil,
+		Type:  nil,
+	}
+}
+
+// templateData is the data tmp is rendered with in pkg, before its scope.
+func (r renderer) templateData(pkg packages.Package, tmp Template, cnf GenerateConfig) (TemplateData, error) {
+	out, err := outputPackage(pkg, cnf.OutputRoot, r.names)
+	if err != nil {
+		return TemplateData{}, err
+	}
+
+	data := NewTemplateData(pkg, tmp)
+	data.Output = out
+
+	return data, nil
+}
+
+// Data returns the data each template is rendered with in each package, as
+// Render would render them: once per Go file or annotated type for the scoped
+// templates.
+func (g Generator) Data(ctx context.Context, pkgs []packages.Package, tmps []Template, cnf GenerateConfig) ([]TemplateData, error) {
+	r, err := newRenderer(cnf)
+	if err != nil {
+		return nil, err
+	}
+	pkgs = withoutOutputPackages(pkgs, cnf.OutputRoot, r.names)
+
+	if err := checkLoaded(pkgs); err != nil {
+		return nil, err
+	}
+
+	if err := r.loadTypes(ctx, pkgs, tmps, cnf.Query); err != nil {
+		return nil, err
+	}
+
+	if err := r.loadOwnOutputs(pkgs, tmps, cnf); err != nil {
+		return nil, err
+	}
+
+	data := make([]TemplateData, 0, len(pkgs)*len(tmps))
+	for _, p := range pkgs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		if testMain(p) {
+			continue
+		}
+
+		for _, tmp := range tmps {
+			d, err := r.templateData(p, tmp, cnf)
+			if err != nil {
+				return nil, err
+			}
+
+			// one per Go file or annotated type for the scoped templates.
+			scopes, err := r.scopes(p, tmp)
+			if err != nil {
+				return nil, err
+			}
+			for _, s := range scopes {
+				scoped := d
+				if s.set != nil {
+					s.set(&scoped, &OutputName{})
+				}
+				data = append(data, scoped)
+			}
+		}
+	}
+
+	return data, nil
+}
+
+// MarshalJSON shadows the promoted packages.Package one, which would drop
+// everything but the package. The keys are the field names templates use.
+func (d TemplateData) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		ID              string
+		Name            string
+		PkgPath         string
+		Dir             string
+		GoFiles         []string
+		CompiledGoFiles []string
+		OtherFiles      []string
+		EmbedFiles      []string
+		IgnoredFiles    []string
+		Module          *packages.Module
+		Params          map[string]any
+		Run             RunInfo
+		Output          OutputPackage
+		File            *ScopedFile      `json:",omitempty"`
+		Types           []*AnnotatedType `json:",omitempty"`
+		Type            *AnnotatedType   `json:",omitempty"`
+	}{
+		ID:              d.ID,
+		Name:            d.Name,
+		PkgPath:         d.PkgPath,
+		Dir:             d.Dir,
+		GoFiles:         d.GoFiles,
+		CompiledGoFiles: d.CompiledGoFiles,
+		OtherFiles:      d.OtherFiles,
+		EmbedFiles:      d.EmbedFiles,
+		IgnoredFiles:    d.IgnoredFiles,
+		Module:          d.Module,
+		Params:          d.Params,
+		Run:             d.Run,
+		Output:          d.Output,
+		File:            d.File,
+		Types:           d.Types,
+		Type:            d.Type,
+	})
+}
+
+// mergeParams overlays the configured params on the declared defaults.
+func mergeParams(defaults, configured map[string]any) map[string]any {
+	if len(defaults) == 0 && len(configured) == 0 {
+		return nil
+	}
+
+	params := make(map[string]any, len(defaults)+len(configured))
+	maps.Copy(params, defaults)
+	maps.Copy(params, configured)
+
+	return params
+}
@@ -0,0 +1,49 @@
+package pkgen
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/tools/go/packages"
+)
+
+func TestTemplateData(t *testing.T) {
+	tmp := Template{
+		Name:        "abc",
+		Version:     "v2",
+		Source:      SourceBuiltin,
+		Path:        "",
+		Text:        template.Must(template.New("abc").Parse(`{{ .Name }} {{ .PkgPath }} {{ .Params.prefix }} {{ .Run.Template }}@{{ .Run.TemplateVersion }}`)),
+		Plugin:      "",
+		FrontMatter: FrontMatter{Description: "", Params: nil, Requires: Requirements{}, Scope: "", Files: FileFilter{}, PerType: false, OutputConfig: OutputConfig{}},
+		Params:      map[string]any{"prefix": "def"},
+		Output:      OutputConfig{},
+	}
+
+	data := NewTemplateData(packages.Package{Name: "pkg1", PkgPath: "example.com/pkg1"}, tmp)
+
+	s := strings.Builder{}
+	require.NoError(t, tmp.Text.Execute(&s, data))
+	require.Equal(t, "pkg1 example.com/pkg1 def abc@v2", s.String())
+
+	b, err := json.Marshal(data)
+	require.NoError(t, err)
+
+	got := map[string]any{}
+	require.NoError(t, json.Unmarshal(b, &got))
+	require.Equal(t, "pkg1", got["Name"])
+	require.Equal(t, map[string]any{"prefix": "def"}, got["Params"])
+	require.Equal(t, "abc", got["Run"].(map[string]any)["Template"])
+	require.Equal(t, "cli", got["Run"].(map[string]any)["Mode"])
+}
+
+func TestMergeParams(t *testing.T) {
+	require.Nil(t, mergeParams(nil, nil))
+	require.Equal(t,
+		map[string]any{"a": 1, "b": "configured", "c": true},
+		mergeParams(map[string]any{"a": 1, "b": "default"}, map[string]any{"b": "configured", "c": true}),
+	)
+}
@@ -0,0 +1,145 @@
+package pkgen
+
+import (
+	"fmt"
+	"strings"
+)
+
+const diffContext = 3
+
+type diffOp struct {
+	kind byte // ' ', '-' or '+'
+	line string
+}
+
+// unifiedDiff returns the unified diff between a and b, or an empty string when
+// they are equal. It is meant for small inputs like rendered templates.
+func unifiedDiff(fromName, toName string, a, b []byte) string {
+	if string(a) == string(b) {
+		return ""
+	}
+
+	ops := diffLines(splitLines(string(a)), splitLines(string(b)))
+
+	sb := strings.Builder{}
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", fromName, toName)
+
+	for start := 0; start < len(ops); {
+		// find the next change
+		for start < len(ops) && ops[start].kind == ' ' {
+			start++
+		}
+		if start == len(ops) {
+			break
+		}
+
+		// extend the hunk while changes are close enough to share context
+		first := max(start-diffContext, 0)
+		end := start
+		for i := start; i < len(ops); i++ {
+			if ops[i].kind != ' ' {
+				end = i + 1
+			} else if i-end >= 2*diffContext {
+				break
+			}
+		}
+		last := min(end+diffContext, len(ops))
+
+		aStart, bStart := lineNumbers(ops, first)
+		aLen, bLen := 0, 0
+		for _, op := range ops[first:last] {
+			if op.kind != '+' {
+				aLen++
+			}
+			if op.kind != '-' {
+				bLen++
+			}
+		}
+
+		// an empty range starts at the line before it, as in GNU diff.
+		if aLen == 0 {
+			aStart--
+		}
+		if bLen == 0 {
+			bStart--
+		}
+
+		fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n", aStart, aLen, bStart, bLen)
+		for _, op := range ops[first:last] {
+			sb.WriteByte(op.kind)
+			sb.WriteString(op.line)
+			sb.WriteByte('\n')
+		}
+
+		start = last
+	}
+
+	return sb.String()
+}
+
+// lineNumbers returns the 1-based line numbers of both sides at the given op.
+func lineNumbers(ops []diffOp, at int) (int, int) {
+	a, b := 1, 1
+	for _, op := range ops[:at] {
+		if op.kind != '+' {
+			a++
+		}
+		if op.kind != '-' {
+			b++
+		}
+	}
+
+	return a, b
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffLines computes the edit script using the longest common subsequence.
+func diffLines(a, b []string) []diffOp {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	ops := make([]diffOp, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{kind: ' ', line: a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{kind: '-', line: a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{kind: '+', line: b[j]})
+			j++
+		}
+	}
+
+	for ; i < len(a); i++ {
+		ops = append(ops, diffOp{kind: '-', line: a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, diffOp{kind: '+', line: b[j]})
+	}
+
+	return ops
+}
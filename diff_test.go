@@ -0,0 +1,67 @@
+package pkgen
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := map[string]struct {
+		a        string
+		b        string
+		expected string
+	}{
+		"equal": {
+			a:        "a\nb\n",
+			b:        "a\nb\n",
+			expected: "",
+		},
+		"changed line": {
+			a: "1\n2\n3\n4\n5\n",
+			b: "1\n2\nthree\n4\n5\n",
+			expected: `--- a
++++ b
+@@ -1,5 +1,5 @@
+ 1
+ 2
+-3
++three
+ 4
+ 5
+`,
+		},
+		"separate hunks": {
+			a: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n",
+			b: "0\n1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n",
+			expected: `--- a
++++ b
+@@ -1,3 +1,4 @@
++0
+ 1
+ 2
+ 3
+@@ -9,4 +10,3 @@
+ 9
+ 10
+ 11
+-12
+`,
+		},
+		"from empty": {
+			a: "",
+			b: "a\n",
+			expected: `--- a
++++ b
+@@ -0,0 +1,1 @@
++a
+`,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, tc.expected, unifiedDiff("a", "b", []byte(tc.a), []byte(tc.b)))
+		})
+	}
+}
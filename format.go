@@ -0,0 +1,71 @@
+package pkgen
+
+import (
+	"errors"
+	"fmt"
+	"go/format"
+	"path/filepath"
+	"sync"
+)
+
+// Formatter post-processes a rendered output before it is written.
+type Formatter func(src []byte) ([]byte, error)
+
+const (
+	FormatNone  = "none"
+	FormatGofmt = "gofmt"
+)
+
+var ErrUnknownFormatter = errors.New("unknown formatter")
+
+var (
+	formattersMu sync.RWMutex
+	formatters   = map[string]Formatter{
+		FormatNone:  func(src []byte) ([]byte, error) { return src, nil },
+		FormatGofmt: format.Source,
+	}
+	// the formatter of the outputs that have no explicit one, per extension.
+	extensionFormatters = map[string]string{
+		".go": FormatGofmt,
+	}
+)
+
+// RegisterFormatter makes f available by name, and the default formatter of
+// the outputs with any of the given extensions (e.g. ".yaml").
+func RegisterFormatter(name string, f Formatter, extensions ...string) {
+	formattersMu.Lock()
+	defer formattersMu.Unlock()
+
+	formatters[name] = f
+	for _, ext := range extensions {
+		extensionFormatters[ext] = name
+	}
+}
+
+// formatFile applies the named formatter to the content of f. Without a name
+// the formatter registered for the extension of f is used, if any.
+func formatFile(name string, f File) (File, error) {
+	formattersMu.RLock()
+	defer formattersMu.RUnlock()
+
+	if name == "" {
+		name = extensionFormatters[filepath.Ext(f.Path)]
+		if name == "" {
+			return f, nil
+		}
+	}
+
+	fm, ok := formatters[name]
+	if !ok {
+		return File{}, fmt.Errorf("%w: %q", ErrUnknownFormatter, name)
+	}
+
+	content, err := fm(f.Content)
+	if err != nil {
+		return File{}, fmt.Errorf("formatting %s (%s): %w", f.Path, f.Template, err)
+	}
+
+	f.Content = content
+
+	return f, nil
+}
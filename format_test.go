@@ -0,0 +1,61 @@
+package pkgen
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"text/template"
+
+	"github.com/ifnotnil/x/tst"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/tools/go/packages"
+)
+
+func TestFormatFile(t *testing.T) {
+	RegisterFormatter("upper", func(src []byte) ([]byte, error) { return bytes.ToUpper(src), nil }, ".upper")
+
+	tests := map[string]struct {
+		format        string
+		path          string
+		content       string
+		expected      string
+		errorAsserter tst.ErrorAssertionFunc
+	}{
+		"go by extension":         {format: "", path: "/tmp/a/x.go", content: "package a\nconst  A = 1\n", expected: "package a\n\nconst A = 1\n", errorAsserter: tst.NoError()},
+		"passthrough by default":  {format: "", path: "/tmp/a/README.md", content: "# a\n\n\n", expected: "# a\n\n\n", errorAsserter: tst.NoError()},
+		"registered by extension": {format: "", path: "/tmp/a/x.upper", content: "abc\n", expected: "ABC\n", errorAsserter: tst.NoError()},
+		"explicit over extension": {format: FormatNone, path: "/tmp/a/x.go", content: "package a\nconst  A = 1\n", expected: "package a\nconst  A = 1\n", errorAsserter: tst.NoError()},
+		"explicit registered":     {format: "upper", path: "/tmp/a/x.txt", content: "abc\n", expected: "ABC\n", errorAsserter: tst.NoError()},
+		"unknown":                 {format: "prettier", path: "/tmp/a/x.go", content: "", expected: "", errorAsserter: tst.ErrorIs(ErrUnknownFormatter)},
+		"invalid go":              {format: "", path: "/tmp/a/x.go", content: "package a\nfunc {\n", expected: "", errorAsserter: tst.Error()},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := formatFile(tc.format, File{Path: tc.path, Content: []byte(tc.content), Mode: 0, DirMode: 0, Package: "", Template: "t", Origin: "", TemplateVersion: "", ParamsHash: "", Delete: false, Sources: nil, Region: ""})
+			tc.errorAsserter(t, err)
+			require.Equal(t, tc.expected, string(got.Content))
+		})
+	}
+}
+
+func TestGenerateNonGoOutput(t *testing.T) {
+	pkgs := []packages.Package{
+		{Name: "svc", PkgPath: "example.com/svc", Dir: "/tmp/svc", GoFiles: []string{"/tmp/svc/svc.go"}},
+		{Name: "docs", PkgPath: "example.com/docs", Dir: "/tmp/docs", GoFiles: nil},
+	}
+
+	readme := textTemplate(template.Must(template.New("readme").Parse("# {{ .PkgPath }}\n")))
+	readme.Output = OutputConfig{Output: "README.md", Mod: 0, Format: "", Region: ""}
+	goTmp := textTemplate(template.Must(template.New("go").Parse("package {{ .Name }}\n")))
+
+	cnf := DefaultConfig.Generate
+
+	mockFW := NewMockFileWriter(t)
+	mockFW.EXPECT().WriteFile("/tmp/svc/README.md", []byte("# example.com/svc\n"), os.FileMode(0o644)).Return(nil)
+	mockFW.EXPECT().WriteFile("/tmp/svc/zz_generated.go.go", []byte("package svc\n"), os.FileMode(0o644)).Return(nil)
+	mockFW.EXPECT().WriteFile("/tmp/docs/README.md", []byte("# example.com/docs\n"), os.FileMode(0o644)).Return(nil)
+
+	err := Generator{FileWriter: mockFW}.Generate(t.Context(), logger(t), pkgs, []Template{readme, goTmp}, cnf)
+	require.NoError(t, err)
+}
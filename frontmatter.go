@@ -0,0 +1,55 @@
+package pkgen
+
+import (
+	"regexp"
+
+	"go.yaml.in/yaml/v4"
+)
+
+// FrontMatter is the template metadata, declared as YAML inside a leading
+// template comment opened with the pkgen marker:
+//
+//	{{- /*pkgen
+//	description: Generates the full package path as a string constant.
+//	params:
+//	  name: default value
+//	output: zz_{{ .PackageName }}.go
+//	scope: file
+//	files:
+//	  include: [handler_*.go]
+//	requires:
+//	  modules: [go.opentelemetry.io/otel@v1.28.0]
+//	*/ -}}
+//
+// Being a comment, it is ignored when the template is rendered.
+type FrontMatter struct {
+	Description string         `json:"description,omitempty" yaml:"description,omitempty"`
+	Params      map[string]any `json:"params,omitempty"      yaml:"params,omitempty"` // declared params with their default values.
+	Requires    Requirements   `json:"requires,omitzero"    yaml:"requires,omitempty"`
+	Scope       string         `json:"scope,omitempty"       yaml:"scope,omitempty"`    // package, file or type, see ScopePackage.
+	Files       FileFilter     `json:"files,omitzero"        yaml:"files,omitempty"`    // the Go files of a file scoped template.
+	PerType     bool           `json:"per_type,omitempty"    yaml:"per_type,omitempty"` // one output per annotated type instead of per package.
+
+	OutputConfig `yaml:",inline"`
+}
+
+var frontMatterRegexp = regexp.MustCompile(`(?s)\A\{\{-?\s*/\*pkgen\s*\n(.*?)\*/\s*-?\}\}`)
+
+func parseFrontMatter(content []byte) (FrontMatter, error) {
+	fm := FrontMatter{}
+
+	m := frontMatterRegexp.FindSubmatch(content)
+	if m == nil {
+		return fm, nil
+	}
+
+	if err := yaml.Unmarshal(m[1], &fm); err != nil {
+		return FrontMatter{}, err
+	}
+
+	if err := validateScope(fm); err != nil {
+		return FrontMatter{}, err
+	}
+
+	return fm, nil
+}
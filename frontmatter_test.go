@@ -0,0 +1,100 @@
+package pkgen
+
+import (
+	"testing"
+
+	"github.com/ifnotnil/x/tst"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFrontMatter(t *testing.T) {
+	tests := map[string]struct {
+		content       string
+		expected      FrontMatter
+		errorAsserter tst.ErrorAssertionFunc
+	}{
+		"no front-matter": {
+			content:       "package {{ .Name }}\n",
+			expected:      FrontMatter{Description: "", Params: nil, Requires: Requirements{}, Scope: "", Files: FileFilter{}, PerType: false, OutputConfig: OutputConfig{}},
+			errorAsserter: tst.NoError(),
+		},
+		"plain leading comment": {
+			content:       "{{/* a comment */}}package {{ .Name }}\n",
+			expected:      FrontMatter{Description: "", Params: nil, Requires: Requirements{}, Scope: "", Files: FileFilter{}, PerType: false, OutputConfig: OutputConfig{}},
+			errorAsserter: tst.NoError(),
+		},
+		"front-matter": {
+			content: `{{- /*pkgen
+description: abc
+params:
+  prefix: def
+  enabled: true
+*/ -}}
+package {{ .Name }}
+`,
+			expected:      FrontMatter{Description: "abc", Params: map[string]any{"prefix": "def", "enabled": true}, Requires: Requirements{}, Scope: "", Files: FileFilter{}, PerType: false, OutputConfig: OutputConfig{}},
+			errorAsserter: tst.NoError(),
+		},
+		"output": {
+			content: `{{- /*pkgen
+output: zz_{{ .PackageName }}.go
+mod: 0o600
+format: gofmt
+*/ -}}
+`,
+			expected:      FrontMatter{Description: "", Params: nil, Requires: Requirements{}, Scope: "", Files: FileFilter{}, PerType: false, OutputConfig: OutputConfig{Output: "zz_{{ .PackageName }}.go", Mod: 0o600, Format: "gofmt", Region: ""}},
+			errorAsserter: tst.NoError(),
+		},
+		"requires": {
+			content: `{{- /*pkgen
+requires:
+  go: "1.22"
+  modules:
+    - go.opentelemetry.io/otel@v1.28.0
+    - go.opentelemetry.io/otel/trace
+*/ -}}
+`,
+			expected:      FrontMatter{Description: "", Params: nil, Requires: Requirements{Go: "1.22", Modules: []string{"go.opentelemetry.io/otel@v1.28.0", "go.opentelemetry.io/otel/trace"}}, Scope: "", Files: FileFilter{}, PerType: false, OutputConfig: OutputConfig{}},
+			errorAsserter: tst.NoError(),
+		},
+		"file scope": {
+			content: `{{- /*pkgen
+scope: file
+files:
+  include: [handler_*.go]
+  exclude: [handler_internal.go]
+*/ -}}
+`,
+			expected:      FrontMatter{Description: "", Params: nil, Requires: Requirements{}, Scope: ScopeFile, Files: FileFilter{Include: []string{"handler_*.go"}, Exclude: []string{"handler_internal.go"}}, PerType: false, OutputConfig: OutputConfig{}},
+			errorAsserter: tst.NoError(),
+		},
+		"unknown scope": {
+			content:       "{{/*pkgen\nscope: module\n*/}}",
+			expected:      FrontMatter{Description: "", Params: nil, Requires: Requirements{}, Scope: "", Files: FileFilter{}, PerType: false, OutputConfig: OutputConfig{}},
+			errorAsserter: tst.ErrorIs(ErrScope),
+		},
+		"malformed file pattern": {
+			content:       "{{/*pkgen\nscope: file\nfiles:\n  include: ['[']\n*/}}",
+			expected:      FrontMatter{Description: "", Params: nil, Requires: Requirements{}, Scope: "", Files: FileFilter{}, PerType: false, OutputConfig: OutputConfig{}},
+			errorAsserter: tst.ErrorIs(ErrScope),
+		},
+		"per type out of the type scope": {
+			content:       "{{/*pkgen\nscope: file\nper_type: true\n*/}}",
+			expected:      FrontMatter{Description: "", Params: nil, Requires: Requirements{}, Scope: "", Files: FileFilter{}, PerType: false, OutputConfig: OutputConfig{}},
+			errorAsserter: tst.ErrorIs(ErrScope),
+		},
+		"malformed front-matter": {
+			content:       "{{/*pkgen\ndescription: [\n*/}}",
+			expected:      FrontMatter{Description: "", Params: nil, Requires: Requirements{}, Scope: "", Files: FileFilter{}, PerType: false, OutputConfig: OutputConfig{}},
+			errorAsserter: tst.Error(),
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := parseFrontMatter([]byte(tc.content))
+			tc.errorAsserter(t, err)
+			require.Equal(t, tc.expected, got)
+		})
+	}
+}
@@ -3,83 +3,713 @@ package pkgen
 import (
 	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"go/token"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
 	"text/template"
 
+	"github.com/samber/lo"
 	"golang.org/x/tools/go/packages"
 )
 
 type FileWriter interface {
 	WriteFile(name string, data []byte, perm os.FileMode) error
+	Remove(name string) error
 }
 
 type Generator struct {
 	FileWriter FileWriter
 }
 
-func (g Generator) GenerateInPackage(ctx context.Context, pkg packages.Package, tmp *template.Template, cnf GenerateConfig) error {
-	if len(pkg.GoFiles) == 0 {
-		return nil
+// File is a rendered output, ready to be written.
+type File struct {
+	Path     string
+	Content  []byte
+	Mode     os.FileMode
+	DirMode  os.FileMode // when set, the missing parent directories are created with it.
+	Package  string      // the package path the file was rendered for, empty for plugin outputs.
+	Template string
+	Origin   string // where the template comes from, for the reports.
+
+	TemplateVersion string
+	ParamsHash      string   // the hash of the template params, see paramsHash.
+	Delete          bool     // the output is no longer produced and is to be removed, see Manifest.
+	Sources         []string // the template position each line of the content was rendered from, e.g. "otel.tmpl:12".
+	Region          string   // the marked regions of a hand-written file the content was inserted in, see withRegions.
+}
+
+func (g Generator) GenerateInPackage(ctx context.Context, pkg packages.Package, tmp Template, cnf GenerateConfig) error {
+	r, err := newRenderer(cnf)
+	if err != nil {
+		return err
 	}
 
-	// execute the template
-	buf := bytes.Buffer{}
-	err := tmp.Execute(&buf, pkg)
+	if err := r.loadTypes(ctx, []packages.Package{pkg}, []Template{tmp}, cnf.Query); err != nil {
+		return err
+	}
+
+	if err := r.loadOwnOutputs([]packages.Package{pkg}, []Template{tmp}, cnf); err != nil {
+		return err
+	}
+
+	files, err := r.renderInPackage(pkg, tmp, cnf)
 	if err != nil {
 		return err
 	}
 
-	// get output filename
-	outFileName, err := generateName(OutputName{TemplateName: tmp.Name()}, cnf.OutputFile)
+	files, err = withRegions(files)
 	if err != nil {
 		return err
 	}
 
-	outPath := filepath.Join(filepath.Clean(pkg.Dir), outFileName)
+	if err := checkOutputs(files, []packages.Package{pkg}, cnf); err != nil {
+		return err
+	}
+
+	return g.writeAll(ctx, files)
+}
+
+// fileTemplatePrefix marks the associated templates that render an additional
+// output file, e.g. {{ define "file:zz_generated.foo_test.go" }}. The rest of
+// the define name is an output name pattern, like the generate output one.
+const fileTemplatePrefix = "file:"
+
+// renderer holds what is parsed or loaded once per run.
+type renderer struct {
+	names          outputNames
+	header         header
+	bundles        map[string]string // the bundle of each bundled template.
+	instrumented   map[*template.Template]instrumented
+	lineDirectives bool
+	fset           *token.FileSet
+	parsed         map[string]*ScopedFile       // the Go files of the file scoped templates, parsed once.
+	typed          map[string]*packages.Package // the packages of the type scoped templates, by ID.
+	own            map[string]bool              // the outputs of the run known before rendering, see loadOwnOutputs.
+}
+
+func newRenderer(cnf GenerateConfig) (renderer, error) {
+	h, err := loadHeader(cnf.Header)
+	if err != nil {
+		return renderer{}, err
+	}
+
+	bundles, err := bundleOf(cnf.Bundles)
+	if err != nil {
+		return renderer{}, err
+	}
+
+	return renderer{
+		names:          outputNames{},
+		header:         h,
+		bundles:        bundles,
+		instrumented:   map[*template.Template]instrumented{},
+		lineDirectives: cnf.LineDirectives,
+		fset:           token.NewFileSet(),
+		parsed:         map[string]*ScopedFile{},
+		typed:          map[string]*packages.Package{},
+		own:            map[string]bool{},
+	}, nil
+}
+
+// instrument returns the instrumented copy of a template, made once per run.
+func (r renderer) instrument(tmp Template) (instrumented, error) {
+	if in, ok := r.instrumented[tmp.Text]; ok {
+		return in, nil
+	}
+
+	in, err := instrument(tmp)
+	if err != nil {
+		return instrumented{}, err
+	}
+	r.instrumented[tmp.Text] = in
+
+	return in, nil
+}
+
+// finish applies the header policy to the Go outputs, then formats them and
+// seals their checksum. The sources follow the content along.
+func (r renderer) finish(f File, tmp Template, format string) (File, error) {
+	if !isGoFile(f.Path) {
+		formatted, err := formatFile(format, f)
+		if err != nil {
+			return File{}, err
+		}
+		formatted.Sources = remapSources(f.Content, f.Sources, formatted.Content)
+
+		return formatted, nil
+	}
+
+	from, sources := f.Content, f.Sources
+
+	content, err := r.header.apply(f.Content, tmp)
+	if err != nil {
+		return File{}, fmt.Errorf("%s (%s): %w", f.Path, tmp.Name, err)
+	}
+	f.Content = content
+
+	f, err = formatFile(format, f)
+	if err != nil {
+		return File{}, withSources(err, remapSources(from, sources, content))
+	}
+
+	f.Sources = remapSources(from, sources, f.Content)
+	// the directives are placed in the formatted content, so that their
+	// positions are not shifted by the formatter.
+	if r.lineDirectives {
+		f.Content, f.Sources = lineDirectives(f.Content, f.Sources)
+	}
+
+	if r.header.checksum != "" {
+		f.Content = seal(f.Content)
+	}
+
+	return f, nil
+}
+
+// output is a template to render and the name pattern of its output file.
+type output struct {
+	text    *template.Template
+	pattern string
+}
+
+func (r renderer) renderInPackage(pkg packages.Package, tmp Template, cnf GenerateConfig) ([]File, error) {
+	files, part, err := r.render(pkg, tmp, cnf)
+	if err != nil || part == nil {
+		return files, err
+	}
+
+	bundled, err := r.bundle([]File{*part}, cnf)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(files, bundled...), nil
+}
+
+// render renders a template in a package, or in each of its Go files or
+// annotated types depending on its scope. The main output of a bundled
+// template is returned apart, as a part of its bundle yet to be finished.
+func (r renderer) render(pkg packages.Package, tmp Template, cnf GenerateConfig) ([]File, *File, error) {
+	switch {
+	case r.bundles[tmp.Name] == "":
+	case tmp.FrontMatter.Scope == ScopeFile:
+		return nil, nil, fmt.Errorf("%w: %s: a file scoped template can not be bundled", ErrScope, tmp.Name)
+	case tmp.FrontMatter.Scope == ScopeType && tmp.FrontMatter.PerType:
+		return nil, nil, fmt.Errorf("%w: %s: a per type template can not be bundled", ErrScope, tmp.Name)
+	}
+
+	scopes, err := r.scopes(pkg, tmp)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// rendered once per package, the main output may be a bundle part.
+	if tmp.FrontMatter.Scope != ScopeFile && !tmp.FrontMatter.PerType {
+		if len(scopes) == 0 {
+			return nil, nil, nil
+		}
+		return r.renderFor(pkg, tmp, cnf, scopes[0].set)
+	}
+
+	files := []File{}
+	for _, s := range scopes {
+		f, _, err := r.renderFor(pkg, tmp, cnf, s.set)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", s.at, err)
+		}
+		files = append(files, f...)
+	}
+
+	return files, nil, nil
+}
+
+// renderScope is what a template is rendered for in a package, besides the
+// package itself: a Go file, or annotated types. at locates it in the errors.
+type renderScope struct {
+	at  string
+	set func(data *TemplateData, name *OutputName)
+}
+
+// scopes returns what a template is rendered for in a package: the package,
+// each of its Go files, or its types annotated for the template, all at once
+// or one by one. Without annotated types, the template is not rendered.
+func (r renderer) scopes(pkg packages.Package, tmp Template) ([]renderScope, error) {
+	switch tmp.FrontMatter.Scope {
+	case ScopeFile:
+		sources, err := r.sourceFiles(pkg, tmp)
+		if err != nil {
+			return nil, err
+		}
+
+		return lo.Map(sources, func(src *ScopedFile, _ int) renderScope {
+			return renderScope{at: src.Path, set: func(data *TemplateData, name *OutputName) {
+				data.File = src
+				name.SourceFile = strings.TrimSuffix(src.Name, ".go")
+			}}
+		}), nil
+	case ScopeType:
+		if len(pkg.GoFiles) == 0 {
+			return nil, nil
+		}
+
+		typed := r.typedPackage(pkg)
+		if typed == nil {
+			return nil, nil
+		}
+
+		annotated, err := annotatedTypes(typed.Fset, typed.Types, typed.Syntax, tmp.Name)
+		if err != nil || len(annotated) == 0 {
+			return nil, err
+		}
+
+		if !tmp.FrontMatter.PerType {
+			return []renderScope{{at: pkg.PkgPath, set: func(data *TemplateData, _ *OutputName) {
+				data.Types = annotated
+			}}}, nil
+		}
+
+		return lo.Map(annotated, func(a *AnnotatedType, _ int) renderScope {
+			return renderScope{at: a.Pos, set: func(data *TemplateData, name *OutputName) {
+				data.Types = []*AnnotatedType{a}
+				data.Type = a
+				name.TypeName = a.Name
+			}}
+		}), nil
+	default:
+		return []renderScope{{at: pkg.PkgPath, set: nil}}, nil
+	}
+}
+
+// renderFor renders a template in a package, with the data of its scope set
+// by scoped, if any.
+func (r renderer) renderFor(pkg packages.Package, tmp Template, cnf GenerateConfig, scoped func(data *TemplateData, name *OutputName)) ([]File, *File, error) {
+	bundle := r.bundles[tmp.Name]
+	region := cnf.regionOf(tmp)
+	base := cnf
+	cnf = cnf.forTemplate(tmp)
+
+	if bundle != "" && region != "" {
+		return nil, nil, fmt.Errorf("%w: %s: a bundled template can not render into a region", ErrRegion, tmp.Name)
+	}
+
+	outputs := []output{{text: tmp.Text, pattern: cnf.OutputFile}}
+	if bundle != "" {
+		outputs[0].pattern = base.OutputFile
+	}
+	for _, ft := range fileTemplates(tmp) {
+		outputs = append(outputs, output{text: ft, pattern: strings.TrimPrefix(ft.Name(), fileTemplatePrefix)})
+	}
+
+	data, err := r.templateData(pkg, tmp, cnf)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	in, err := r.instrument(tmp)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	files := make([]File, 0, len(outputs))
+	var part *File
+
+	for i, o := range outputs {
+		name := NewOutputName(pkg, tmp)
+		if scoped != nil {
+			scoped(&data, &name)
+		}
+		if i == 0 && bundle != "" {
+			name.TemplateName = bundle
+		}
+
+		p, err := outputPath(data, r.names, name, o.pattern)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// a directory without Go files only gets the non Go outputs.
+		if len(pkg.GoFiles) == 0 && isGoFile(p) {
+			continue
+		}
+
+		buf := bytes.Buffer{}
+		if err := in.text.Lookup(o.text.Name()).Execute(&buf, data); err != nil {
+			return nil, nil, err
+		}
+		content, sources := in.strip(buf.Bytes())
+
+		// a template made only of file blocks does not produce the default output.
+		if i == 0 && len(outputs) > 1 && len(bytes.TrimSpace(content)) == 0 {
+			continue
+		}
+
+		// the region is inserted in its target once every output is rendered.
+		if i == 0 && region != "" {
+			files = append(files, regionFile(data, content, sources, tmp, p, region))
+			continue
+		}
+
+		if i == 0 && bundle != "" {
+			f, err := r.rawFile(data, content, sources, tmp, p, base)
+			if err != nil {
+				return nil, nil, err
+			}
+			part = &f
+			continue
+		}
+
+		f, err := r.outputFile(data, content, sources, tmp, p, cnf)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		files = append(files, f)
+	}
+
+	return files, part, nil
+}
+
+// fileTemplates returns the associated templates of tmp that render an
+// additional output file, by name.
+func fileTemplates(tmp Template) []*template.Template {
+	fts := lo.Filter(tmp.Text.Templates(), func(t *template.Template, _ int) bool {
+		return strings.HasPrefix(t.Name(), fileTemplatePrefix)
+	})
+	slices.SortFunc(fts, func(a, b *template.Template) int { return strings.Compare(a.Name(), b.Name()) })
+
+	return fts
+}
+
+func isGoFile(p string) bool {
+	return filepath.Ext(p) == ".go"
+}
+
+func outputPath(data TemplateData, names outputNames, name OutputName, pattern string) (string, error) {
+	outFileName, err := names.generate(name, pattern)
+	if err != nil {
+		return "", err
+	}
+
+	// joined onto the package dir an absolute name would silently become relative.
+	if filepath.IsAbs(outFileName) {
+		return "", fmt.Errorf("%w: %s: absolute output name", ErrOutputPath, outFileName)
+	}
+
+	return filepath.Join(filepath.Clean(data.Output.Dir), outFileName), nil
+}
+
+func (r renderer) outputFile(data TemplateData, content []byte, sources []string, tmp Template, p string, cnf GenerateConfig) (File, error) {
+	f, err := r.rawFile(data, content, sources, tmp, p, cnf)
+	if err != nil {
+		return File{}, err
+	}
+
+	return r.finish(f, tmp, cnf.Format)
+}
+
+// rawFile is the output file before the header and the formatting.
+func (r renderer) rawFile(data TemplateData, content []byte, sources []string, tmp Template, p string, cnf GenerateConfig) (File, error) {
+	// outputs written out of their package belong to the output one.
+	dirMode := os.FileMode(0)
+	if data.Output.Dir != data.Dir {
+		dirMode = cnf.OutputDirMod
+		if isGoFile(p) {
+			renamed, err := renamePackage(content, data.Output.Name)
+			if err != nil {
+				return File{}, fmt.Errorf("%s (%s): %w", p, tmp.Name, err)
+			}
+			content, sources = renamed, remapSources(content, sources, renamed)
+		}
+	}
+
+	return File{
+		Path:     p,
+		Content:  content,
+		Mode:     cnf.OutputFileMod,
+		DirMode:  dirMode,
+		Package:  data.PkgPath,
+		Template: tmp.Name,
+		Origin:   tmp.Origin(),
+
+		TemplateVersion: tmp.Version,
+		ParamsHash:      paramsHash(tmp.Params),
+		Delete:          false,
+		Sources:         sources,
+		Region:          "",
+	}, nil
+}
 
+func (g Generator) write(f File) error {
 	var wf func(name string, data []byte, perm os.FileMode) error
 
 	if g.FileWriter != nil {
 		wf = g.FileWriter.WriteFile
 	} else {
-		wf = os.WriteFile
+		wf = atomicWriteFile
 	}
 
-	return wf(outPath, buf.Bytes(), cnf.OutputFileMod)
+	return wf(f.Path, f.Content, f.Mode)
 }
 
-func (g Generator) Generate(ctx context.Context, logger *slog.Logger, pkgs []packages.Package, tmps []*template.Template, cnf GenerateConfig) error {
+func (g Generator) remove(path string) error {
+	if g.FileWriter != nil {
+		return g.FileWriter.Remove(path)
+	}
+
+	return os.Remove(path)
+}
+
+func (g Generator) Generate(ctx context.Context, logger *slog.Logger, pkgs []packages.Package, tmps []Template, cnf GenerateConfig) error {
+	files, err := g.Render(ctx, logger, pkgs, tmps, cnf)
+	if err != nil {
+		return err
+	}
+
+	// only when writing, status and plan report the edited files.
+	if cnf.Header.Checksum != "" {
+		if err := checkEdits(ctx, logger, files, cnf.Header.Checksum); err != nil {
+			return err
+		}
+	}
+
+	// everything is rendered before the first write, and written all or nothing.
+	tx, err := g.writeTx(ctx, files)
+	if err != nil {
+		logger.ErrorContext(ctx, "error while writing files, the written ones were restored", slog.Int("files", len(files)))
+		return err
+	}
+
+	if !cnf.Verify {
+		return nil
+	}
+
+	failing, err := verify(ctx, files, cnf.Query)
+	if err == nil {
+		return nil
+	}
+
+	// Without failing packages the verification itself failed, so everything
+	// is restored. Otherwise the failing packages are, and the manifests record
+	// their old outputs again.
+	if failing == nil {
+		rerr := tx.rollback()
+		logger.ErrorContext(ctx, "error while verifying the generated files, the written ones were restored", slog.Int("files", len(files)))
+
+		return errors.Join(err, rerr)
+	}
+
+	rerr := tx.rollbackOnly(func(path string) bool { return failing[filepath.Dir(path)] })
+	rerr = errors.Join(rerr, g.restoreManifests(tx, files, failing, cnf))
+	logger.ErrorContext(ctx, "error while verifying the generated files, the failing packages were restored", slog.Int("packages", len(failing)))
+
+	return errors.Join(err, rerr)
+}
+
+// Render renders every template for every package in memory, without writing
+// anything. With a manifest, the result also holds the updated manifests and
+// the removal of the outputs no longer produced.
+func (g Generator) Render(ctx context.Context, logger *slog.Logger, pkgs []packages.Package, tmps []Template, cnf GenerateConfig) ([]File, error) {
 	logger.DebugContext(ctx, "generating", slog.Int("packages", len(pkgs)), slog.Int("templates", len(tmps)))
 
+	if err := cnf.checkTemplateOutputs(tmps); err != nil {
+		return nil, err
+	}
+
+	if err := cnf.checkBundles(tmps); err != nil {
+		return nil, err
+	}
+
+	r, err := newRenderer(cnf)
+	if err != nil {
+		return nil, err
+	}
+	pkgs = withoutOutputPackages(pkgs, cnf.OutputRoot, r.names)
+
+	if err := checkLoaded(pkgs); err != nil {
+		return nil, err
+	}
+
+	// before rendering, so that a module missing a requirement fails early.
+	requirements, err := checkRequirements(pkgs, tmps, cnf.AddRequires)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.loadTypes(ctx, pkgs, tmps, cnf.Query); err != nil {
+		return nil, err
+	}
+
+	if err := r.loadOwnOutputs(pkgs, tmps, cnf); err != nil {
+		return nil, err
+	}
+
+	files := []File{}
+
 	for _, p := range pkgs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		if testMain(p) {
+			continue
+		}
+
+		pkgFiles := []File{}
+		parts := []File{}
 		for _, tmp := range tmps {
-			logger.DebugContext(ctx, "generating", slog.String("package", p.Name), slog.String("dir", p.Dir), slog.String("template", tmp.Name()))
-			if err := g.GenerateInPackage(ctx, p, tmp, cnf); err != nil {
-				logger.ErrorContext(ctx, "error while rendering file", slog.String("package", p.Name), slog.String("dir", p.Dir), slog.String("template", tmp.Name()))
-				return err
+			if tmp.IsPlugin() {
+				continue
 			}
+			logger.DebugContext(ctx, "generating", slog.String("package", p.Name), slog.String("dir", p.Dir), slog.String("template", tmp.Name))
+			f, part, err := r.render(p, tmp, cnf)
+			if err != nil {
+				logger.ErrorContext(ctx, "error while rendering file", slog.String("package", p.Name), slog.String("dir", p.Dir), slog.String("template", tmp.Name))
+				return nil, err
+			}
+			pkgFiles = append(pkgFiles, f...)
+			if part != nil {
+				parts = append(parts, *part)
+			}
+		}
+
+		bundled, err := r.bundle(parts, cnf)
+		if err != nil {
+			logger.ErrorContext(ctx, "error while bundling files", slog.String("package", p.Name), slog.String("dir", p.Dir))
+			return nil, err
 		}
+		pkgFiles = append(pkgFiles, bundled...)
+
+		// a test variant shares the directory of its package, it only adds
+		// test files to it.
+		if testVariant(p) {
+			pkgFiles = lo.Filter(pkgFiles, func(f File, _ int) bool { return strings.HasSuffix(f.Path, "_test.go") })
+		}
+		files = append(files, pkgFiles...)
 	}
 
-	return nil
+	// plugins run once for the whole batch of packages.
+	for _, tmp := range tmps {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		if !tmp.IsPlugin() {
+			continue
+		}
+		logger.DebugContext(ctx, "running plugin", slog.String("template", tmp.Name), slog.String("plugin", tmp.Plugin))
+		f, err := r.renderPlugin(ctx, logger, pkgs, tmp, cnf)
+		if err != nil {
+			logger.ErrorContext(ctx, "error while running plugin", slog.String("template", tmp.Name), slog.String("plugin", tmp.Plugin))
+			return nil, err
+		}
+		files = append(files, f...)
+	}
+
+	files, err = withRegions(files)
+	if err != nil {
+		return nil, err
+	}
+
+	files = collapseVariants(files)
+
+	if err := checkOutputs(files, pkgs, cnf); err != nil {
+		return nil, err
+	}
+
+	files, err = withManifests(logger, files, pkgs, tmps, cnf)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkIdentifiers(files, cnf.Query); err != nil {
+		return nil, err
+	}
+
+	if len(requirements) > 0 {
+		logger.InfoContext(ctx, "adding the module requirements of the templates, the modules they depend on may need a go mod tidy", slog.Int("files", len(requirements)))
+	}
+
+	return append(files, requirements...), nil
 }
 
 const defaultOutputNameTemplate = `zz_generated.{{ .TemplateName }}.go`
 
+// OutputName is the data of the output name patterns.
 type OutputName struct {
 	TemplateName string
+	PackageName  string
+	PkgPath      string
+	RelDir       string // the package dir relative to the module root, empty outside a module.
+	ModulePath   string
+	IsTest       bool // the package is a test variant, e.g. "p [p.test]" or "p_test".
+	Params       map[string]any
+	GoFile       string // the go:generate source file name without its extension, empty outside go:generate.
+	SourceFile   string // the name without its extension of the Go file a file scoped template is rendered for.
+	TypeName     string // the type a per type template is rendered for.
+	GOOS         string
+	GOARCH       string
 }
 
-func generateName(n OutputName, tmpl string) (string, error) {
-	t, err := template.New("outputName_" + n.TemplateName).Parse(tmpl)
-	if err != nil {
-		return "", err
+func NewOutputName(pkg packages.Package, tmp Template) OutputName {
+	n := OutputName{
+		TemplateName: tmp.Name,
+		PackageName:  pkg.Name,
+		PkgPath:      pkg.PkgPath,
+		RelDir:       "",
+		ModulePath:   "",
+		IsTest:       testVariant(pkg),
+		Params:       tmp.Params,
+		GoFile:       strings.TrimSuffix(os.Getenv("GOFILE"), ".go"),
+		SourceFile:   "",
+		TypeName:     "",
+		GOOS:         firstNotEmpty(os.Getenv("GOOS"), runtime.GOOS),
+		GOARCH:       firstNotEmpty(os.Getenv("GOARCH"), runtime.GOARCH),
+	}
+
+	if pkg.Module != nil {
+		n.ModulePath = pkg.Module.Path
+		if rel, err := filepath.Rel(pkg.Module.Dir, pkg.Dir); err == nil {
+			n.RelDir = filepath.ToSlash(rel)
+		}
+	}
+
+	return n
+}
+
+// testVariant reports whether pkg is a test variant of a package, e.g.
+// "p [p.test]", "p_test" or the test main "p.test".
+func testVariant(pkg packages.Package) bool {
+	return strings.HasSuffix(pkg.Name, "_test") || strings.HasSuffix(pkg.ID, ".test]") || testMain(pkg)
+}
+
+// testMain reports whether pkg is the main package go test synthesizes for
+// the tests of a package, whose files are in the build cache.
+func testMain(pkg packages.Package) bool {
+	return pkg.Name == "main" && strings.HasSuffix(pkg.ID, ".test") && pkg.ID == pkg.PkgPath
+}
+
+// outputNames parses each output name pattern once per run.
+type outputNames map[string]*template.Template
+
+func (o outputNames) generate(n OutputName, pattern string) (string, error) {
+	t, ok := o[pattern]
+	if !ok {
+		var err error
+		t, err = template.New("output").Parse(pattern)
+		if err != nil {
+			return "", err
+		}
+		o[pattern] = t
 	}
 
 	buf := bytes.Buffer{}
-	err = t.Execute(&buf, n)
+	err := t.Execute(&buf, n)
 	if err != nil {
 		return "", err
 	}
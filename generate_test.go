@@ -1,6 +1,7 @@
 package pkgen
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"testing"
@@ -23,17 +24,44 @@ package abc
 const PackagePath = "def"
 `
 
+func textTemplate(t *template.Template) Template {
+	return Template{Name: t.Name(), Version: "", Source: SourceFile, Path: "", Text: t, Plugin: "", FrontMatter: FrontMatter{}, Params: nil, Output: OutputConfig{}}
+}
+
+// testModule copies the testdata module, packages a and b of example.com/m, to
+// a temporary directory and returns it with its packages.
+func testModule(t *testing.T) (string, []packages.Package) {
+	t.Helper()
+
+	module := t.TempDir()
+	require.NoError(t, os.CopyFS(module, os.DirFS(filepath.Join("testdata", "module"))))
+
+	pkgs := []packages.Package{}
+	for _, name := range []string{"a", "b"} {
+		dir := filepath.Join(module, name)
+		pkgs = append(pkgs, packages.Package{
+			ID:      "example.com/m/" + name,
+			Name:    name,
+			PkgPath: "example.com/m/" + name,
+			Dir:     dir,
+			GoFiles: []string{filepath.Join(dir, name+".go")},
+			Module:  &packages.Module{Path: "example.com/m", Dir: module, GoMod: filepath.Join(module, "go.mod")},
+		})
+	}
+
+	return module, pkgs
+}
+
 func TestGenerateInPackage(t *testing.T) {
 	t.Run("write actual file", func(t *testing.T) {
 		tmpDir := t.TempDir()
 		t.Chdir(tmpDir)
 
 		pkg := packages.Package{Name: "abc", PkgPath: "def", GoFiles: []string{filepath.Join(tmpDir, "random.go")}}
-		tmp, err := template.New("abc").Parse(templateStr)
-		require.NoError(t, err)
+		tmp := textTemplate(template.Must(template.New("abc").Parse(templateStr)))
 		cnf := DefaultConfig.Generate
 
-		err = Generator{}.GenerateInPackage(t.Context(), pkg, tmp, cnf)
+		err := Generator{}.GenerateInPackage(t.Context(), pkg, tmp, cnf)
 		require.NoError(t, err)
 
 		// read and evaluate the generated file
@@ -46,7 +74,7 @@ func TestGenerateInPackage(t *testing.T) {
 func TestGenerate(t *testing.T) {
 	tests := map[string]struct {
 		packages      []packages.Package
-		templates     []*template.Template
+		templates     []Template
 		config        GenerateConfig
 		mockInit      func(*MockFileWriter)
 		errorAsserter tst.ErrorAssertionFunc
@@ -67,15 +95,27 @@ func TestGenerate(t *testing.T) {
 					GoFiles: []string{"/tmp/testpkg/file.go"},
 				},
 			},
-			templates: []*template.Template{
-				template.Must(template.New("test").Parse("package {{ .Name }}\nconst Path = \"{{ .PkgPath }}\"\n")),
+			templates: []Template{
+				textTemplate(template.Must(template.New("test").Parse("package {{ .Name }}\nconst Path = \"{{ .PkgPath }}\"\n"))),
 			},
 			config: GenerateConfig{
-				OutputFile:    "zz_generated.{{ .TemplateName }}.go",
-				OutputFileMod: 0o644,
+				OutputFile:        "zz_generated.{{ .TemplateName }}.go",
+				OutputFileMod:     0o644,
+				Format:            "",
+				OutputRoot:        "",
+				OutputDirMod:      0,
+				Header:            HeaderConfig{LicenseFile: "", Marker: false, Build: "", Checksum: ""},
+				Manifest:          "",
+				Verify:            false,
+				Bundles:           nil,
+				AddRequires:       false,
+				LineDirectives:    false,
+				AllowedOutputDirs: nil,
+				TemplateOutputs:   nil,
+				Query:             PackagesQueryConfig{},
 			},
 			mockInit: func(m *MockFileWriter) {
-				m.EXPECT().WriteFile("/tmp/testpkg/zz_generated.test.go", []byte("package testpkg\nconst Path = \"example.com/testpkg\"\n"), os.FileMode(0o644)).Return(nil)
+				m.EXPECT().WriteFile("/tmp/testpkg/zz_generated.test.go", []byte("package testpkg\n\nconst Path = \"example.com/testpkg\"\n"), os.FileMode(0o644)).Return(nil)
 			},
 			errorAsserter: tst.NoError(),
 		},
@@ -94,13 +134,25 @@ func TestGenerate(t *testing.T) {
 					GoFiles: []string{"/tmp/pkg2/file.go"},
 				},
 			},
-			templates: []*template.Template{
-				template.Must(template.New("tmpl1").Parse("package {{ .Name }}\n")),
-				template.Must(template.New("tmpl2").Parse("// {{ .PkgPath }}\n")),
+			templates: []Template{
+				textTemplate(template.Must(template.New("tmpl1").Parse("package {{ .Name }}\n"))),
+				textTemplate(template.Must(template.New("tmpl2").Parse("// {{ .PkgPath }}\n"))),
 			},
 			config: GenerateConfig{
-				OutputFile:    "zz.{{ .TemplateName }}.go",
-				OutputFileMod: 0o644,
+				OutputFile:        "zz.{{ .TemplateName }}.go",
+				OutputFileMod:     0o644,
+				Format:            "",
+				OutputRoot:        "",
+				OutputDirMod:      0,
+				Header:            HeaderConfig{LicenseFile: "", Marker: false, Build: "", Checksum: ""},
+				Manifest:          "",
+				Verify:            false,
+				Bundles:           nil,
+				AddRequires:       false,
+				LineDirectives:    false,
+				AllowedOutputDirs: nil,
+				TemplateOutputs:   nil,
+				Query:             PackagesQueryConfig{},
 			},
 			mockInit: func(m *MockFileWriter) {
 				m.EXPECT().WriteFile("/tmp/pkg1/zz.tmpl1.go", []byte("package pkg1\n"), os.FileMode(0o644)).Return(nil)
@@ -119,12 +171,24 @@ func TestGenerate(t *testing.T) {
 					GoFiles: []string{},
 				},
 			},
-			templates: []*template.Template{
-				template.Must(template.New("test").Parse("package {{ .Name }}\n")),
+			templates: []Template{
+				textTemplate(template.Must(template.New("test").Parse("package {{ .Name }}\n"))),
 			},
 			config: GenerateConfig{
-				OutputFile:    "zz_generated.{{ .TemplateName }}.go",
-				OutputFileMod: 0o644,
+				OutputFile:        "zz_generated.{{ .TemplateName }}.go",
+				OutputFileMod:     0o644,
+				Format:            "",
+				OutputRoot:        "",
+				OutputDirMod:      0,
+				Header:            HeaderConfig{LicenseFile: "", Marker: false, Build: "", Checksum: ""},
+				Manifest:          "",
+				Verify:            false,
+				Bundles:           nil,
+				AddRequires:       false,
+				LineDirectives:    false,
+				AllowedOutputDirs: nil,
+				TemplateOutputs:   nil,
+				Query:             PackagesQueryConfig{},
 			},
 			mockInit:      func(m *MockFileWriter) {},
 			errorAsserter: tst.NoError(),
@@ -138,12 +202,24 @@ func TestGenerate(t *testing.T) {
 					GoFiles: []string{"/tmp/testpkg/file.go"},
 				},
 			},
-			templates: []*template.Template{
-				template.Must(template.New("bad").Parse("{{ .NonExistentField }}")),
+			templates: []Template{
+				textTemplate(template.Must(template.New("bad").Parse("{{ .NonExistentField }}"))),
 			},
 			config: GenerateConfig{
-				OutputFile:    "zz_generated.{{ .TemplateName }}.go",
-				OutputFileMod: 0o644,
+				OutputFile:        "zz_generated.{{ .TemplateName }}.go",
+				OutputFileMod:     0o644,
+				Format:            "",
+				OutputRoot:        "",
+				OutputDirMod:      0,
+				Header:            HeaderConfig{LicenseFile: "", Marker: false, Build: "", Checksum: ""},
+				Manifest:          "",
+				Verify:            false,
+				Bundles:           nil,
+				AddRequires:       false,
+				LineDirectives:    false,
+				AllowedOutputDirs: nil,
+				TemplateOutputs:   nil,
+				Query:             PackagesQueryConfig{},
 			},
 			mockInit:      func(m *MockFileWriter) {},
 			errorAsserter: tst.Error(),
@@ -157,12 +233,24 @@ func TestGenerate(t *testing.T) {
 					GoFiles: []string{"/tmp/testpkg/file.go"},
 				},
 			},
-			templates: []*template.Template{
-				template.Must(template.New("test").Parse("package {{ .Name }}\n")),
+			templates: []Template{
+				textTemplate(template.Must(template.New("test").Parse("package {{ .Name }}\n"))),
 			},
 			config: GenerateConfig{
-				OutputFile:    "zz_generated.{{ .TemplateName }}.go",
-				OutputFileMod: 0o644,
+				OutputFile:        "zz_generated.{{ .TemplateName }}.go",
+				OutputFileMod:     0o644,
+				Format:            "",
+				OutputRoot:        "",
+				OutputDirMod:      0,
+				Header:            HeaderConfig{LicenseFile: "", Marker: false, Build: "", Checksum: ""},
+				Manifest:          "",
+				Verify:            false,
+				Bundles:           nil,
+				AddRequires:       false,
+				LineDirectives:    false,
+				AllowedOutputDirs: nil,
+				TemplateOutputs:   nil,
+				Query:             PackagesQueryConfig{},
 			},
 			mockInit: func(m *MockFileWriter) {
 				m.EXPECT().WriteFile("/tmp/testpkg/zz_generated.test.go", []byte("package testpkg\n"), os.FileMode(0o644)).Return(os.ErrPermission)
@@ -186,3 +274,222 @@ func TestGenerate(t *testing.T) {
 		})
 	}
 }
+
+func TestGenerateMultipleFiles(t *testing.T) {
+	tests := map[string]struct {
+		template string
+		mockInit func(*MockFileWriter)
+	}{
+		"main output and file blocks": {
+			template: `package {{ .Name }}
+{{ define "file:zz_generated.{{ .TemplateName }}_test.go" }}package {{ .Name }}_test
+{{ end }}{{ define "file:doc.txt" }}{{ .PkgPath }}{{ end }}`,
+			mockInit: func(m *MockFileWriter) {
+				m.EXPECT().WriteFile("/tmp/testpkg/zz_generated.multi.go", []byte("package testpkg\n"), os.FileMode(0o644)).Return(nil)
+				m.EXPECT().WriteFile("/tmp/testpkg/zz_generated.multi_test.go", []byte("package testpkg_test\n"), os.FileMode(0o644)).Return(nil)
+				m.EXPECT().WriteFile("/tmp/testpkg/doc.txt", []byte("example.com/testpkg"), os.FileMode(0o644)).Return(nil)
+			},
+		},
+		"only file blocks": {
+			template: `{{ define "file:a.go" }}package {{ .Name }}
+{{ end }}
+{{ define "file:b.go" }}package {{ .Name }}
+{{ end }}
+`,
+			mockInit: func(m *MockFileWriter) {
+				m.EXPECT().WriteFile("/tmp/testpkg/a.go", []byte("package testpkg\n"), os.FileMode(0o644)).Return(nil)
+				m.EXPECT().WriteFile("/tmp/testpkg/b.go", []byte("package testpkg\n"), os.FileMode(0o644)).Return(nil)
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			mockFW := NewMockFileWriter(t)
+			tc.mockInit(mockFW)
+
+			pkg := packages.Package{Name: "testpkg", PkgPath: "example.com/testpkg", Dir: "/tmp/testpkg", GoFiles: []string{"/tmp/testpkg/file.go"}}
+			tmp := textTemplate(template.Must(template.New("multi").Parse(tc.template)))
+
+			err := Generator{FileWriter: mockFW}.GenerateInPackage(t.Context(), pkg, tmp, DefaultConfig.Generate)
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestGenerateInPackageOutputPaths(t *testing.T) {
+	pkg := packages.Package{Name: "testpkg", PkgPath: "example.com/testpkg", Dir: "/tmp/testpkg", GoFiles: []string{"/tmp/testpkg/file.go"}}
+	tmp := textTemplate(template.Must(template.New("escape").Parse(`package {{ .Name }}
+{{ define "file:../escape.go" }}package {{ .Name }}
+{{ end }}`)))
+
+	// no write expectations: nothing is written outside of the package.
+	err := Generator{FileWriter: NewMockFileWriter(t)}.GenerateInPackage(t.Context(), pkg, tmp, DefaultConfig.Generate)
+	require.ErrorIs(t, err, ErrOutputPath)
+}
+
+func TestGenerateCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	pkgs := []packages.Package{{Name: "testpkg", PkgPath: "example.com/testpkg", Dir: "/tmp/testpkg", GoFiles: []string{"/tmp/testpkg/file.go"}}}
+	tmps := []Template{textTemplate(template.Must(template.New("test").Parse("package {{ .Name }}\n")))}
+
+	// no write expectations: nothing is written once cancelled.
+	err := Generator{FileWriter: NewMockFileWriter(t)}.Generate(ctx, logger(t), pkgs, tmps, DefaultConfig.Generate)
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestNewOutputName(t *testing.T) {
+	t.Setenv("GOFILE", "service.go")
+	t.Setenv("GOOS", "plan9")
+	t.Setenv("GOARCH", "arm")
+
+	pkg := packages.Package{
+		ID:      "example.com/m/internal/svc [example.com/m/internal/svc.test]",
+		Name:    "svc",
+		PkgPath: "example.com/m/internal/svc",
+		Dir:     "/tmp/m/internal/svc",
+		Module:  &packages.Module{Path: "example.com/m", Dir: "/tmp/m"},
+	}
+	tmp := textTemplate(template.Must(template.New("otel").Parse("")))
+	tmp.Params = map[string]any{"prefix": "x"}
+
+	got := NewOutputName(pkg, tmp)
+	require.Equal(t, OutputName{
+		TemplateName: "otel",
+		PackageName:  "svc",
+		PkgPath:      "example.com/m/internal/svc",
+		RelDir:       "internal/svc",
+		ModulePath:   "example.com/m",
+		IsTest:       true,
+		Params:       map[string]any{"prefix": "x"},
+		GoFile:       "service",
+		GOOS:         "plan9",
+		GOARCH:       "arm",
+	}, got)
+
+	names := outputNames{}
+	for range 2 {
+		name, err := names.generate(got, `{{ .GoFile }}_{{ .PackageName }}_{{ .Params.prefix }}_{{ .GOOS }}{{ if .IsTest }}_test{{ end }}.go`)
+		require.NoError(t, err)
+		require.Equal(t, "service_svc_x_plan9_test.go", name)
+	}
+	require.Len(t, names, 1)
+}
+
+func TestGeneratePerTemplateOutput(t *testing.T) {
+	pkgs := []packages.Package{{Name: "pkg", PkgPath: "example.com/pkg", Dir: "/tmp/pkg", GoFiles: []string{"/tmp/pkg/pkg.go"}}}
+
+	pkgpath := textTemplate(template.Must(template.New("pkgpath").Parse("package {{ .Name }}\nconst   Path = \"{{ .PkgPath }}\"\n")))
+	pkgpath.Output = OutputConfig{Output: "pkgpath.go", Mod: 0o600, Format: FormatGofmt, Region: ""}
+
+	otel := textTemplate(template.Must(template.New("otel").Parse("package {{ .Name }}\n")))
+
+	cnf := GenerateConfig{
+		OutputFile:        "zz_generated.{{ .TemplateName }}.go",
+		OutputFileMod:     0o644,
+		Format:            "",
+		OutputRoot:        "",
+		OutputDirMod:      0,
+		Header:            HeaderConfig{LicenseFile: "", Marker: false, Build: "", Checksum: ""},
+		Manifest:          "",
+		Verify:            false,
+		Bundles:           nil,
+		AddRequires:       false,
+		LineDirectives:    false,
+		AllowedOutputDirs: nil,
+		TemplateOutputs:   map[string]OutputConfig{"otel": {Output: "zz_otel.go", Mod: 0, Format: "", Region: ""}},
+		Query:             PackagesQueryConfig{},
+	}
+
+	mockFW := NewMockFileWriter(t)
+	mockFW.EXPECT().WriteFile("/tmp/pkg/pkgpath.go", []byte("package pkg\n\nconst Path = \"example.com/pkg\"\n"), os.FileMode(0o600)).Return(nil)
+	mockFW.EXPECT().WriteFile("/tmp/pkg/zz_otel.go", []byte("package pkg\n"), os.FileMode(0o644)).Return(nil)
+
+	err := Generator{FileWriter: mockFW}.Generate(t.Context(), logger(t), pkgs, []Template{pkgpath, otel}, cnf)
+	require.NoError(t, err)
+
+	t.Run("unknown formatter", func(t *testing.T) {
+		cnf := cnf
+		cnf.Format = "prettier"
+		err := Generator{FileWriter: NewMockFileWriter(t)}.Generate(t.Context(), logger(t), pkgs, []Template{otel}, cnf)
+		require.ErrorIs(t, err, ErrUnknownFormatter)
+	})
+
+	t.Run("gofmt error", func(t *testing.T) {
+		broken := textTemplate(template.Must(template.New("broken").Parse("package {{ .Name }}\nfunc {\n")))
+		broken.Output.Format = FormatGofmt
+		err := Generator{FileWriter: NewMockFileWriter(t)}.Generate(t.Context(), logger(t), pkgs, []Template{otel, broken}, cnf)
+		require.ErrorContains(t, err, "formatting /tmp/pkg/zz_generated.broken.go (broken)")
+	})
+
+	t.Run("versioned", func(t *testing.T) {
+		versioned := pkgpath
+		versioned.Version = "v1"
+		cnf := cnf
+		cnf.TemplateOutputs = map[string]OutputConfig{
+			"pkgpath":    {Output: "other.go", Mod: 0o644, Format: "", Region: ""},
+			"pkgpath@v1": {Output: "pp.go", Mod: 0, Format: "", Region: ""},
+		}
+
+		files, err := Generator{FileWriter: nil}.Render(t.Context(), logger(t), pkgs, []Template{versioned}, cnf)
+		require.NoError(t, err)
+		require.Len(t, files, 1)
+		require.Equal(t, "/tmp/pkg/pp.go", files[0].Path, "the name@version flags take precedence")
+		require.Equal(t, os.FileMode(0o644), files[0].Mode)
+	})
+
+	t.Run("unknown template", func(t *testing.T) {
+		for _, key := range []string{"tracing", "otel@v2"} {
+			cnf := cnf
+			cnf.TemplateOutputs = map[string]OutputConfig{key: {Output: "x.go", Mod: 0, Format: "", Region: ""}}
+
+			_, err := Generator{FileWriter: nil}.Render(t.Context(), logger(t), pkgs, []Template{otel}, cnf)
+			require.ErrorIs(t, err, ErrTemplateNotFound, key)
+		}
+	})
+}
+
+func TestGenerateIncludeTests(t *testing.T) {
+	t.Setenv("GOWORK", "off")
+
+	module := t.TempDir()
+	dir := filepath.Join(module, "a")
+	require.NoError(t, os.MkdirAll(dir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(module, "go.mod"), []byte("module example.com/m\n\ngo 1.22\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.go"), []byte("package a\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a_test.go"), []byte("package a\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "x_test.go"), []byte("package a_test\n"), 0o600))
+
+	q := DefaultConfig.PackagesQuery
+	q.IncludeTests = true
+	q.Dir = module
+	q.Patterns = []string{"./..."}
+	pkgs, err := Packages{}.Query(t.Context(), q)
+	require.NoError(t, err)
+	require.Len(t, pkgs, 4, "the package, its test variants and the test main")
+
+	tmps := []Template{
+		textTemplate(template.Must(template.New("plain").Parse("package {{ .Name }}\n"))),
+		textTemplate(template.Must(template.New("tests").Parse(`package {{ .Name }}
+{{ define "file:zz_generated.shared_test.go" }}package a_test
+{{ end }}`))),
+	}
+	tmps[1].Output = OutputConfig{Output: "zz_{{ .PackageName }}_{{ .TemplateName }}{{ if .IsTest }}_test{{ end }}.go", Mod: 0, Format: "", Region: ""}
+
+	files, err := Generator{FileWriter: nil}.Render(t.Context(), logger(t), pkgs, tmps, DefaultConfig.Generate)
+	require.NoError(t, err)
+
+	got := map[string]string{}
+	for _, f := range files {
+		got[filepath.Base(f.Path)] = string(f.Content)
+	}
+	require.Equal(t, map[string]string{
+		"zz_generated.plain.go":       "package a\n",
+		"zz_a_tests.go":               "package a\n",
+		"zz_a_tests_test.go":          "package a\n",
+		"zz_a_test_tests_test.go":     "package a_test\n",
+		"zz_generated.shared_test.go": "package a_test\n",
+	}, got)
+}
@@ -0,0 +1,150 @@
+package pkgen
+
+import (
+	"bytes"
+	"fmt"
+	"go/build/constraint"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// header is the loaded HeaderConfig.
+type header struct {
+	license  []byte
+	marker   bool
+	build    constraint.Expr
+	checksum string // the policy, see HeaderConfig.Checksum.
+}
+
+func loadHeader(c HeaderConfig) (header, error) {
+	h := header{license: nil, marker: c.Marker, build: nil, checksum: c.Checksum}
+
+	switch c.Checksum {
+	case "", ChecksumWarn, ChecksumRefuse:
+	default:
+		return header{}, fmt.Errorf("%w: %q", ErrChecksumPolicy, c.Checksum)
+	}
+
+	if c.LicenseFile != "" {
+		b, err := os.ReadFile(filepath.Clean(c.LicenseFile))
+		if err != nil {
+			return header{}, fmt.Errorf("header license: %w", err)
+		}
+		h.license = commentLines(b)
+	}
+
+	if c.Build != "" {
+		expr, err := constraint.Parse("//go:build " + c.Build)
+		if err != nil {
+			return header{}, fmt.Errorf("header build constraint %q: %w", c.Build, err)
+		}
+		h.build = expr
+	}
+
+	return h, nil
+}
+
+func (h header) empty() bool {
+	return h.license == nil && !h.marker && h.build == nil && h.checksum == ""
+}
+
+// commentLines turns text into line comments, leaving alone the text that
+// already is a comment.
+func commentLines(b []byte) []byte {
+	b = bytes.TrimSpace(b)
+	if bytes.HasPrefix(b, []byte("//")) || bytes.HasPrefix(b, []byte("/*")) {
+		return append(b, '\n')
+	}
+
+	out := bytes.Buffer{}
+	for line := range strings.Lines(string(b)) {
+		line = strings.TrimRight(line, " \t\r\n")
+		if line == "" {
+			out.WriteString("//\n")
+			continue
+		}
+		out.WriteString("// " + line + "\n")
+	}
+
+	return out.Bytes()
+}
+
+// generatedMarker matches the standard generated code marker, see
+// https://go.dev/s/generatedcode.
+var generatedMarker = regexp.MustCompile(`^// Code generated .* DO NOT EDIT\.$`)
+
+func markerFor(tmp Template) string {
+	name := tmp.Name
+	if tmp.Version != "" {
+		name += "@" + tmp.Version
+	}
+
+	return fmt.Sprintf("// Code generated by pkgen %s from %s; DO NOT EDIT.", Version(), name)
+}
+
+// apply writes the license, the marker, the checksum line and the build
+// constraint on top of a Go source. The markers and, when a constraint is set,
+// the build lines of the template are moved there, so each of them is present
+// once.
+func (h header) apply(src []byte, tmp Template) ([]byte, error) {
+	if h.empty() {
+		return src, nil
+	}
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", src, parser.PackageClauseOnly)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errNoPackageClause, err)
+	}
+
+	offset := fset.Position(f.Package).Offset
+	build := h.build
+
+	top := bytes.Buffer{}
+	for line := range strings.Lines(string(src[:offset])) {
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case h.marker && generatedMarker.MatchString(trimmed):
+			continue
+		case h.checksum != "" && strings.HasPrefix(trimmed, checksumComment):
+			continue
+		case h.build != nil && constraint.IsGoBuild(trimmed):
+			expr, err := constraint.Parse(trimmed)
+			if err != nil {
+				return nil, err
+			}
+			build = &constraint.AndExpr{X: expr, Y: build}
+			continue
+		}
+
+		top.WriteString(line)
+	}
+
+	out := bytes.Buffer{}
+	if h.license != nil {
+		out.Write(h.license)
+		out.WriteString("\n")
+	}
+	if h.marker {
+		out.WriteString(markerFor(tmp) + "\n")
+	}
+	// the checksum is filled in by seal, once formatted.
+	if h.checksum != "" {
+		out.WriteString(checksumComment + "\n")
+	}
+	if h.marker || h.checksum != "" {
+		out.WriteString("\n")
+	}
+	if build != nil {
+		out.WriteString("//go:build " + build.String() + "\n\n")
+	}
+	out.Write(bytes.TrimLeft(top.Bytes(), "\n"))
+	out.Write(src[offset:])
+
+	return out.Bytes(), nil
+}
@@ -0,0 +1,128 @@
+package pkgen
+
+import (
+	"go/build/constraint"
+	"os"
+	"path/filepath"
+	"testing"
+	"text/template"
+
+	"github.com/ifnotnil/x/tst"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/tools/go/packages"
+)
+
+func TestCommentLines(t *testing.T) {
+	require.Equal(t, "// Copyright X\n//\n// MIT\n", string(commentLines([]byte("Copyright X\n\nMIT\n\n"))))
+	require.Equal(t, "// Copyright X\n", string(commentLines([]byte("// Copyright X\n"))))
+	require.Equal(t, "/* Copyright X */\n", string(commentLines([]byte("/* Copyright X */"))))
+}
+
+func TestHeaderApply(t *testing.T) {
+	tmp := Template{Name: "otel", Version: "v1"}
+	marker := markerFor(tmp)
+
+	tests := map[string]struct {
+		header        header
+		src           string
+		expected      string
+		errorAsserter tst.ErrorAssertionFunc
+	}{
+		"empty policy": {
+			header:        header{license: nil, marker: false, build: nil, checksum: ""},
+			src:           "package a\n",
+			expected:      "package a\n",
+			errorAsserter: tst.NoError(),
+		},
+		"marker added": {
+			header:        header{license: nil, marker: true, build: nil, checksum: ""},
+			src:           "// Package a does things.\npackage a\n",
+			expected:      marker + "\n\n// Package a does things.\npackage a\n",
+			errorAsserter: tst.NoError(),
+		},
+		"marker exactly once": {
+			header:        header{license: nil, marker: true, build: nil, checksum: ""},
+			src:           "// Code generated by pkgen; DO NOT EDIT.\n\npackage a\n\n// Code generated by pkgen; DO NOT EDIT.\n",
+			expected:      marker + "\n\npackage a\n\n// Code generated by pkgen; DO NOT EDIT.\n",
+			errorAsserter: tst.NoError(),
+		},
+		"everything": {
+			header:        header{license: []byte("// Copyright X\n"), marker: true, build: buildConstraint(t, "linux"), checksum: ""},
+			src:           "// Code generated by pkgen; DO NOT EDIT.\n//go:build amd64\n\npackage a\n",
+			expected:      "// Copyright X\n\n" + marker + "\n\n//go:build amd64 && linux\n\npackage a\n",
+			errorAsserter: tst.NoError(),
+		},
+		"template build kept without a policy one": {
+			header:        header{license: []byte("// Copyright X\n"), marker: false, build: nil, checksum: ""},
+			src:           "//go:build amd64\n\npackage a\n",
+			expected:      "// Copyright X\n\n//go:build amd64\n\npackage a\n",
+			errorAsserter: tst.NoError(),
+		},
+		"checksum line": {
+			header:        header{license: nil, marker: true, build: nil, checksum: ChecksumWarn},
+			src:           "// pkgen:checksum sha256:00\npackage a\n",
+			expected:      marker + "\n// pkgen:checksum\n\npackage a\n",
+			errorAsserter: tst.NoError(),
+		},
+		"checksum line without a marker": {
+			header:        header{license: nil, marker: false, build: nil, checksum: ChecksumWarn},
+			src:           "package a\n",
+			expected:      "// pkgen:checksum\n\npackage a\n",
+			errorAsserter: tst.NoError(),
+		},
+		"no package clause": {
+			header:        header{license: nil, marker: true, build: nil, checksum: ""},
+			src:           "const A = 1\n",
+			expected:      "",
+			errorAsserter: tst.Error(),
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := tc.header.apply([]byte(tc.src), tmp)
+			tc.errorAsserter(t, err)
+			require.Equal(t, tc.expected, string(got))
+		})
+	}
+}
+
+func buildConstraint(t *testing.T, expr string) constraint.Expr { //nolint:ireturn
+	t.Helper()
+
+	h, err := loadHeader(HeaderConfig{LicenseFile: "", Marker: false, Build: expr, Checksum: ""})
+	require.NoError(t, err)
+
+	return h.build
+}
+
+func TestLoadHeader(t *testing.T) {
+	_, err := loadHeader(HeaderConfig{LicenseFile: "", Marker: false, Build: "linux &&", Checksum: ""})
+	require.Error(t, err)
+
+	_, err = loadHeader(HeaderConfig{LicenseFile: filepath.Join(t.TempDir(), "missing"), Marker: false, Build: "", Checksum: ""})
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	_, err = loadHeader(HeaderConfig{LicenseFile: "", Marker: false, Build: "", Checksum: "ignore"})
+	require.ErrorIs(t, err, ErrChecksumPolicy)
+}
+
+func TestGenerateHeader(t *testing.T) {
+	license := filepath.Join(t.TempDir(), "LICENSE")
+	require.NoError(t, os.WriteFile(license, []byte("Copyright X\n"), 0o600))
+
+	pkgs := []packages.Package{{Name: "pkg", PkgPath: "example.com/pkg", Dir: "/tmp/pkg", GoFiles: []string{"/tmp/pkg/pkg.go"}}}
+	tmp := textTemplate(template.Must(template.New("t").Parse("// Code generated by pkgen; DO NOT EDIT.\npackage {{ .Name }}\n")))
+	readme := textTemplate(template.Must(template.New("readme").Parse("# {{ .Name }}\n")))
+	readme.Output.Output = "README.md"
+
+	cnf := DefaultConfig.Generate
+	cnf.Header = HeaderConfig{LicenseFile: license, Marker: true, Build: "!wasm", Checksum: ""}
+
+	mockFW := NewMockFileWriter(t)
+	mockFW.EXPECT().WriteFile("/tmp/pkg/zz_generated.t.go", []byte("// Copyright X\n\n"+markerFor(tmp)+"\n\n//go:build !wasm\n\npackage pkg\n"), os.FileMode(0o644)).Return(nil)
+	mockFW.EXPECT().WriteFile("/tmp/pkg/README.md", []byte("# pkg\n"), os.FileMode(0o644)).Return(nil)
+
+	err := Generator{FileWriter: mockFW}.Generate(t.Context(), logger(t), pkgs, []Template{tmp, readme}, cnf)
+	require.NoError(t, err)
+}
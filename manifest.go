@@ -0,0 +1,419 @@
+package pkgen
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/samber/lo"
+	"golang.org/x/tools/go/packages"
+)
+
+const ManifestFormatVersion = 1
+
+var ErrManifest = errors.New("malformed manifest")
+
+// manifestOrigin is the File.Origin of the manifests themselves.
+const manifestOrigin = "pkgen manifest"
+
+// Manifest records the outputs of the generation in a module, so that the
+// ones no longer produced can be pruned and the hand edits detected.
+type Manifest struct {
+	Version int             `json:"version"`
+	Outputs []ManifestEntry `json:"outputs"`
+}
+
+type ManifestEntry struct {
+	Path            string `json:"path"` // relative to the module root, slash separated.
+	Package         string `json:"package,omitempty"`
+	Template        string `json:"template"`
+	Source          string `json:"source"`
+	TemplateVersion string `json:"template_version,omitempty"`
+	ParamsHash      string `json:"params_hash,omitempty"`
+	Hash            string `json:"hash"`
+}
+
+func paramsHash(params map[string]any) string {
+	if len(params) == 0 {
+		return ""
+	}
+
+	// map keys are marshalled sorted.
+	b, err := json.Marshal(params)
+	if err != nil {
+		return ""
+	}
+
+	return contentHash(b)
+}
+
+func readManifest(path string) (Manifest, error) {
+	m := Manifest{Version: ManifestFormatVersion, Outputs: nil}
+
+	b, err := os.ReadFile(filepath.Clean(path))
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return Manifest{}, err
+	}
+
+	return parseManifest(path, b)
+}
+
+func parseManifest(path string, b []byte) (Manifest, error) {
+	m := Manifest{Version: ManifestFormatVersion, Outputs: nil}
+
+	if err := json.Unmarshal(b, &m); err != nil {
+		return Manifest{}, fmt.Errorf("%w: %s: %w", ErrManifest, path, err)
+	}
+
+	if m.Version != ManifestFormatVersion {
+		return Manifest{}, fmt.Errorf("%w: %s: unsupported version %d", ErrManifest, path, m.Version)
+	}
+
+	return m, nil
+}
+
+// manifestRoot returns the module root of a manifest, which its entries are
+// relative to, given the manifest config it was written with.
+func manifestRoot(path, manifest string) string {
+	return filepath.Clean(strings.TrimSuffix(path, filepath.Clean(manifest)))
+}
+
+// isManifest reports whether f is a manifest rather than an output.
+func (f File) isManifest() bool {
+	return f.Origin == manifestOrigin
+}
+
+// moduleOf returns the root of the innermost module containing path.
+func moduleOf(roots []string, path string) (string, bool) {
+	found := ""
+	for _, root := range roots {
+		if within(root, path) && len(root) > len(found) {
+			found = root
+		}
+	}
+
+	return found, found != ""
+}
+
+// manifestScope tells whether a recorded output belongs to this run, so that it
+// can be pruned when not produced anymore. Outputs of packages that are not
+// queried, e.g. by a go:generate run, are left alone.
+type manifestScope struct {
+	packages map[string]bool
+	plugins  map[string]bool
+}
+
+func newManifestScope(pkgs []packages.Package, tmps []Template) manifestScope {
+	return manifestScope{
+		packages: lo.SliceToMap(pkgs, func(p packages.Package) (string, bool) { return p.PkgPath, true }),
+		plugins: lo.SliceToMap(lo.Filter(tmps, func(t Template, _ int) bool { return t.IsPlugin() }), func(t Template) (string, bool) {
+			return t.Name, true
+		}),
+	}
+}
+
+func (s manifestScope) contains(e ManifestEntry) bool {
+	if e.Package == "" {
+		return s.plugins[e.Template]
+	}
+
+	return s.packages[e.Package]
+}
+
+// withManifests adds to the rendered files, for every module they are in, the
+// removal of the recorded outputs that are no longer produced and the updated
+// manifest. The recorded outputs edited by hand are not removed.
+func withManifests(logger *slog.Logger, files []File, pkgs []packages.Package, tmps []Template, cnf GenerateConfig) ([]File, error) {
+	if cnf.Manifest == "" {
+		return files, nil
+	}
+
+	roots := lo.Uniq(lo.FilterMap(pkgs, func(p packages.Package, _ int) (string, bool) {
+		if p.Module == nil || p.Module.Dir == "" {
+			return "", false
+		}
+		return filepath.Clean(p.Module.Dir), true
+	}))
+	slices.Sort(roots)
+
+	byModule := map[string][]File{}
+	for _, f := range files {
+		// a region target is hand-written, it is never to be removed.
+		if f.Region != "" {
+			continue
+		}
+		root, ok := moduleOf(roots, f.Path)
+		if !ok {
+			logger.Warn("output out of any module, not recorded in the manifest", slog.String("path", f.Path))
+			continue
+		}
+		byModule[root] = append(byModule[root], f)
+	}
+
+	scope := newManifestScope(pkgs, tmps)
+	result := slices.Clone(files)
+
+	for _, root := range roots {
+		produced := byModule[root]
+		manifestPath := filepath.Join(root, cnf.Manifest)
+
+		old, err := readManifest(manifestPath)
+		if err != nil {
+			return nil, err
+		}
+
+		entries := make([]ManifestEntry, 0, len(produced)+len(old.Outputs))
+		for _, f := range produced {
+			rel, err := filepath.Rel(root, f.Path)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, ManifestEntry{
+				Path:            filepath.ToSlash(rel),
+				Package:         f.Package,
+				Template:        f.Template,
+				Source:          f.Origin,
+				TemplateVersion: f.TemplateVersion,
+				ParamsHash:      f.ParamsHash,
+				Hash:            contentHash(f.Content),
+			})
+		}
+
+		producedPaths := lo.SliceToMap(entries, func(e ManifestEntry) (string, bool) { return e.Path, true })
+
+		for _, e := range old.Outputs {
+			if producedPaths[e.Path] {
+				continue
+			}
+
+			p := filepath.Join(root, filepath.FromSlash(e.Path))
+			if !within(root, p) {
+				return nil, fmt.Errorf("%w: %s: output %s is outside of the module", ErrManifest, manifestPath, e.Path)
+			}
+
+			if !scope.contains(e) {
+				entries = append(entries, e)
+				continue
+			}
+
+			current, err := diskHash(p)
+			if err != nil {
+				return nil, err
+			}
+
+			switch current {
+			case "":
+				// already gone.
+			case e.Hash:
+				result = append(result, File{
+					Path:     p,
+					Content:  nil,
+					Mode:     0,
+					DirMode:  0,
+					Package:  e.Package,
+					Template: e.Template,
+					Origin:   e.Source,
+
+					TemplateVersion: e.TemplateVersion,
+					ParamsHash:      e.ParamsHash,
+					Delete:          true,
+					Sources:         nil,
+					Region:          "",
+				})
+			default:
+				logger.Warn("output no longer produced but edited by hand, not removed", slog.String("path", p), slog.String("template", e.Template))
+				entries = append(entries, e)
+			}
+		}
+
+		if len(entries) == 0 && len(old.Outputs) == 0 {
+			continue
+		}
+
+		f, err := manifestFile(manifestPath, entries, cnf.OutputDirMod)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, f)
+	}
+
+	return result, nil
+}
+
+func manifestFile(path string, entries []ManifestEntry, dirMode os.FileMode) (File, error) {
+	slices.SortFunc(entries, func(a, b ManifestEntry) int { return strings.Compare(a.Path, b.Path) })
+
+	content, err := json.MarshalIndent(Manifest{Version: ManifestFormatVersion, Outputs: entries}, "", "  ")
+	if err != nil {
+		return File{}, err
+	}
+
+	return File{
+		Path:     path,
+		Content:  append(content, '\n'),
+		Mode:     DefaultConfig.Generate.OutputFileMod,
+		DirMode:  dirMode,
+		Package:  "",
+		Template: "",
+		Origin:   manifestOrigin,
+
+		TemplateVersion: "",
+		ParamsHash:      "",
+		Delete:          false,
+		Sources:         nil,
+		Region:          "",
+	}, nil
+}
+
+// restoreManifests rewrites the manifests of the transaction once the failing
+// packages are restored, so that they record the new outputs of the passing
+// packages and the old ones of the failing packages.
+func (g Generator) restoreManifests(tx *transaction, files []File, failing map[string]bool, cnf GenerateConfig) error {
+	errs := []error{}
+	for _, f := range files {
+		if !f.isManifest() {
+			continue
+		}
+
+		if err := g.restoreManifest(tx, f, failing, cnf); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", f.Path, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (g Generator) restoreManifest(tx *transaction, f File, failing map[string]bool, cnf GenerateConfig) error {
+	old, ok := tx.backupOf(f.Path)
+	if !ok {
+		return nil
+	}
+
+	root := manifestRoot(f.Path, cnf.Manifest)
+	isFailing := func(e ManifestEntry) bool {
+		return failing[filepath.Dir(filepath.Join(root, filepath.FromSlash(e.Path)))]
+	}
+
+	written, err := parseManifest(f.Path, f.Content)
+	if err != nil {
+		return err
+	}
+
+	entries := lo.Reject(written.Outputs, func(e ManifestEntry, _ int) bool { return isFailing(e) })
+	if old.existed {
+		previous, err := parseManifest(f.Path, old.content)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, lo.Filter(previous.Outputs, func(e ManifestEntry, _ int) bool { return isFailing(e) })...)
+	}
+
+	if len(entries) == 0 && !old.existed {
+		return tx.rollbackOnly(func(path string) bool { return path == f.Path })
+	}
+
+	restored, err := manifestFile(f.Path, entries, cnf.OutputDirMod)
+	if err != nil {
+		return err
+	}
+
+	return g.write(restored)
+}
+
+type OutputState string
+
+const (
+	StateOK       OutputState = "ok"
+	StateMissing  OutputState = "missing"  // not on disk.
+	StateStale    OutputState = "stale"    // a generation would change or remove it.
+	StateModified OutputState = "modified" // edited by hand since it was recorded, or since its checksum.
+)
+
+type OutputStatus struct {
+	State    OutputState `json:"state"`
+	Path     string      `json:"path"`
+	Package  string      `json:"package,omitempty"`
+	Template string      `json:"template,omitempty"`
+}
+
+// Status compares the rendered files with the disk and with the manifests
+// they were last recorded in. The recorded outputs that were not rendered, as
+// out of the scope of the run, are reported only when missing or modified.
+func (g Generator) Status(files []File, cnf GenerateConfig) ([]OutputStatus, error) {
+	recorded := map[string]ManifestEntry{}
+	for _, f := range files {
+		if !f.isManifest() {
+			continue
+		}
+
+		m, err := readManifest(f.Path)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range m.Outputs {
+			recorded[filepath.Join(manifestRoot(f.Path, cnf.Manifest), filepath.FromSlash(e.Path))] = e
+		}
+	}
+
+	statuses := []OutputStatus{}
+	seen := map[string]bool{}
+
+	for _, f := range files {
+		if f.isManifest() {
+			continue
+		}
+		seen[f.Path] = true
+
+		current, err := os.ReadFile(f.Path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		exists := err == nil
+
+		rec, isRecorded := recorded[f.Path]
+
+		state := StateOK
+		switch {
+		case !exists:
+			state = StateMissing
+		case isRecorded && contentHash(current) != rec.Hash, edited(current):
+			state = StateModified
+		case f.Delete, !bytes.Equal(current, f.Content):
+			state = StateStale
+		}
+
+		statuses = append(statuses, OutputStatus{State: state, Path: f.Path, Package: f.Package, Template: f.Template})
+	}
+
+	for p, e := range recorded {
+		if seen[p] {
+			continue
+		}
+
+		current, err := diskHash(p)
+		if err != nil {
+			return nil, err
+		}
+
+		switch current {
+		case "":
+			statuses = append(statuses, OutputStatus{State: StateMissing, Path: p, Package: e.Package, Template: e.Template})
+		case e.Hash:
+		default:
+			statuses = append(statuses, OutputStatus{State: StateModified, Path: p, Package: e.Package, Template: e.Template})
+		}
+	}
+
+	slices.SortFunc(statuses, func(a, b OutputStatus) int { return strings.Compare(a.Path, b.Path) })
+
+	return statuses, nil
+}
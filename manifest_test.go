@@ -0,0 +1,186 @@
+package pkgen
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"text/template"
+
+	"github.com/ifnotnil/x/tst"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/tools/go/packages"
+)
+
+func manifestTemplate(name string) Template {
+	return textTemplate(template.Must(template.New(name).Parse("package {{ .Name }}\n\nconst " + name + " = 1\n")))
+}
+
+func readTestManifest(t *testing.T, path string) Manifest {
+	t.Helper()
+
+	m, err := readManifest(path)
+	require.NoError(t, err)
+
+	return m
+}
+
+func paths(m Manifest) []string {
+	out := make([]string, 0, len(m.Outputs))
+	for _, e := range m.Outputs {
+		out = append(out, e.Path)
+	}
+
+	return out
+}
+
+func TestManifest(t *testing.T) {
+	all := []string{"a/zz_generated.x.go", "a/zz_generated.y.go", "b/zz_generated.x.go", "b/zz_generated.y.go"}
+
+	tests := map[string]struct {
+		manifest      string
+		edit          func(t *testing.T, module string)
+		pkgs          func(pkgs []packages.Package) []packages.Package // the packages of the second run.
+		tmps          []Template                                       // the templates of the second run.
+		errorAsserter tst.ErrorAssertionFunc
+		expected      []string // the recorded outputs.
+		removed       []string
+	}{
+		"records the outputs": {
+			manifest:      ".pkgen.lock",
+			edit:          func(*testing.T, string) {},
+			pkgs:          func(pkgs []packages.Package) []packages.Package { return pkgs },
+			tmps:          []Template{manifestTemplate("x"), manifestTemplate("y")},
+			errorAsserter: tst.NoError(),
+			expected:      all,
+			removed:       nil,
+		},
+		"manifest in a new directory": {
+			manifest:      "tools/pkgen.lock",
+			edit:          func(*testing.T, string) {},
+			pkgs:          func(pkgs []packages.Package) []packages.Package { return pkgs },
+			tmps:          []Template{manifestTemplate("x"), manifestTemplate("y")},
+			errorAsserter: tst.NoError(),
+			expected:      all,
+			removed:       nil,
+		},
+		"prunes the outputs no longer produced": {
+			manifest: ".pkgen.lock",
+			edit: func(t *testing.T, module string) {
+				t.Helper()
+				// edited by hand, so it is kept.
+				require.NoError(t, os.WriteFile(filepath.Join(module, "b", "zz_generated.y.go"), []byte("package b\n// mine\n"), 0o600))
+			},
+			pkgs:          func(pkgs []packages.Package) []packages.Package { return pkgs },
+			tmps:          []Template{manifestTemplate("x")},
+			errorAsserter: tst.NoError(),
+			expected:      []string{"a/zz_generated.x.go", "b/zz_generated.x.go", "b/zz_generated.y.go"},
+			removed:       []string{"a/zz_generated.y.go"},
+		},
+		"leaves the packages out of the run alone": {
+			manifest:      ".pkgen.lock",
+			edit:          func(*testing.T, string) {},
+			pkgs:          func(pkgs []packages.Package) []packages.Package { return pkgs[:1] },
+			tmps:          nil,
+			errorAsserter: tst.NoError(),
+			expected:      []string{"b/zz_generated.x.go", "b/zz_generated.y.go"},
+			removed:       []string{"a/zz_generated.x.go", "a/zz_generated.y.go"},
+		},
+		"refuses paths out of the module": {
+			manifest: ".pkgen.lock",
+			edit: func(t *testing.T, module string) {
+				t.Helper()
+				require.NoError(t, os.WriteFile(filepath.Join(module, ".pkgen.lock"), []byte(`{"version":1,"outputs":[{"path":"../x.go","package":"example.com/m/a","template":"x","source":"","hash":""}]}`), 0o600))
+			},
+			pkgs:          func(pkgs []packages.Package) []packages.Package { return pkgs },
+			tmps:          nil,
+			errorAsserter: tst.ErrorIs(ErrManifest),
+			expected:      []string{"../x.go"},
+			removed:       nil,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			module, pkgs := testModule(t)
+			cnf := DefaultConfig.Generate
+			cnf.Manifest = tc.manifest
+			g := Generator{FileWriter: nil}
+
+			require.NoError(t, g.Generate(t.Context(), logger(t), pkgs, []Template{manifestTemplate("x"), manifestTemplate("y")}, cnf))
+			tc.edit(t, module)
+
+			tc.errorAsserter(t, g.Generate(t.Context(), logger(t), tc.pkgs(pkgs), tc.tmps, cnf))
+
+			require.Equal(t, tc.expected, paths(readTestManifest(t, filepath.Join(module, tc.manifest))))
+			for _, rel := range tc.removed {
+				_, err := os.Stat(filepath.Join(module, rel))
+				require.ErrorIs(t, err, os.ErrNotExist, rel)
+			}
+		})
+	}
+}
+
+func TestManifestEntry(t *testing.T) {
+	module, pkgs := testModule(t)
+	cnf := DefaultConfig.Generate
+	cnf.Manifest = ".pkgen.lock"
+
+	require.NoError(t, Generator{FileWriter: nil}.Generate(t.Context(), logger(t), pkgs, []Template{manifestTemplate("x")}, cnf))
+
+	m := readTestManifest(t, filepath.Join(module, ".pkgen.lock"))
+	require.Equal(t, ManifestFormatVersion, m.Version)
+	require.Equal(t, ManifestEntry{
+		Path:            "a/zz_generated.x.go",
+		Package:         "example.com/m/a",
+		Template:        "x",
+		Source:          "file ",
+		TemplateVersion: "",
+		ParamsHash:      "",
+		Hash:            contentHash([]byte("package a\n\nconst x = 1\n")),
+	}, m.Outputs[0])
+}
+
+func TestStatus(t *testing.T) {
+	tests := map[string]struct {
+		manifest string
+	}{
+		"at the module root": {manifest: ".pkgen.lock"},
+		"in a directory":     {manifest: "tools/pkgen.lock"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			module, pkgs := testModule(t)
+			cnf := DefaultConfig.Generate
+			cnf.Manifest = tc.manifest
+			g := Generator{FileWriter: nil}
+
+			require.NoError(t, g.Generate(t.Context(), logger(t), pkgs, []Template{manifestTemplate("x"), manifestTemplate("y")}, cnf))
+
+			require.NoError(t, os.Remove(filepath.Join(module, "a", "zz_generated.x.go")))
+			require.NoError(t, os.WriteFile(filepath.Join(module, "a", "zz_generated.y.go"), []byte("package a\n// mine\n"), 0o600))
+
+			// b/zz_generated.y.go is no longer produced, b/zz_generated.x.go renders differently.
+			changed := textTemplate(template.Must(template.New("x").Parse("package {{ .Name }}\n\nconst x = 2\n")))
+			files, err := g.Render(t.Context(), logger(t), pkgs[1:], []Template{changed}, cnf)
+			require.NoError(t, err)
+
+			statuses, err := g.Status(files, cnf)
+			require.NoError(t, err)
+
+			got := map[string]OutputState{}
+			for _, s := range statuses {
+				rel, err := filepath.Rel(module, s.Path)
+				require.NoError(t, err)
+				got[filepath.ToSlash(rel)] = s.State
+			}
+
+			require.Equal(t, map[string]OutputState{
+				"a/zz_generated.x.go": StateMissing,
+				"a/zz_generated.y.go": StateModified,
+				"b/zz_generated.x.go": StateStale,
+				"b/zz_generated.y.go": StateStale,
+			}, got)
+		})
+	}
+}
@@ -99,3 +99,54 @@ func (_c *MockFileWriter_WriteFile_Call) RunAndReturn(run func(name string, data
 	_c.Call.Return(run)
 	return _c
 }
+
+// Remove provides a mock function for the type MockFileWriter
+func (_mock *MockFileWriter) Remove(name string) error {
+	ret := _mock.Called(name)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Remove")
+	}
+
+	var r0 error
+	if returnFunc, ok := ret.Get(0).(func(string) error); ok {
+		r0 = returnFunc(name)
+	} else {
+		r0 = ret.Error(0)
+	}
+	return r0
+}
+
+// MockFileWriter_Remove_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Remove'
+type MockFileWriter_Remove_Call struct {
+	*mock.Call
+}
+
+// Remove is a helper method to define mock.On call
+//   - name string
+func (_e *MockFileWriter_Expecter) Remove(name any) *MockFileWriter_Remove_Call {
+	return &MockFileWriter_Remove_Call{Call: _e.mock.On("Remove", name)}
+}
+
+func (_c *MockFileWriter_Remove_Call) Run(run func(name string)) *MockFileWriter_Remove_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		var arg0 string
+		if args[0] != nil {
+			arg0 = args[0].(string)
+		}
+		run(
+			arg0,
+		)
+	})
+	return _c
+}
+
+func (_c *MockFileWriter_Remove_Call) Return(err error) *MockFileWriter_Remove_Call {
+	_c.Call.Return(err)
+	return _c
+}
+
+func (_c *MockFileWriter_Remove_Call) RunAndReturn(run func(name string) error) *MockFileWriter_Remove_Call {
+	_c.Call.Return(run)
+	return _c
+}
@@ -0,0 +1,120 @@
+package pkgen
+
+import (
+	"errors"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/samber/lo"
+	"golang.org/x/tools/go/packages"
+)
+
+// outputPackage returns the package the outputs of pkg are written in. With an
+// output root, a plain directory is mirrored, e.g. "gen" puts the outputs of
+// internal/svc in gen/internal/svc, while a pattern like "{{ .RelDir }}/gen"
+// is rendered, per package, into the directory itself. Both are relative to
+// the module root.
+func outputPackage(pkg packages.Package, root string, names outputNames) (OutputPackage, error) {
+	if root == "" {
+		return OutputPackage{Name: pkg.Name, PkgPath: pkg.PkgPath, Dir: pkg.Dir}, nil
+	}
+
+	if pkg.Module == nil {
+		return OutputPackage{}, fmt.Errorf("%w: output root %s: package %s is not in a module", ErrOutputPath, root, pkg.PkgPath)
+	}
+
+	name := NewOutputName(pkg, Template{})
+
+	rel, err := names.generate(name, root)
+	if err != nil {
+		return OutputPackage{}, err
+	}
+	if !strings.Contains(root, "{{") {
+		rel = path.Join(rel, name.RelDir)
+	}
+	rel = path.Clean(filepath.ToSlash(rel))
+
+	if path.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, "../") {
+		return OutputPackage{}, fmt.Errorf("%w: output root %s: %s is outside of the module %s", ErrOutputPath, root, rel, pkg.Module.Path)
+	}
+
+	return OutputPackage{
+		Name:    packageName(path.Join(pkg.Module.Path, rel)),
+		PkgPath: path.Join(pkg.Module.Path, rel),
+		Dir:     filepath.Join(pkg.Module.Dir, filepath.FromSlash(rel)),
+	}, nil
+}
+
+// withoutOutputPackages drops the packages the outputs are written in: once
+// generated, a pattern like ./... matches them too, and they would be mirrored
+// again on every run.
+func withoutOutputPackages(pkgs []packages.Package, root string, names outputNames) []packages.Package {
+	if root == "" {
+		return pkgs
+	}
+
+	outDirs := map[string]bool{}
+	for _, p := range pkgs {
+		if out, err := outputPackage(p, root, names); err == nil && out.Dir != p.Dir {
+			outDirs[filepath.Clean(out.Dir)] = true
+		}
+	}
+
+	return lo.Filter(pkgs, func(p packages.Package, _ int) bool {
+		if outDirs[filepath.Clean(p.Dir)] {
+			return false
+		}
+
+		// a plain directory mirrors the whole tree, whatever was queried.
+		if p.Module == nil || strings.Contains(root, "{{") {
+			return true
+		}
+		dir := filepath.Join(p.Module.Dir, filepath.FromSlash(root))
+
+		return filepath.Clean(p.Dir) != dir && !within(dir, p.Dir)
+	})
+}
+
+// packageName derives a package name from the last element of its path.
+func packageName(pkgPath string) string {
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' {
+			return unicode.ToLower(r)
+		}
+		return '_'
+	}, path.Base(pkgPath))
+
+	if name == "" || unicode.IsDigit(rune(name[0])) {
+		name = "_" + name
+	}
+
+	return name
+}
+
+var errNoPackageClause = errors.New("no package clause")
+
+// renamePackage rewrites the package clause of a Go source, keeping the _test
+// suffix of the external test packages.
+func renamePackage(src []byte, name string) ([]byte, error) {
+	fset := token.NewFileSet()
+
+	f, err := parser.ParseFile(fset, "", src, parser.PackageClauseOnly)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errNoPackageClause, err)
+	}
+
+	if strings.HasSuffix(f.Name.Name, "_test") {
+		name += "_test"
+	}
+
+	start := fset.Position(f.Name.Pos()).Offset
+	end := fset.Position(f.Name.End()).Offset
+
+	return slices.Concat(src[:start], []byte(name), src[end:]), nil
+}
@@ -0,0 +1,180 @@
+package pkgen
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"text/template"
+
+	"github.com/ifnotnil/x/tst"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/tools/go/packages"
+)
+
+func TestOutputPackage(t *testing.T) {
+	pkg := packages.Package{
+		Name:    "svc",
+		PkgPath: "example.com/m/internal/svc",
+		Dir:     "/src/m/internal/svc",
+		Module:  &packages.Module{Path: "example.com/m", Dir: "/src/m"},
+	}
+
+	tests := map[string]struct {
+		pkg           packages.Package
+		root          string
+		expected      OutputPackage
+		errorAsserter tst.ErrorAssertionFunc
+	}{
+		"no root": {
+			pkg:           pkg,
+			root:          "",
+			expected:      OutputPackage{Name: "svc", PkgPath: "example.com/m/internal/svc", Dir: "/src/m/internal/svc"},
+			errorAsserter: tst.NoError(),
+		},
+		"mirrored": {
+			pkg:           pkg,
+			root:          "gen",
+			expected:      OutputPackage{Name: "svc", PkgPath: "example.com/m/gen/internal/svc", Dir: "/src/m/gen/internal/svc"},
+			errorAsserter: tst.NoError(),
+		},
+		"pattern": {
+			pkg:           pkg,
+			root:          "{{ .RelDir }}/gen",
+			expected:      OutputPackage{Name: "gen", PkgPath: "example.com/m/internal/svc/gen", Dir: "/src/m/internal/svc/gen"},
+			errorAsserter: tst.NoError(),
+		},
+		"outside of the module": {
+			pkg:           pkg,
+			root:          "../gen",
+			expected:      OutputPackage{},
+			errorAsserter: tst.ErrorIs(ErrOutputPath),
+		},
+		"absolute": {
+			pkg:           pkg,
+			root:          "{{ `/gen` }}",
+			expected:      OutputPackage{},
+			errorAsserter: tst.ErrorIs(ErrOutputPath),
+		},
+		"not in a module": {
+			pkg:           packages.Package{Name: "svc", PkgPath: "svc", Dir: "/src/svc"},
+			root:          "gen",
+			expected:      OutputPackage{},
+			errorAsserter: tst.ErrorIs(ErrOutputPath),
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := outputPackage(tc.pkg, tc.root, outputNames{})
+			tc.errorAsserter(t, err)
+			require.Equal(t, tc.expected, got)
+		})
+	}
+}
+
+func TestRenamePackage(t *testing.T) {
+	got, err := renamePackage([]byte("// header\n\npackage svc // comment\n\nconst A = 1\n"), "gen")
+	require.NoError(t, err)
+	require.Equal(t, "// header\n\npackage gen // comment\n\nconst A = 1\n", string(got))
+
+	got, err = renamePackage([]byte("package svc_test\n"), "gen")
+	require.NoError(t, err)
+	require.Equal(t, "package gen_test\n", string(got))
+
+	_, err = renamePackage([]byte("const A = 1\n"), "gen")
+	require.Error(t, err)
+}
+
+func TestGenerateOutputRoot(t *testing.T) {
+	module := t.TempDir()
+	pkgDir := filepath.Join(module, "internal", "svc")
+	require.NoError(t, os.MkdirAll(pkgDir, 0o755))
+
+	pkgs := []packages.Package{{
+		Name:    "svc",
+		PkgPath: "example.com/m/internal/svc",
+		Dir:     pkgDir,
+		GoFiles: []string{filepath.Join(pkgDir, "svc.go")},
+		Module:  &packages.Module{Path: "example.com/m", Dir: module},
+	}}
+	tmps := []Template{textTemplate(template.Must(template.New("t").Parse("package {{ .Name }}\n\nconst Path = \"{{ .Output.PkgPath }}\"\n")))}
+	cnf := GenerateConfig{
+		OutputFile:        "zz_{{ .TemplateName }}.go",
+		OutputFileMod:     0o644,
+		Format:            "",
+		OutputRoot:        "gen",
+		OutputDirMod:      0o700,
+		Header:            HeaderConfig{LicenseFile: "", Marker: false, Build: "", Checksum: ""},
+		Manifest:          "",
+		Verify:            false,
+		Bundles:           nil,
+		AddRequires:       false,
+		LineDirectives:    false,
+		AllowedOutputDirs: nil,
+		TemplateOutputs:   nil,
+		Query:             PackagesQueryConfig{},
+	}
+
+	require.NoError(t, Generator{FileWriter: nil}.Generate(t.Context(), logger(t), pkgs, tmps, cnf))
+
+	got, err := os.ReadFile(filepath.Join(module, "gen", "internal", "svc", "zz_t.go"))
+	require.NoError(t, err)
+	require.Equal(t, "package svc\n\nconst Path = \"example.com/m/gen/internal/svc\"\n", string(got))
+
+	st, err := os.Stat(filepath.Join(module, "gen"))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o700), st.Mode().Perm())
+
+	t.Run("outside of the module", func(t *testing.T) {
+		cnf := cnf
+		cnf.OutputRoot = "../gen"
+		err := Generator{FileWriter: nil}.Generate(t.Context(), logger(t), pkgs, tmps, cnf)
+		require.ErrorIs(t, err, ErrOutputPath)
+	})
+}
+
+func TestGenerateOutputRootTwice(t *testing.T) {
+	t.Setenv("GOWORK", "off")
+
+	tests := map[string]struct {
+		root     string
+		expected []string
+	}{
+		"plain":   {root: "gen", expected: []string{"a/a.go", "gen/a/zz_t.go", "go.mod"}},
+		"pattern": {root: "{{ .RelDir }}/gen", expected: []string{"a/a.go", "a/gen/zz_t.go", "go.mod"}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			module := t.TempDir()
+			require.NoError(t, os.MkdirAll(filepath.Join(module, "a"), 0o755))
+			require.NoError(t, os.WriteFile(filepath.Join(module, "go.mod"), []byte("module example.com/m\n\ngo 1.22\n"), 0o600))
+			require.NoError(t, os.WriteFile(filepath.Join(module, "a", "a.go"), []byte("package a\n"), 0o600))
+
+			q := DefaultConfig.PackagesQuery
+			q.Dir = module
+			q.Patterns = []string{"./..."}
+			tmps := []Template{textTemplate(template.Must(template.New("t").Parse("package {{ .Name }}\n")))}
+			cnf := DefaultConfig.Generate
+			cnf.OutputFile = "zz_{{ .TemplateName }}.go"
+			cnf.OutputRoot = tc.root
+
+			for range 2 {
+				pkgs, err := Packages{}.Query(t.Context(), q)
+				require.NoError(t, err)
+				require.NoError(t, Generator{FileWriter: nil}.Generate(t.Context(), logger(t), pkgs, tmps, cnf))
+			}
+
+			got := []string{}
+			require.NoError(t, filepath.WalkDir(module, func(p string, d fs.DirEntry, err error) error {
+				if err == nil && !d.IsDir() {
+					rel, _ := filepath.Rel(module, p)
+					got = append(got, filepath.ToSlash(rel))
+				}
+				return err
+			}))
+			require.Equal(t, tc.expected, got, "the outputs are not mirrored again")
+		})
+	}
+}
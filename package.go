@@ -2,12 +2,20 @@ package pkgen
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"os"
+	"path"
+	"path/filepath"
+	"strings"
 
 	"github.com/samber/lo"
+	"golang.org/x/mod/modfile"
 	"golang.org/x/tools/go/packages"
 )
 
+var ErrPackageNotLoaded = errors.New("package not loaded")
+
 type Packages struct{}
 
 func (Packages) Query(ctx context.Context, q PackagesQueryConfig) ([]packages.Package, error) {
@@ -21,6 +29,12 @@ func (Packages) Query(ctx context.Context, q PackagesQueryConfig) ([]packages.Pa
 	}
 
 	p, err := packages.Load(cfg, q.Patterns...)
+
+	// a cancelled load fails with an unwrapped error, or returns partial results.
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, ctxErr
+	}
+
 	if err != nil {
 		return nil, err
 	}
@@ -29,6 +43,73 @@ func (Packages) Query(ctx context.Context, q PackagesQueryConfig) ([]packages.Pa
 		if item == nil {
 			return packages.Package{}, false
 		}
-		return *item, true
+		return withoutGoFiles(*item), true
 	}), nil
 }
+
+// withoutGoFiles gives a directory without Go files, that the go command
+// loads with an error and neither a name nor an import path, the ones it
+// would have as a package of its module.
+func withoutGoFiles(p packages.Package) packages.Package {
+	if p.Name != "" || p.Dir == "" || len(p.GoFiles) > 0 || len(p.Errors) == 0 {
+		return p
+	}
+	if !lo.EveryBy(p.Errors, func(e packages.Error) bool { return strings.Contains(e.Msg, "no Go files") }) {
+		return p
+	}
+
+	modDir, modPath, ok := findModule(p.Dir)
+	if !ok {
+		return p
+	}
+
+	rel, err := filepath.Rel(modDir, p.Dir)
+	if err != nil {
+		return p
+	}
+
+	p.PkgPath = path.Join(modPath, filepath.ToSlash(rel))
+	p.ID = p.PkgPath
+	p.Name = packageName(p.PkgPath)
+	p.Module = &packages.Module{Path: modPath, Dir: modDir, GoMod: filepath.Join(modDir, "go.mod"), Main: true}
+	p.Errors = nil
+
+	return p
+}
+
+// findModule returns the root and the path of the module dir is in.
+func findModule(dir string) (string, string, bool) {
+	for d := filepath.Clean(dir); ; d = filepath.Dir(d) {
+		data, err := os.ReadFile(filepath.Join(d, "go.mod"))
+		if err == nil {
+			modPath := modfile.ModulePath(data)
+			return d, modPath, modPath != ""
+		}
+
+		if filepath.Dir(d) == d {
+			return "", "", false
+		}
+	}
+}
+
+// checkLoaded fails for the packages the query could not load, e.g. a pattern
+// naming a missing directory, with their load errors.
+func checkLoaded(pkgs []packages.Package) error {
+	report := strings.Builder{}
+	for _, p := range pkgs {
+		if p.Name != "" {
+			continue
+		}
+
+		fmt.Fprintf(&report, "\n%s:", firstNotEmpty(p.ID, p.PkgPath))
+		for _, e := range p.Errors {
+			fmt.Fprintf(&report, "\n  - %s", e.Msg)
+		}
+	}
+
+	if report.Len() > 0 {
+		return fmt.Errorf("%w:%s", ErrPackageNotLoaded, report.String())
+	}
+
+	return nil
+}
@@ -2,6 +2,8 @@ package pkgen
 
 import (
 	"context"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/ifnotnil/x/tst"
@@ -66,3 +68,53 @@ func TestPackagesQuery(t *testing.T) {
 		})
 	}
 }
+
+func TestPackagesQueryCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	pkgs, err := Packages{}.Query(ctx, DefaultConfig.PackagesQuery)
+	require.ErrorIs(t, err, context.Canceled)
+	require.Nil(t, pkgs)
+}
+
+func TestPackagesQueryWithoutGoFiles(t *testing.T) {
+	t.Setenv("GOWORK", "off")
+
+	module := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(module, "docs", "api"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(module, "go.mod"), []byte("module example.com/m\n\ngo 1.22\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(module, "docs", "api", "README.md"), []byte("# api\n"), 0o600))
+
+	q := DefaultConfig.PackagesQuery
+	q.Dir = module
+
+	t.Run("directory", func(t *testing.T) {
+		q := q
+		q.Patterns = []string{"./docs/api"}
+
+		pkgs, err := Packages{}.Query(t.Context(), q)
+		require.NoError(t, err)
+		require.Len(t, pkgs, 1)
+		require.Equal(t, "api", pkgs[0].Name)
+		require.Equal(t, "example.com/m/docs/api", pkgs[0].PkgPath)
+		require.Equal(t, filepath.Join(module, "docs", "api"), pkgs[0].Dir)
+		require.Empty(t, pkgs[0].Errors)
+		require.NoError(t, checkLoaded(pkgs))
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		q := q
+		q.Patterns = []string{"./missing"}
+
+		pkgs, err := Packages{}.Query(t.Context(), q)
+		require.NoError(t, err)
+
+		err = checkLoaded(pkgs)
+		require.ErrorIs(t, err, ErrPackageNotLoaded)
+		require.ErrorContains(t, err, "missing")
+
+		_, err = Generator{FileWriter: nil}.Render(t.Context(), logger(t), pkgs, nil, DefaultConfig.Generate)
+		require.ErrorIs(t, err, ErrPackageNotLoaded)
+	})
+}
@@ -0,0 +1,210 @@
+package pkgen
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/samber/lo"
+)
+
+type PlanActionKind string
+
+const (
+	ActionCreate    PlanActionKind = "create"
+	ActionModify    PlanActionKind = "modify"
+	ActionUnchanged PlanActionKind = "unchanged"
+	ActionDelete    PlanActionKind = "delete"
+)
+
+var (
+	ErrPlanStale     = errors.New("plan is stale")
+	ErrPlanMalformed = errors.New("malformed plan")
+)
+
+const PlanFormatVersion = 1
+
+// Plan is the list of actions that a generation would perform. It is made
+// without touching the disk, so that it can be reviewed and applied later.
+type Plan struct {
+	Version int          `json:"version"`
+	Actions []PlanAction `json:"actions"`
+}
+
+type PlanAction struct {
+	Action   PlanActionKind `json:"action"`
+	Path     string         `json:"path"`
+	Package  string         `json:"package,omitempty"`
+	Template string         `json:"template,omitempty"`
+	Mode     os.FileMode    `json:"mode,omitempty"`
+	DirMode  os.FileMode    `json:"dir_mode,omitempty"`
+	OldHash  string         `json:"old_hash,omitempty"` // the hash of the file on disk when the plan was made, empty if missing.
+	NewHash  string         `json:"new_hash,omitempty"`
+	Content  *string        `json:"content,omitempty"`
+}
+
+func contentHash(b []byte) string {
+	h := sha256.Sum256(b)
+	return "sha256:" + hex.EncodeToString(h[:])
+}
+
+// diskHash returns the hash of the file at path, or an empty string if it does not exist.
+func diskHash(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return contentHash(b), nil
+}
+
+// Plan compares the rendered files against the disk. The rendered content is
+// included in the plan only when withContent is set.
+func (g Generator) Plan(files []File, withContent bool) (Plan, error) {
+	plan := Plan{Version: PlanFormatVersion, Actions: make([]PlanAction, 0, len(files))}
+
+	for _, f := range files {
+		oldHash, err := diskHash(f.Path)
+		if err != nil {
+			return Plan{}, err
+		}
+
+		a := PlanAction{
+			Action:   ActionModify,
+			Path:     f.Path,
+			Package:  f.Package,
+			Template: f.Template,
+			Mode:     f.Mode,
+			DirMode:  f.DirMode,
+			OldHash:  oldHash,
+			NewHash:  contentHash(f.Content),
+			Content:  nil,
+		}
+
+		switch {
+		case f.Delete:
+			a.Action = ActionDelete
+			a.NewHash = ""
+		case a.OldHash == "":
+			a.Action = ActionCreate
+		case a.OldHash == a.NewHash:
+			a.Action = ActionUnchanged
+		}
+
+		if withContent && (a.Action == ActionCreate || a.Action == ActionModify) {
+			a.Content = lo.ToPtr(string(f.Content))
+		}
+
+		plan.Actions = append(plan.Actions, a)
+	}
+
+	return plan, nil
+}
+
+// Apply executes the plan. It refuses to do anything if any of the targets has
+// changed on disk since the plan was made. The content of the actions made
+// without it is taken from files, which must render to the planned hash. Like
+// generate, the targets edited by hand are reported according to the checksum
+// policy.
+func (g Generator) Apply(ctx context.Context, logger *slog.Logger, plan Plan, files []File, cnf GenerateConfig) error {
+	if plan.Version != PlanFormatVersion {
+		return fmt.Errorf("%w: unsupported version %d", ErrPlanMalformed, plan.Version)
+	}
+
+	rendered := lo.SliceToMap(files, func(f File) (string, File) { return f.Path, f })
+
+	stale := []string{}
+	contents := make([][]byte, len(plan.Actions))
+
+	for i, a := range plan.Actions {
+		current, err := diskHash(a.Path)
+		if err != nil {
+			return err
+		}
+
+		if current != a.OldHash {
+			stale = append(stale, a.Path+": changed on disk")
+			continue
+		}
+
+		switch a.Action {
+		case ActionCreate, ActionModify:
+		case ActionUnchanged, ActionDelete:
+			continue
+		default:
+			return fmt.Errorf("%w: unknown action %q", ErrPlanMalformed, a.Action)
+		}
+
+		switch f, ok := rendered[a.Path]; {
+		case a.Content != nil:
+			contents[i] = []byte(*a.Content)
+		case ok:
+			contents[i] = f.Content
+		default:
+			stale = append(stale, a.Path+": no content")
+			continue
+		}
+
+		if contentHash(contents[i]) != a.NewHash {
+			stale = append(stale, a.Path+": content does not match the planned hash")
+		}
+	}
+
+	if len(stale) > 0 {
+		return fmt.Errorf("%w:\n%s", ErrPlanStale, strings.Join(stale, "\n"))
+	}
+
+	writes := make([]File, len(plan.Actions))
+	for i, a := range plan.Actions {
+		writes[i] = File{Path: a.Path, Content: contents[i], Mode: a.Mode, DirMode: a.DirMode, Package: a.Package, Template: a.Template, Origin: "", TemplateVersion: "", ParamsHash: "", Delete: false, Sources: nil, Region: ""}
+	}
+
+	if cnf.Header.Checksum != "" {
+		modified := lo.Filter(writes, func(_ File, i int) bool { return plan.Actions[i].Action == ActionModify })
+		if err := checkEdits(ctx, logger, modified, cnf.Header.Checksum); err != nil {
+			return err
+		}
+	}
+
+	// like generate, the plan is applied all or nothing.
+	tx := transaction{g: g, backups: nil, dirs: nil}
+	for i, a := range plan.Actions {
+		err := ctx.Err()
+		if err == nil {
+			switch a.Action {
+			case ActionCreate, ActionModify:
+				err = tx.write(writes[i])
+			case ActionDelete:
+				err = tx.remove(a.Path)
+			case ActionUnchanged:
+			}
+		}
+
+		if err != nil {
+			return errors.Join(err, tx.rollback())
+		}
+	}
+
+	return nil
+}
+
+// HasContent reports whether every write action carries its content, so that
+// applying the plan does not need a rendering.
+func (p Plan) HasContent() bool {
+	return lo.EveryBy(p.Actions, func(a PlanAction) bool {
+		return a.Content != nil || (a.Action != ActionCreate && a.Action != ActionModify)
+	})
+}
+
+// Summary counts the actions of the plan per kind.
+func (p Plan) Summary() map[PlanActionKind]int {
+	return lo.CountValuesBy(p.Actions, func(a PlanAction) PlanActionKind { return a.Action })
+}
@@ -0,0 +1,138 @@
+package pkgen
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ifnotnil/x/tst"
+	"github.com/stretchr/testify/require"
+)
+
+// planFiles renders a/a.go unchanged, b/b.go modified, and creates a/created.go.
+func planFiles(module string) []File {
+	file := func(rel, template string) File {
+		return File{Path: filepath.Join(module, rel), Content: []byte("package a\n"), Mode: 0o644, DirMode: 0, Package: "example.com/m/a", Template: template, Origin: "", TemplateVersion: "", ParamsHash: "", Delete: false, Sources: nil, Region: ""}
+	}
+
+	return []File{file("a/a.go", "t1"), file("b/b.go", "t2"), file("a/created.go", "t3")}
+}
+
+func TestPlan(t *testing.T) {
+	module, _ := testModule(t)
+	files := planFiles(module)
+
+	plan, err := Generator{}.Plan(files, true)
+	require.NoError(t, err)
+	require.Len(t, plan.Actions, 3)
+
+	require.Equal(t, ActionUnchanged, plan.Actions[0].Action)
+	require.Nil(t, plan.Actions[0].Content)
+	require.Equal(t, plan.Actions[0].OldHash, plan.Actions[0].NewHash)
+
+	require.Equal(t, ActionModify, plan.Actions[1].Action)
+	require.Equal(t, contentHash([]byte("package b\n")), plan.Actions[1].OldHash)
+	require.Equal(t, "package a\n", *plan.Actions[1].Content)
+
+	require.Equal(t, ActionCreate, plan.Actions[2].Action)
+	require.Empty(t, plan.Actions[2].OldHash)
+	require.Equal(t, "t3", plan.Actions[2].Template)
+
+	require.Equal(t, map[PlanActionKind]int{ActionUnchanged: 1, ActionModify: 1, ActionCreate: 1}, plan.Summary())
+	require.True(t, plan.HasContent())
+
+	plan, err = Generator{}.Plan(files, false)
+	require.NoError(t, err)
+	require.False(t, plan.HasContent())
+}
+
+func TestApply(t *testing.T) {
+	tests := map[string]struct {
+		withContent   bool
+		rendered      func(files []File) []File // the files given to apply.
+		edit          func(t *testing.T, module string)
+		errorAsserter tst.ErrorAssertionFunc
+		expected      map[string]string // the content of the targets once applied, "" when missing.
+	}{
+		"with content": {
+			withContent:   true,
+			rendered:      func([]File) []File { return nil },
+			edit:          func(*testing.T, string) {},
+			errorAsserter: tst.NoError(),
+			expected:      map[string]string{"a/a.go": "package a\n", "b/b.go": "package a\n", "a/created.go": "package a\n"},
+		},
+		"without content": {
+			withContent:   false,
+			rendered:      func([]File) []File { return nil },
+			edit:          func(*testing.T, string) {},
+			errorAsserter: tst.ErrorIs(ErrPlanStale),
+			expected:      map[string]string{"b/b.go": "package b\n", "a/created.go": ""},
+		},
+		"content from the rendered files": {
+			withContent:   false,
+			rendered:      func(files []File) []File { return files },
+			edit:          func(*testing.T, string) {},
+			errorAsserter: tst.NoError(),
+			expected:      map[string]string{"b/b.go": "package a\n", "a/created.go": "package a\n"},
+		},
+		"rendered files do not match the plan": {
+			withContent: false,
+			rendered: func(files []File) []File {
+				files[2].Content = []byte("package b\n")
+				return files
+			},
+			edit:          func(*testing.T, string) {},
+			errorAsserter: tst.ErrorIs(ErrPlanStale),
+			expected:      map[string]string{"a/created.go": ""},
+		},
+		"target changed since the plan": {
+			withContent: true,
+			rendered:    func([]File) []File { return nil },
+			edit: func(t *testing.T, module string) {
+				t.Helper()
+				require.NoError(t, os.WriteFile(filepath.Join(module, "a", "a.go"), []byte("package edited\n"), 0o600))
+			},
+			errorAsserter: tst.ErrorIs(ErrPlanStale),
+			expected:      map[string]string{"a/a.go": "package edited\n", "a/created.go": ""},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			module, _ := testModule(t)
+			files := planFiles(module)
+
+			plan, err := Generator{}.Plan(files, tc.withContent)
+			require.NoError(t, err)
+			tc.edit(t, module)
+
+			tc.errorAsserter(t, Generator{}.Apply(t.Context(), logger(t), plan, tc.rendered(files), DefaultConfig.Generate))
+
+			for rel, content := range tc.expected {
+				got, err := os.ReadFile(filepath.Join(module, rel))
+				if content == "" {
+					require.ErrorIs(t, err, os.ErrNotExist, rel)
+					continue
+				}
+				require.NoError(t, err)
+				require.Equal(t, content, string(got), rel)
+			}
+		})
+	}
+
+	t.Run("delete", func(t *testing.T) {
+		module, _ := testModule(t)
+		target := filepath.Join(module, "a", "a.go")
+		plan := Plan{Version: PlanFormatVersion, Actions: []PlanAction{
+			{Action: ActionDelete, Path: target, Package: "", Template: "", Mode: 0, DirMode: 0, OldHash: contentHash([]byte("package a\n")), NewHash: "", Content: nil},
+		}}
+
+		require.NoError(t, Generator{}.Apply(t.Context(), logger(t), plan, nil, DefaultConfig.Generate))
+		_, err := os.Stat(target)
+		require.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("unsupported version", func(t *testing.T) {
+		require.ErrorIs(t, Generator{}.Apply(t.Context(), logger(t), Plan{Version: 0, Actions: nil}, nil, DefaultConfig.Generate), ErrPlanMalformed)
+	})
+}
@@ -0,0 +1,218 @@
+package pkgen
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/samber/lo"
+	"golang.org/x/tools/go/packages"
+)
+
+// PluginProtocolVersion is sent with every PluginRequest so plugins can reject
+// requests they do not understand.
+const PluginProtocolVersion = 1
+
+var (
+	ErrPlugin            = errors.New("plugin failed")
+	ErrPluginDiagnostics = errors.New("plugin reported errors")
+)
+
+// PluginRequest is written as JSON to the stdin of a plugin. A plugin is
+// executed once per batch and receives all the queried packages.
+type PluginRequest struct {
+	Version  int             `json:"version"`
+	Template string          `json:"template"`
+	Params   map[string]any  `json:"params,omitempty"`
+	Packages []PluginPackage `json:"packages"`
+}
+
+type PluginPackage struct {
+	ID         string        `json:"id"`
+	Name       string        `json:"name"`
+	PkgPath    string        `json:"pkg_path"`
+	Dir        string        `json:"dir"`
+	GoFiles    []string      `json:"go_files"`
+	OtherFiles []string      `json:"other_files"`
+	Module     *PluginModule `json:"module,omitempty"`
+}
+
+type PluginModule struct {
+	Path      string `json:"path"`
+	Dir       string `json:"dir"`
+	Version   string `json:"version"`
+	GoVersion string `json:"go_version"`
+	Main      bool   `json:"main"`
+}
+
+// PluginResponse is read as JSON from the stdout of a plugin.
+type PluginResponse struct {
+	Files       []PluginFile       `json:"files"`
+	Diagnostics []PluginDiagnostic `json:"diagnostics"`
+}
+
+type PluginFile struct {
+	Path    string      `json:"path"` // absolute, or relative to the working directory of pkgen.
+	Content string      `json:"content"`
+	Mode    os.FileMode `json:"mode"` // when zero the generate mode is used.
+}
+
+type PluginDiagnosticSeverity string
+
+const (
+	SeverityError   PluginDiagnosticSeverity = "error"
+	SeverityWarning PluginDiagnosticSeverity = "warning"
+	SeverityInfo    PluginDiagnosticSeverity = "info"
+)
+
+type PluginDiagnostic struct {
+	Severity PluginDiagnosticSeverity `json:"severity"`
+	Package  string                   `json:"package"`
+	Message  string                   `json:"message"`
+}
+
+func newPluginPackage(p packages.Package) PluginPackage {
+	pp := PluginPackage{
+		ID:         p.ID,
+		Name:       p.Name,
+		PkgPath:    p.PkgPath,
+		Dir:        p.Dir,
+		GoFiles:    p.GoFiles,
+		OtherFiles: p.OtherFiles,
+		Module:     nil,
+	}
+
+	if p.Module != nil {
+		pp.Module = &PluginModule{
+			Path:      p.Module.Path,
+			Dir:       p.Module.Dir,
+			Version:   p.Module.Version,
+			GoVersion: p.Module.GoVersion,
+			Main:      p.Module.Main,
+		}
+	}
+
+	return pp
+}
+
+func runPlugin(ctx context.Context, tmp Template, pkgs []packages.Package) (PluginResponse, error) {
+	req := PluginRequest{
+		Version:  PluginProtocolVersion,
+		Template: tmp.Name,
+		Params:   tmp.Params,
+		Packages: lo.Map(pkgs, func(p packages.Package, _ int) PluginPackage { return newPluginPackage(p) }),
+	}
+
+	in, err := json.Marshal(req)
+	if err != nil {
+		return PluginResponse{}, err
+	}
+
+	stdout := bytes.Buffer{}
+	stderr := bytes.Buffer{}
+
+	cmd := exec.CommandContext(ctx, tmp.Plugin) //nolint:gosec // reason: running the configured plugin is the whole point.
+	cmd.Stdin = bytes.NewReader(in)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return PluginResponse{}, fmt.Errorf("%w: %s: %w: %s", ErrPlugin, tmp.Plugin, err, strings.TrimSpace(stderr.String()))
+	}
+
+	resp := PluginResponse{}
+	if err := json.Unmarshal(stdout.Bytes(), &resp); err != nil {
+		return PluginResponse{}, fmt.Errorf("%w: %s: malformed response: %w", ErrPlugin, tmp.Plugin, err)
+	}
+
+	return resp, nil
+}
+
+func (g Generator) GenerateWithPlugin(ctx context.Context, logger *slog.Logger, pkgs []packages.Package, tmp Template, cnf GenerateConfig) error {
+	r, err := newRenderer(cnf)
+	if err != nil {
+		return err
+	}
+
+	files, err := r.renderPlugin(ctx, logger, pkgs, tmp, cnf)
+	if err != nil {
+		return err
+	}
+
+	if err := checkOutputs(files, pkgs, cnf); err != nil {
+		return err
+	}
+
+	return g.writeAll(ctx, files)
+}
+
+func (r renderer) renderPlugin(ctx context.Context, logger *slog.Logger, pkgs []packages.Package, tmp Template, cnf GenerateConfig) ([]File, error) {
+	resp, err := runPlugin(ctx, tmp, pkgs)
+	if err != nil {
+		return nil, err
+	}
+
+	failed := false
+	for _, d := range resp.Diagnostics {
+		attrs := []any{slog.String("template", tmp.Name), slog.String("package", d.Package)}
+		switch d.Severity {
+		case SeverityError:
+			failed = true
+			logger.ErrorContext(ctx, d.Message, attrs...)
+		case SeverityWarning:
+			logger.WarnContext(ctx, d.Message, attrs...)
+		default:
+			logger.InfoContext(ctx, d.Message, attrs...)
+		}
+	}
+
+	if failed {
+		return nil, fmt.Errorf("%w: %s", ErrPluginDiagnostics, tmp.Name)
+	}
+
+	cnf = cnf.forTemplate(tmp)
+	files := make([]File, 0, len(resp.Files))
+	for _, pf := range resp.Files {
+		f, err := r.pluginOutputFile(pf, tmp, cnf)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+
+	return files, nil
+}
+
+func (r renderer) pluginOutputFile(pf PluginFile, tmp Template, cnf GenerateConfig) (File, error) {
+	if pf.Path == "" {
+		return File{}, fmt.Errorf("%w: file without path", ErrPlugin)
+	}
+
+	p, err := filepath.Abs(pf.Path)
+	if err != nil {
+		return File{}, err
+	}
+
+	return r.finish(File{
+		Path:     p,
+		Content:  []byte(pf.Content),
+		Mode:     firstNotEmpty(pf.Mode, cnf.OutputFileMod),
+		DirMode:  0,
+		Package:  "",
+		Template: tmp.Name,
+		Origin:   tmp.Origin(),
+
+		TemplateVersion: tmp.Version,
+		ParamsHash:      paramsHash(tmp.Params),
+		Delete:          false,
+		Sources:         nil,
+		Region:          "",
+	}, tmp, cnf.Format)
+}
@@ -0,0 +1,84 @@
+package pkgen
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/ifnotnil/x/tst"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/tools/go/packages"
+)
+
+func buildPlugin(t *testing.T) string {
+	t.Helper()
+
+	out := filepath.Join(t.TempDir(), "plugin")
+	cmd := exec.CommandContext(t.Context(), "go", "build", "-o", out, "./testdata/plugin")
+	b, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(b))
+
+	return out
+}
+
+func TestGenerateWithPlugin(t *testing.T) {
+	plugin := buildPlugin(t)
+
+	tests := map[string]struct {
+		plugin        string
+		packages      []packages.Package
+		mockInit      func(*MockFileWriter)
+		errorAsserter tst.ErrorAssertionFunc
+	}{
+		"files are written": {
+			plugin: plugin,
+			packages: []packages.Package{
+				{Name: "pkg1", PkgPath: "example.com/pkg1", Dir: "/tmp/pkg1"},
+				{Name: "pkg2", PkgPath: "example.com/pkg2", Dir: "/tmp/pkg2"},
+			},
+			mockInit: func(m *MockFileWriter) {
+				m.EXPECT().WriteFile("/tmp/pkg1/zz_generated.plugin.go", []byte("package pkg1\n"), os.FileMode(0o644)).Return(nil)
+				m.EXPECT().WriteFile("/tmp/pkg2/zz_generated.plugin.go", []byte("package pkg2\n"), os.FileMode(0o644)).Return(nil)
+			},
+			errorAsserter: tst.NoError(),
+		},
+		"error diagnostic": {
+			plugin: plugin,
+			packages: []packages.Package{
+				{Name: "pkg1", PkgPath: "example.com/pkg1", Dir: "/tmp/pkg1"},
+				{Name: "broken", PkgPath: "example.com/broken", Dir: "/tmp/broken"},
+			},
+			mockInit:      func(m *MockFileWriter) {},
+			errorAsserter: tst.ErrorIs(ErrPluginDiagnostics),
+		},
+		"plugin not found": {
+			plugin:        filepath.Join(t.TempDir(), "missing"),
+			packages:      []packages.Package{{Name: "pkg1", PkgPath: "example.com/pkg1", Dir: "/tmp/pkg1"}},
+			mockInit:      func(m *MockFileWriter) {},
+			errorAsserter: tst.ErrorIs(ErrPlugin),
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			mockFW := NewMockFileWriter(t)
+			tc.mockInit(mockFW)
+
+			gen := Generator{FileWriter: mockFW}
+			tmp := Templates{}.plugin(tc.plugin)
+
+			err := gen.Generate(t.Context(), logger(t), tc.packages, []Template{tmp}, DefaultConfig.Generate)
+			tc.errorAsserter(t, err)
+		})
+	}
+}
+
+func TestGenerateWithPluginOutputPaths(t *testing.T) {
+	tmp := Templates{}.plugin(buildPlugin(t))
+	pkgs := []packages.Package{{Name: "escape", PkgPath: "example.com/escape", Dir: "/tmp/escape"}}
+
+	// no write expectations: nothing is written outside of the packages.
+	err := Generator{FileWriter: NewMockFileWriter(t)}.GenerateWithPlugin(t.Context(), logger(t), pkgs, tmp, DefaultConfig.Generate)
+	require.ErrorIs(t, err, ErrOutputPath)
+}
@@ -0,0 +1,230 @@
+package pkgen
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var ErrRegion = errors.New("region error")
+
+// the markers of a region, each alone on its line and followed by the region
+// name, e.g. // pkgen:begin handlers.
+const (
+	regionBegin = "// pkgen:begin "
+	regionEnd   = "// pkgen:end "
+)
+
+// regionFile is the output of a template rendering into a region of the
+// hand-written file p, to be inserted by withRegions.
+func regionFile(data TemplateData, content []byte, sources []string, tmp Template, p, region string) File {
+	return File{
+		Path:     p,
+		Content:  content,
+		Mode:     0,
+		DirMode:  0,
+		Package:  data.PkgPath,
+		Template: tmp.Name,
+		Origin:   tmp.Origin(),
+
+		TemplateVersion: tmp.Version,
+		ParamsHash:      paramsHash(tmp.Params),
+		Delete:          false,
+		Sources:         sources,
+		Region:          region,
+	}
+}
+
+// withRegions inserts the region outputs into their targets, read from disk:
+// only the lines between the markers are replaced. The regions of the same
+// target are combined into a single file, formatted when the target already
+// was, so that the hand-written parts are never changed.
+func withRegions(files []File) ([]File, error) {
+	result := make([]File, 0, len(files))
+	targets := map[string]int{}      // the index of each target in result.
+	originals := map[string][]byte{} // the content of each target on disk.
+	report := strings.Builder{}
+
+	for _, f := range files {
+		if f.Region == "" {
+			result = append(result, f)
+			continue
+		}
+
+		i, ok := targets[f.Path]
+		if !ok {
+			t, err := regionTarget(f)
+			if errors.Is(err, os.ErrNotExist) {
+				fmt.Fprintf(&report, "\n%s (template %s): region %s: missing target file", f.Path, f.Template, f.Region)
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			i = len(result)
+			targets[f.Path] = i
+			originals[f.Path] = t.Content
+			result = append(result, t)
+		}
+
+		t := &result[i]
+		content, sources, err := replaceRegion(t.Content, t.Sources, f)
+		if err != nil {
+			fmt.Fprintf(&report, "\n%s (template %s): %s", f.Path, f.Template, err)
+			continue
+		}
+
+		t.Content, t.Sources = content, sources
+		t.Template = joinNotEmpty(t.Template, f.Template)
+		t.Region = joinNotEmpty(t.Region, f.Region)
+	}
+
+	if report.Len() > 0 {
+		return nil, fmt.Errorf("%w:%s", ErrRegion, report.String())
+	}
+
+	for p, i := range targets {
+		original := result[i]
+		original.Content = originals[p]
+		if formatted, err := formatFile("", original); err != nil || !bytes.Equal(formatted.Content, original.Content) {
+			continue
+		}
+
+		f, err := formatFile("", result[i])
+		if err != nil {
+			return nil, withSources(err, result[i].Sources)
+		}
+		f.Sources = remapSources(result[i].Content, result[i].Sources, f.Content)
+		result[i] = f
+	}
+
+	return result, nil
+}
+
+// regionTarget reads the hand-written target of a region output, keeping its
+// mode.
+func regionTarget(f File) (File, error) {
+	st, err := os.Stat(f.Path)
+	if err != nil {
+		return File{}, err
+	}
+
+	content, err := os.ReadFile(filepath.Clean(f.Path))
+	if err != nil {
+		return File{}, err
+	}
+
+	return File{
+		Path:     f.Path,
+		Content:  content,
+		Mode:     st.Mode().Perm(),
+		DirMode:  0,
+		Package:  f.Package,
+		Template: "",
+		Origin:   f.Origin,
+
+		TemplateVersion: f.TemplateVersion,
+		ParamsHash:      f.ParamsHash,
+		Delete:          false,
+		Sources:         make([]string, bytes.Count(content, []byte("\n"))),
+		Region:          "",
+	}, nil
+}
+
+// replaceRegion replaces the lines between the markers of the region of f in
+// content with the content of f, without its leading and trailing blank lines.
+func replaceRegion(content []byte, sources []string, f File) ([]byte, []string, error) {
+	lines := strings.SplitAfter(string(content), "\n")
+	begin, end := -1, -1
+
+	for i, line := range lines {
+		switch strings.TrimSpace(line) {
+		case strings.TrimSpace(regionBegin + f.Region):
+			if begin >= 0 {
+				return nil, nil, fmt.Errorf("region %s: duplicate %s%s marker at line %d", f.Region, regionBegin, f.Region, i+1)
+			}
+			begin = i
+		case strings.TrimSpace(regionEnd + f.Region):
+			if end >= 0 {
+				return nil, nil, fmt.Errorf("region %s: duplicate %s%s marker at line %d", f.Region, regionEnd, f.Region, i+1)
+			}
+			end = i
+		}
+	}
+
+	switch {
+	case begin < 0:
+		return nil, nil, fmt.Errorf("region %s: missing %s%s marker", f.Region, regionBegin, f.Region)
+	case end < 0:
+		return nil, nil, fmt.Errorf("region %s: missing %s%s marker", f.Region, regionEnd, f.Region)
+	case end < begin:
+		return nil, nil, fmt.Errorf("region %s: %s%s marker before the begin one", f.Region, regionEnd, f.Region)
+	}
+
+	// the begin marker may be the last line, without a line break.
+	if !strings.HasSuffix(lines[begin], "\n") {
+		lines[begin] += "\n"
+	}
+
+	region, regionSources := trimLines(f.Content, f.Sources)
+
+	out := strings.Builder{}
+	outSources := make([]string, 0, len(sources)+len(regionSources))
+	for i, line := range lines {
+		// the replaced lines, and the empty rest after the last line break.
+		if i > begin && i < end || line == "" {
+			continue
+		}
+
+		out.WriteString(line)
+		outSources = append(outSources, sourceAt(sources, i+1))
+
+		if i == begin {
+			out.Write(region)
+			outSources = append(outSources, regionSources...)
+		}
+	}
+
+	return []byte(out.String()), outSources, nil
+}
+
+// trimLines removes the leading and trailing blank lines of content, along
+// with their sources, and ends it with a line break.
+func trimLines(content []byte, sources []string) ([]byte, []string) {
+	lines := strings.SplitAfter(string(content), "\n")
+
+	first, last := 0, len(lines)
+	for first < last && strings.TrimSpace(lines[first]) == "" {
+		first++
+	}
+	for last > first && strings.TrimSpace(lines[last-1]) == "" {
+		last--
+	}
+	if first == last {
+		return nil, nil
+	}
+
+	trimmed := strings.Join(lines[first:last], "")
+	if !strings.HasSuffix(trimmed, "\n") {
+		trimmed += "\n"
+	}
+
+	trimmedSources := make([]string, 0, last-first)
+	for i := first; i < last; i++ {
+		trimmedSources = append(trimmedSources, sourceAt(sources, i+1))
+	}
+
+	return []byte(trimmed), trimmedSources
+}
+
+func joinNotEmpty(a, b string) string {
+	if a == "" {
+		return b
+	}
+
+	return a + ", " + b
+}
@@ -0,0 +1,133 @@
+package pkgen
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"text/template"
+
+	"github.com/ifnotnil/x/tst"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/tools/go/packages"
+)
+
+func TestReplaceRegion(t *testing.T) {
+	tests := map[string]struct {
+		content       string
+		region        string
+		expected      string
+		errorAsserter tst.ErrorAssertionFunc
+	}{
+		"replaced": {
+			content:       "a\n// pkgen:begin r\nold\nold\n// pkgen:end r\nb\n",
+			region:        "\nnew\n\n",
+			expected:      "a\n// pkgen:begin r\nnew\n// pkgen:end r\nb\n",
+			errorAsserter: tst.NoError(),
+		},
+		"indented markers": {
+			content:       "var (\n\t// pkgen:begin r\n\t// pkgen:end r\n)\n",
+			region:        "\tA = 1",
+			expected:      "var (\n\t// pkgen:begin r\n\tA = 1\n\t// pkgen:end r\n)\n",
+			errorAsserter: tst.NoError(),
+		},
+		"empty region": {
+			content:       "// pkgen:begin r\nold\n// pkgen:end r",
+			region:        "\n",
+			expected:      "// pkgen:begin r\n// pkgen:end r",
+			errorAsserter: tst.NoError(),
+		},
+		"other regions are left alone": {
+			content:       "// pkgen:begin other\nold\n// pkgen:end other\n// pkgen:begin r\n// pkgen:end r\n",
+			region:        "new\n",
+			expected:      "// pkgen:begin other\nold\n// pkgen:end other\n// pkgen:begin r\nnew\n// pkgen:end r\n",
+			errorAsserter: tst.NoError(),
+		},
+		"missing begin": {
+			content:       "a\n// pkgen:end r\n",
+			region:        "new\n",
+			expected:      "",
+			errorAsserter: tst.Error(),
+		},
+		"missing end": {
+			content:       "// pkgen:begin r\na\n// pkgen:end rr\n",
+			region:        "new\n",
+			expected:      "",
+			errorAsserter: tst.Error(),
+		},
+		"end before begin": {
+			content:       "// pkgen:end r\n// pkgen:begin r\n",
+			region:        "new\n",
+			expected:      "",
+			errorAsserter: tst.Error(),
+		},
+		"duplicate": {
+			content:       "// pkgen:begin r\n// pkgen:end r\n// pkgen:begin r\n// pkgen:end r\n",
+			region:        "new\n",
+			expected:      "",
+			errorAsserter: tst.Error(),
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			f := File{Path: "wire.go", Content: []byte(tc.region), Mode: 0, DirMode: 0, Package: "", Template: "t", Origin: "", TemplateVersion: "", ParamsHash: "", Delete: false, Sources: nil, Region: "r"}
+			got, _, err := replaceRegion([]byte(tc.content), nil, f)
+			tc.errorAsserter(t, err)
+			require.Equal(t, tc.expected, string(got))
+		})
+	}
+}
+
+func TestGenerateRegion(t *testing.T) {
+	module, pkgs := testModule(t)
+	pkgs = pkgs[:1]
+	cnf := DefaultConfig.Generate
+	cnf.Manifest = ".pkgen.lock"
+	dir := pkgs[0].Dir
+	target := filepath.Join(dir, "wire.go")
+	hand := "package a\n\n// Providers is hand-written.\nvar Providers = []any{\n\tNewA,\n\t// pkgen:begin providers\n\t// pkgen:end providers\n}\n\nfunc NewA() any { return nil }\n"
+	require.NoError(t, os.WriteFile(target, []byte(hand), 0o600))
+	pkgs[0].GoFiles = []string{target}
+
+	providers := textTemplate(template.Must(template.New("providers").Parse("\n{{ range .Params.names }}New{{ . }},\n{{ end }}")))
+	providers.Params = map[string]any{"names": []string{"B", "C"}}
+	providers.Output = OutputConfig{Output: "wire.go", Mod: 0, Format: "", Region: "providers"}
+	other := manifestTemplate("other")
+
+	g := Generator{FileWriter: nil}
+	require.NoError(t, g.Generate(t.Context(), logger(t), pkgs, []Template{providers, other}, cnf))
+
+	got, err := os.ReadFile(target)
+	require.NoError(t, err)
+	require.Equal(t, "package a\n\n// Providers is hand-written.\nvar Providers = []any{\n\tNewA,\n\t// pkgen:begin providers\n\tNewB,\n\tNewC,\n\t// pkgen:end providers\n}\n\nfunc NewA() any { return nil }\n", string(got))
+
+	st, err := os.Stat(target)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o600), st.Mode().Perm(), "the mode of the target is kept")
+
+	m, err := readManifest(filepath.Join(module, ".pkgen.lock"))
+	require.NoError(t, err)
+	require.Len(t, m.Outputs, 1, "the target is not recorded")
+	require.Equal(t, "a/zz_generated.other.go", m.Outputs[0].Path)
+
+	// a second run changes nothing.
+	files, err := g.Render(t.Context(), logger(t), pkgs, []Template{providers, other}, cnf)
+	require.NoError(t, err)
+	statuses, err := g.Status(files, cnf)
+	require.NoError(t, err)
+	for _, s := range statuses {
+		require.Equal(t, StateOK, s.State, s.Path)
+	}
+
+	// without the markers.
+	require.NoError(t, os.WriteFile(target, []byte("package a\n"), 0o600))
+	_, err = g.Render(t.Context(), logger(t), pkgs, []Template{providers, other}, cnf)
+	require.ErrorIs(t, err, ErrRegion)
+	require.Contains(t, err.Error(), "missing // pkgen:begin providers marker")
+
+	// without the target.
+	require.NoError(t, os.Remove(target))
+	_, err = g.Render(t.Context(), logger(t), []packages.Package{pkgs[0]}, []Template{providers}, cnf)
+	require.ErrorIs(t, err, ErrRegion)
+	require.Contains(t, err.Error(), "missing target file")
+}
@@ -0,0 +1,250 @@
+package pkgen
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/build"
+	"go/version"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+	"golang.org/x/mod/sumdb/dirhash"
+	"golang.org/x/tools/go/packages"
+)
+
+var ErrRequirements = errors.New("unmet template requirements")
+
+// Requirements are what the generated code needs from the module it is
+// generated in, declared in the front-matter:
+//
+//	requires:
+//	  go: "1.22"
+//	  modules:
+//	    - go.opentelemetry.io/otel@v1.28.0 # at least this version
+//	    - go.opentelemetry.io/otel/trace    # any version
+type Requirements struct {
+	Go      string   `json:"go,omitempty"      yaml:"go,omitempty"`
+	Modules []string `json:"modules,omitempty" yaml:"modules,omitempty"`
+}
+
+func (r Requirements) empty() bool {
+	return r.Go == "" && len(r.Modules) == 0
+}
+
+// checkRequirements checks the requirements of the templates against the
+// go.mod of the modules of the packages. With add, the missing or too old
+// module requirements are added when a version is in the module cache, and
+// the updated go.mod and go.sum files are returned to be written.
+func checkRequirements(pkgs []packages.Package, tmps []Template, add bool) ([]File, error) {
+	tmps = slices.DeleteFunc(slices.Clone(tmps), func(t Template) bool { return t.FrontMatter.Requires.empty() })
+	if len(tmps) == 0 {
+		return nil, nil
+	}
+
+	files := []File{}
+	report := strings.Builder{}
+	checked := map[string]bool{}
+
+	for _, p := range pkgs {
+		if p.Module == nil || p.Module.GoMod == "" || checked[p.Module.GoMod] {
+			continue
+		}
+		checked[p.Module.GoMod] = true
+
+		f, err := checkModule(p.Module.GoMod, tmps, add, &report)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f...)
+	}
+
+	if report.Len() > 0 {
+		return nil, fmt.Errorf("%w:%s", ErrRequirements, report.String())
+	}
+
+	return files, nil
+}
+
+func checkModule(goMod string, tmps []Template, add bool, report *strings.Builder) ([]File, error) {
+	data, err := os.ReadFile(filepath.Clean(goMod))
+	if err != nil {
+		return nil, err
+	}
+
+	mf, err := modfile.Parse(goMod, data, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	sums := []string{}
+
+	for _, tmp := range tmps {
+		req := tmp.FrontMatter.Requires
+
+		if req.Go != "" && (mf.Go == nil || version.Compare("go"+mf.Go.Version, "go"+req.Go) < 0) {
+			declared := "none"
+			if mf.Go != nil {
+				declared = mf.Go.Version
+			}
+			fmt.Fprintf(report, "\n%s: template %s requires go %s, the module declares %s", goMod, tmp.Name, req.Go, declared)
+		}
+
+		for _, m := range req.Modules {
+			path, minVersion, _ := strings.Cut(m, "@")
+			if err := module.CheckPath(path); err != nil || (minVersion != "" && !semver.IsValid(minVersion)) {
+				return nil, fmt.Errorf("%w: template %s: malformed module requirement %q", ErrRequirements, tmp.Name, m)
+			}
+
+			// the templates of a module may well require it.
+			if mf.Module != nil && mf.Module.Mod.Path == path {
+				continue
+			}
+
+			current := requiredVersion(mf, path)
+			if current != "" && (minVersion == "" || semver.Compare(current, minVersion) >= 0) {
+				continue
+			}
+
+			if add {
+				if v, lines, ok := cachedModule(path, minVersion); ok {
+					if err := mf.AddRequire(path, v); err != nil {
+						return nil, err
+					}
+					sums = append(sums, lines...)
+					continue
+				}
+			}
+
+			switch {
+			case current == "":
+				fmt.Fprintf(report, "\n%s: template %s requires module %s, which is not required", goMod, tmp.Name, m)
+			default:
+				fmt.Fprintf(report, "\n%s: template %s requires module %s, the module requires %s", goMod, tmp.Name, m, current)
+			}
+		}
+	}
+
+	if len(sums) == 0 {
+		return nil, nil
+	}
+
+	mf.Cleanup()
+	content, err := mf.Format()
+	if err != nil {
+		return nil, err
+	}
+
+	files := []File{requirementsFile(goMod, content)}
+
+	goSum := filepath.Join(filepath.Dir(goMod), "go.sum")
+	old, err := os.ReadFile(filepath.Clean(goSum))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	sum := bytes.Clone(old)
+	for _, line := range sums {
+		if !slices.Contains(strings.Split(string(old), "\n"), line) {
+			sum = append(sum, line+"\n"...)
+		}
+	}
+	files = append(files, requirementsFile(goSum, sum))
+
+	return files, nil
+}
+
+const requirementsOrigin = "pkgen requirements"
+
+func requirementsFile(path string, content []byte) File {
+	mode := os.FileMode(0o644)
+	if st, err := os.Stat(path); err == nil {
+		mode = st.Mode().Perm()
+	}
+
+	return File{
+		Path:     path,
+		Content:  content,
+		Mode:     mode,
+		DirMode:  0,
+		Package:  "",
+		Template: "",
+		Origin:   requirementsOrigin,
+
+		TemplateVersion: "",
+		ParamsHash:      "",
+		Delete:          false,
+		Sources:         nil,
+		Region:          "",
+	}
+}
+
+// requiredVersion returns the version the go.mod requires of a module.
+func requiredVersion(mf *modfile.File, path string) string {
+	for _, r := range mf.Require {
+		if r.Mod.Path == path {
+			return r.Mod.Version
+		}
+	}
+
+	return ""
+}
+
+// cachedModule looks in the module cache for the latest downloaded version of
+// a module, at least minVersion, and returns it with its go.sum lines.
+func cachedModule(path, minVersion string) (string, []string, bool) {
+	escaped, err := module.EscapePath(path)
+	if err != nil {
+		return "", nil, false
+	}
+
+	dir := filepath.Join(modCache(), "cache", "download", escaped, "@v")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", nil, false
+	}
+
+	best := ""
+	for _, e := range entries {
+		v, ok := strings.CutSuffix(e.Name(), ".ziphash")
+		if !ok || !semver.IsValid(v) || (minVersion != "" && semver.Compare(v, minVersion) < 0) {
+			continue
+		}
+		if best == "" || semver.Compare(v, best) > 0 {
+			best = v
+		}
+	}
+	if best == "" {
+		return "", nil, false
+	}
+
+	zipHash, err := os.ReadFile(filepath.Join(dir, best+".ziphash"))
+	if err != nil {
+		return "", nil, false
+	}
+
+	modFile := filepath.Join(dir, best+".mod")
+	modHash, err := dirhash.Hash1([]string{"go.mod"}, func(string) (io.ReadCloser, error) { return os.Open(filepath.Clean(modFile)) })
+	if err != nil {
+		return "", nil, false
+	}
+
+	return best, []string{
+		fmt.Sprintf("%s %s %s", path, best, strings.TrimSpace(string(zipHash))),
+		fmt.Sprintf("%s %s/go.mod %s", path, best, modHash),
+	}, true
+}
+
+func modCache() string {
+	if dir := os.Getenv("GOMODCACHE"); dir != "" {
+		return dir
+	}
+
+	return filepath.Join(filepath.SplitList(build.Default.GOPATH)[0], "pkg", "mod")
+}
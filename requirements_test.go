@@ -0,0 +1,130 @@
+package pkgen
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ifnotnil/x/tst"
+	"github.com/stretchr/testify/require"
+)
+
+// moduleCache sets up a module cache with two versions of example.com/missing,
+// and a version of example.com/old that is only partly downloaded.
+func moduleCache(t *testing.T) {
+	t.Helper()
+
+	cache := t.TempDir()
+	t.Setenv("GOMODCACHE", cache)
+	for _, f := range []string{"missing/@v/v1.1.0", "missing/@v/v1.3.0", "old/@v/v1.5.0"} {
+		dir := filepath.Join(cache, "cache", "download", "example.com", filepath.Dir(f))
+		require.NoError(t, os.MkdirAll(dir, 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, filepath.Base(f)+".mod"), []byte("module example.com/x\n"), 0o600))
+		if !strings.HasPrefix(f, "old") {
+			require.NoError(t, os.WriteFile(filepath.Join(dir, filepath.Base(f)+".ziphash"), []byte("h1:zip=\n"), 0o600))
+		}
+	}
+}
+
+func requiring(name string, req Requirements) Template {
+	tmp := Template{}
+	tmp.Name = name
+	tmp.FrontMatter.Requires = req
+
+	return tmp
+}
+
+func TestCheckRequirements(t *testing.T) {
+	tests := map[string]struct {
+		tmps          []Template
+		add           bool
+		errorAsserter tst.ErrorAssertionFunc
+		message       string            // the error, with %s for the go.mod path.
+		expected      map[string]string // the content of the files to write, by path relative to the module.
+		goSumPrefix   string
+	}{
+		"met": {
+			tmps: []Template{
+				requiring("a", Requirements{Go: "1.21", Modules: []string{"example.com/old", "example.com/old@v1.0.0", "example.com/m"}}),
+				requiring("b", Requirements{Go: "", Modules: nil}),
+			},
+			add:           false,
+			errorAsserter: tst.NoError(),
+			message:       "",
+			expected:      map[string]string{},
+			goSumPrefix:   "",
+		},
+		"unmet": {
+			tmps:          []Template{requiring("a", Requirements{Go: "1.23", Modules: []string{"example.com/old@v1.2.0", "example.com/missing"}})},
+			add:           false,
+			errorAsserter: tst.ErrorIs(ErrRequirements),
+			message: `unmet template requirements:
+%[1]s: template a requires go 1.23, the module declares 1.22
+%[1]s: template a requires module example.com/old@v1.2.0, the module requires v1.0.0
+%[1]s: template a requires module example.com/missing, which is not required`,
+			expected:    nil,
+			goSumPrefix: "",
+		},
+		"malformed": {
+			tmps:          []Template{requiring("a", Requirements{Go: "", Modules: []string{"example.com/old@latest"}})},
+			add:           false,
+			errorAsserter: tst.ErrorIs(ErrRequirements),
+			message:       "",
+			expected:      nil,
+			goSumPrefix:   "",
+		},
+		"add from the module cache": {
+			tmps:          []Template{requiring("a", Requirements{Go: "", Modules: []string{"example.com/missing@v1.2.0"}})},
+			add:           true,
+			errorAsserter: tst.NoError(),
+			message:       "",
+			expected:      map[string]string{"go.mod": "module example.com/m\n\ngo 1.22\n\nrequire (\n\texample.com/old v1.0.0\n\texample.com/missing v1.3.0\n)\n"},
+			goSumPrefix:   "example.com/old v1.0.0/go.mod h1:x=\nexample.com/missing v1.3.0 h1:zip=\nexample.com/missing v1.3.0/go.mod h1:",
+		},
+		"not in the module cache": {
+			tmps:          []Template{requiring("a", Requirements{Go: "", Modules: []string{"example.com/old@v1.5.0", "example.com/missing@v2.0.0"}})},
+			add:           true,
+			errorAsserter: tst.ErrorIs(ErrRequirements),
+			message:       "",
+			expected:      nil,
+			goSumPrefix:   "",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			module, pkgs := testModule(t)
+			moduleCache(t)
+			goMod := filepath.Join(module, "go.mod")
+
+			files, err := checkRequirements(pkgs, tc.tmps, tc.add)
+			tc.errorAsserter(t, err)
+			if tc.message != "" {
+				require.EqualError(t, err, fmt.Sprintf(tc.message, goMod))
+			}
+			if err != nil {
+				return
+			}
+
+			info, err := os.Stat(goMod)
+			require.NoError(t, err)
+
+			got := map[string]string{}
+			for _, f := range files {
+				rel, err := filepath.Rel(module, f.Path)
+				require.NoError(t, err)
+				if rel == "go.sum" {
+					require.True(t, strings.HasPrefix(string(f.Content), tc.goSumPrefix), string(f.Content))
+					continue
+				}
+				require.Equal(t, info.Mode().Perm(), f.Mode, rel)
+				got[rel] = string(f.Content)
+			}
+			require.Equal(t, tc.expected, got)
+			require.Equal(t, tc.goSumPrefix != "", slices.ContainsFunc(files, func(f File) bool { return filepath.Base(f.Path) == "go.sum" }))
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package pkgen
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/samber/lo"
+	"golang.org/x/tools/go/packages"
+)
+
+var ErrScope = errors.New("scope error")
+
+// The scopes a template is rendered in, declared in its front-matter.
+const (
+	ScopePackage = "package" // once per package, the default.
+	ScopeFile    = "file"    // once per Go file of the package, see ScopedFile.
+)
+
+const defaultFileOutputNameTemplate = `zz_generated.{{ .SourceFile }}.{{ .TemplateName }}.go`
+
+// FileFilter selects the Go files a file scoped template is rendered for, by
+// their base name. Without include patterns every file is included.
+type FileFilter struct {
+	Include []string `json:"include,omitempty" yaml:"include,omitempty"` // e.g. handler_*.go
+	Exclude []string `json:"exclude,omitempty" yaml:"exclude,omitempty"`
+}
+
+func (f FileFilter) validate() error {
+	for _, p := range append(f.Include, f.Exclude...) {
+		if _, err := filepath.Match(p, ""); err != nil {
+			return fmt.Errorf("%w: %q: %w", ErrScope, p, err)
+		}
+	}
+
+	return nil
+}
+
+func (f FileFilter) match(name string) bool {
+	matchAny := func(patterns []string) bool {
+		for _, p := range patterns {
+			// the patterns are validated with the front-matter.
+			if ok, _ := filepath.Match(p, name); ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	return (len(f.Include) == 0 || matchAny(f.Include)) && !matchAny(f.Exclude)
+}
+
+func validateScope(fm FrontMatter) error {
+	switch fm.Scope {
+	case "", ScopePackage, ScopeFile, ScopeType:
+	default:
+		return fmt.Errorf("%w: unknown scope %q", ErrScope, fm.Scope)
+	}
+
+	if fm.PerType && fm.Scope != ScopeType {
+		return fmt.Errorf("%w: per_type is for the %s scope only", ErrScope, ScopeType)
+	}
+
+	return fm.Files.validate()
+}
+
+// ScopedFile is the Go file a file scoped template is rendered for, as
+// {{ .File }}.
+type ScopedFile struct {
+	Name string // the base name, e.g. handler_users.go
+	Path string
+	AST  *ast.File
+	Fset *token.FileSet
+
+	src []byte
+}
+
+func parseSourceFile(fset *token.FileSet, path string, src []byte) (*ScopedFile, error) {
+	f, err := parser.ParseFile(fset, path, src, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ScopedFile{Name: filepath.Base(path), Path: path, AST: f, Fset: fset, src: src}, nil
+}
+
+// Funcs returns the top level functions of the file, without the methods.
+func (f *ScopedFile) Funcs() []*ast.FuncDecl {
+	funcs := []*ast.FuncDecl{}
+	for _, d := range f.AST.Decls {
+		if fd, ok := d.(*ast.FuncDecl); ok && fd.Recv == nil {
+			funcs = append(funcs, fd)
+		}
+	}
+
+	return funcs
+}
+
+// Source returns the source text of a node of the file, e.g.
+// {{ $.File.Source .Type.Params }}.
+func (f *ScopedFile) Source(n ast.Node) string {
+	file := f.Fset.File(n.Pos())
+	if file == nil || f.Fset.File(f.AST.Pos()) != file {
+		return ""
+	}
+
+	return string(f.src[file.Offset(n.Pos()):file.Offset(n.End())])
+}
+
+// MarshalJSON keeps the file names only, the syntax tree being for templates.
+func (f *ScopedFile) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Name string
+		Path string
+	}{Name: f.Name, Path: f.Path})
+}
+
+// sourceFiles returns the Go files of pkg a file scoped template is rendered
+// for. The outputs of the run and the generated files are skipped, so that no
+// output is ever a source, and so are the test files of the test variants,
+// whose outputs are not tests.
+func (r renderer) sourceFiles(pkg packages.Package, tmp Template) ([]*ScopedFile, error) {
+	files := []*ScopedFile{}
+
+	for _, p := range pkg.GoFiles {
+		if strings.HasSuffix(p, "_test.go") || r.own[filepath.Clean(p)] || !tmp.FrontMatter.Files.match(filepath.Base(p)) {
+			continue
+		}
+
+		f, ok := r.parsed[p]
+		if !ok {
+			src, err := os.ReadFile(filepath.Clean(p))
+			if err != nil {
+				return nil, err
+			}
+
+			f, err = parseSourceFile(r.fset, p, src)
+			if err != nil {
+				return nil, err
+			}
+			r.parsed[p] = f
+		}
+
+		if ast.IsGenerated(f.AST) {
+			continue
+		}
+		files = append(files, f)
+	}
+
+	return files, nil
+}
+
+// loadOwnOutputs collects the outputs of the file scoped templates, for any Go
+// file of the packages, and the outputs recorded in the manifests. Without a
+// generated marker they would otherwise be read back as sources on the next
+// run, and their outputs named after them.
+func (r renderer) loadOwnOutputs(pkgs []packages.Package, tmps []Template, cnf GenerateConfig) error {
+	scoped := lo.Filter(tmps, func(t Template, _ int) bool { return t.FrontMatter.Scope == ScopeFile && !t.IsPlugin() })
+	if len(scoped) == 0 {
+		return nil
+	}
+
+	roots := map[string]bool{}
+	for _, pkg := range pkgs {
+		if pkg.Module != nil && pkg.Module.Dir != "" {
+			roots[filepath.Clean(pkg.Module.Dir)] = true
+		}
+
+		for _, tmp := range scoped {
+			tcnf := cnf.forTemplate(tmp)
+			data, err := r.templateData(pkg, tmp, tcnf)
+			if err != nil {
+				return err
+			}
+
+			// the main output of a template rendering into a region is hand-written.
+			patterns := lo.Map(fileTemplates(tmp), func(t *template.Template, _ int) string { return strings.TrimPrefix(t.Name(), fileTemplatePrefix) })
+			if cnf.regionOf(tmp) == "" {
+				patterns = append(patterns, tcnf.OutputFile)
+			}
+
+			for _, src := range pkg.GoFiles {
+				name := NewOutputName(pkg, tmp)
+				name.SourceFile = strings.TrimSuffix(filepath.Base(src), ".go")
+				for _, pattern := range patterns {
+					p, err := outputPath(data, r.names, name, pattern)
+					if err != nil {
+						return err
+					}
+					r.own[p] = true
+				}
+			}
+		}
+	}
+
+	if cnf.Manifest == "" {
+		return nil
+	}
+
+	for root := range roots {
+		m, err := readManifest(filepath.Join(root, cnf.Manifest))
+		if err != nil {
+			return err
+		}
+		for _, e := range m.Outputs {
+			r.own[filepath.Join(root, filepath.FromSlash(e.Path))] = true
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,186 @@
+package pkgen
+
+import (
+	"encoding/json"
+	"go/token"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"text/template"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/tools/go/packages"
+)
+
+func TestFileFilter(t *testing.T) {
+	tests := map[string]struct {
+		filter   FileFilter
+		name     string
+		expected bool
+	}{
+		"no patterns":   {filter: FileFilter{Include: nil, Exclude: nil}, name: "a.go", expected: true},
+		"included":      {filter: FileFilter{Include: []string{"handler_*.go"}, Exclude: nil}, name: "handler_users.go", expected: true},
+		"not included":  {filter: FileFilter{Include: []string{"handler_*.go"}, Exclude: nil}, name: "users.go", expected: false},
+		"excluded":      {filter: FileFilter{Include: []string{"handler_*.go"}, Exclude: []string{"*_internal.go"}}, name: "handler_internal.go", expected: false},
+		"only excluded": {filter: FileFilter{Include: nil, Exclude: []string{"doc.go"}}, name: "doc.go", expected: false},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, tc.expected, tc.filter.match(tc.name))
+		})
+	}
+}
+
+func TestScopedFile(t *testing.T) {
+	src := "package a\n\nfunc Get(key string) (string, error) { return key, nil }\n\nfunc (t T) Method() {}\n\nfunc unexported() {}\n"
+
+	f, err := parseSourceFile(token.NewFileSet(), "/tmp/a/a.go", []byte(src))
+	require.NoError(t, err)
+	require.Equal(t, "a.go", f.Name)
+
+	funcs := f.Funcs()
+	require.Len(t, funcs, 2, "the methods are left out")
+	require.Equal(t, "Get", funcs[0].Name.Name)
+	require.Equal(t, "(key string)", f.Source(funcs[0].Type.Params))
+	require.Equal(t, "(string, error)", f.Source(funcs[0].Type.Results))
+}
+
+func TestGenerateFileScope(t *testing.T) {
+	dir := t.TempDir()
+	sources := map[string]string{
+		"handler_users.go":  "package svc\n\nfunc GetUser(id int) (string, error) { return \"\", nil }\n\nfunc helper() {}\n",
+		"handler_orders.go": "package svc\n\nfunc GetOrder(id int) (string, error) { return \"\", nil }\n",
+		"handler_old.go":    "// Code generated by hand. DO NOT EDIT.\n\npackage svc\n",
+		"svc.go":            "package svc\n\nfunc New() {}\n",
+	}
+	goFiles := []string{}
+	for name, content := range sources {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600))
+		goFiles = append(goFiles, filepath.Join(dir, name))
+	}
+	slices.Sort(goFiles)
+	pkgs := []packages.Package{{Name: "svc", PkgPath: "example.com/svc", Dir: dir, GoFiles: goFiles}}
+
+	tmp := textTemplate(template.Must(template.New("trace").Parse(`package {{ .Name }}
+
+// from {{ .File.Name }}
+{{ range .File.Funcs }}{{ if .Name.IsExported }}
+func Traced{{ .Name }}{{ $.File.Source .Type.Params }} {{ $.File.Source .Type.Results }} {
+	return {{ .Name }}(id)
+}
+{{ end }}{{ end }}`)))
+	tmp.FrontMatter.Scope = ScopeFile
+	tmp.FrontMatter.Files = FileFilter{Include: []string{"handler_*.go"}, Exclude: nil}
+
+	t.Run("files", func(t *testing.T) {
+		files, err := Generator{FileWriter: nil}.Render(t.Context(), logger(t), pkgs, []Template{tmp}, DefaultConfig.Generate)
+		require.NoError(t, err)
+		require.Len(t, files, 2, "the generated and the not included files are skipped")
+
+		got := map[string]string{}
+		for _, f := range files {
+			got[filepath.Base(f.Path)] = string(f.Content)
+		}
+		require.Equal(t, map[string]string{
+			"zz_generated.handler_orders.trace.go": "package svc\n\n// from handler_orders.go\n\nfunc TracedGetOrder(id int) (string, error) {\n\treturn GetOrder(id)\n}\n",
+			"zz_generated.handler_users.trace.go":  "package svc\n\n// from handler_users.go\n\nfunc TracedGetUser(id int) (string, error) {\n\treturn GetUser(id)\n}\n",
+		}, got)
+	})
+
+	t.Run("output name", func(t *testing.T) {
+		named := tmp
+		named.Output = OutputConfig{Output: "{{ .SourceFile }}_gen.go", Mod: 0, Format: "", Region: ""}
+
+		files, err := Generator{FileWriter: nil}.Render(t.Context(), logger(t), pkgs, []Template{named}, DefaultConfig.Generate)
+		require.NoError(t, err)
+		require.Len(t, files, 2)
+		require.Equal(t, filepath.Join(dir, "handler_orders_gen.go"), files[0].Path)
+		require.Equal(t, filepath.Join(dir, "handler_users_gen.go"), files[1].Path)
+	})
+
+	t.Run("bundled", func(t *testing.T) {
+		cnf := DefaultConfig.Generate
+		cnf.Bundles = []BundleConfig{{Name: "all", Templates: []string{"trace"}}}
+
+		_, err := Generator{FileWriter: nil}.Render(t.Context(), logger(t), pkgs, []Template{tmp}, cnf)
+		require.ErrorIs(t, err, ErrScope)
+	})
+
+	t.Run("data", func(t *testing.T) {
+		test := filepath.Join(dir, "handler_users_test.go")
+		require.NoError(t, os.WriteFile(test, []byte("package svc\n\nfunc TestGetUser() {}\n"), 0o600))
+		variant := packages.Package{ID: "example.com/svc [example.com/svc.test]", Name: "svc", PkgPath: "example.com/svc", Dir: dir, GoFiles: append(slices.Clone(goFiles), test)}
+
+		data, err := Generator{FileWriter: nil}.Data(t.Context(), []packages.Package{variant}, []Template{tmp}, DefaultConfig.Generate)
+		require.NoError(t, err)
+		require.Len(t, data, 2, "the test files are skipped")
+		require.Equal(t, "handler_orders.go", data[0].File.Name)
+		require.Equal(t, "handler_users.go", data[1].File.Name)
+
+		b, err := json.Marshal(data[0])
+		require.NoError(t, err)
+		require.Contains(t, string(b), `"File":{"Name":"handler_orders.go","Path":"`+filepath.Join(dir, "handler_orders.go")+`"}`)
+	})
+
+	t.Run("two runs", func(t *testing.T) {
+		tests := map[string]struct {
+			outputs  []string // the output name of each run.
+			manifest string
+			expected []string
+		}{
+			"default output name": {
+				outputs:  []string{"", ""},
+				manifest: "",
+				expected: []string{"handler_old.go", "handler_orders.go", "handler_users.go", "svc.go", "zz_generated.handler_orders.trace.go", "zz_generated.handler_users.trace.go", "zz_generated.svc.trace.go"},
+			},
+			"output name of the source": {
+				outputs:  []string{"{{ .SourceFile }}_gen.go", "{{ .SourceFile }}_gen.go"},
+				manifest: "",
+				expected: []string{"handler_old.go", "handler_orders.go", "handler_orders_gen.go", "handler_users.go", "handler_users_gen.go", "svc.go", "svc_gen.go"},
+			},
+			"renamed outputs in the manifest": {
+				outputs:  []string{"{{ .SourceFile }}_v1.go", "{{ .SourceFile }}_v2.go"},
+				manifest: ".pkgen.json",
+				expected: []string{"handler_old.go", "handler_orders.go", "handler_orders_v2.go", "handler_users.go", "handler_users_v2.go", "svc.go", "svc_v2.go"},
+			},
+		}
+
+		for name, tc := range tests {
+			t.Run(name, func(t *testing.T) {
+				dir := t.TempDir()
+				for name, content := range sources {
+					require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600))
+				}
+				cnf := DefaultConfig.Generate
+				cnf.Manifest = tc.manifest
+
+				// no generated marker, and every file included.
+				all := textTemplate(template.Must(template.New("trace").Parse("package {{ .Name }}\n\n// from {{ .File.Name }}\n")))
+				all.FrontMatter.Scope = ScopeFile
+
+				for _, output := range tc.outputs {
+					all.Output.Output = output
+					goFiles, err := filepath.Glob(filepath.Join(dir, "*.go"))
+					require.NoError(t, err)
+					pkg := packages.Package{Name: "svc", PkgPath: "example.com/svc", Dir: dir, GoFiles: goFiles, Module: &packages.Module{Path: "example.com/svc", Dir: dir}}
+
+					require.NoError(t, Generator{FileWriter: nil}.Generate(t.Context(), logger(t), []packages.Package{pkg}, []Template{all}, cnf))
+				}
+
+				goFiles, err := filepath.Glob(filepath.Join(dir, "*.go"))
+				require.NoError(t, err)
+				got := lo.Map(goFiles, func(p string, _ int) string { return filepath.Base(p) })
+				require.Equal(t, tc.expected, got)
+			})
+		}
+	})
+
+	t.Run("sample", func(t *testing.T) {
+		sample, err := tmp.Sample()
+		require.NoError(t, err)
+		require.Contains(t, string(sample), "func TracedGet(ctx context.Context, key string) (string, error) {")
+	})
+}
@@ -0,0 +1,307 @@
+package pkgen
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/scanner"
+	"go/token"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// sourceMark opens, in the output of an instrumented template, the index of
+// the template position the output that follows is rendered from. It is
+// closed by a NUL byte.
+const sourceMark = "\x00pkgen:"
+
+// instrumented is a copy of a template whose parse trees emit a source mark
+// before every node, and every line of text.
+type instrumented struct {
+	text      *template.Template
+	positions []string
+}
+
+func instrument(tmp Template) (instrumented, error) {
+	c, err := tmp.Text.Clone()
+	if err != nil {
+		return instrumented{}, err
+	}
+
+	in := instrumented{text: c, positions: nil}
+	file := firstNotEmpty(tmp.Path, tmp.Name)
+
+	// the trees are shared with the template, they are copied before the change.
+	for _, t := range c.Templates() {
+		if t.Tree == nil || t.Tree.Root == nil {
+			continue
+		}
+
+		tree := t.Tree.Copy()
+		in.list(tree, tree.Root, file)
+		if _, err := c.AddParseTree(t.Name(), tree); err != nil {
+			return instrumented{}, err
+		}
+	}
+
+	return in, nil
+}
+
+func (in *instrumented) list(tree *parse.Tree, l *parse.ListNode, file string) {
+	if l == nil {
+		return
+	}
+
+	nodes := make([]parse.Node, 0, 2*len(l.Nodes))
+	for _, n := range l.Nodes {
+		line := nodeLine(tree, n)
+
+		switch n := n.(type) {
+		case *parse.TextNode:
+			for i, piece := range bytes.SplitAfter(n.Text, []byte("\n")) {
+				if len(piece) > 0 {
+					nodes = append(nodes, in.mark(n.Position(), file, line+i), textNode(n.Position(), piece))
+				}
+			}
+			continue
+		case *parse.IfNode:
+			in.list(tree, n.List, file)
+			in.list(tree, n.ElseList, file)
+		case *parse.RangeNode:
+			in.list(tree, n.List, file)
+			in.list(tree, n.ElseList, file)
+		case *parse.WithNode:
+			in.list(tree, n.List, file)
+			in.list(tree, n.ElseList, file)
+		}
+
+		nodes = append(nodes, in.mark(n.Position(), file, line), n)
+	}
+
+	l.Nodes = nodes
+}
+
+func (in *instrumented) mark(pos parse.Pos, file string, line int) parse.Node {
+	in.positions = append(in.positions, file+":"+strconv.Itoa(line))
+	return textNode(pos, []byte(sourceMark+strconv.Itoa(len(in.positions)-1)+"\x00"))
+}
+
+func textNode(pos parse.Pos, text []byte) *parse.TextNode {
+	return &parse.TextNode{NodeType: parse.NodeText, Pos: pos, Text: text}
+}
+
+// nodeLine returns the line of a node in the template source.
+func nodeLine(tree *parse.Tree, n parse.Node) int {
+	location, _ := tree.ErrorContext(n)
+
+	parts := strings.Split(location, ":")
+	if len(parts) < 3 {
+		return 0
+	}
+
+	line, _ := strconv.Atoi(parts[len(parts)-2])
+
+	return line
+}
+
+// strip removes the source marks from an instrumented output, and returns the
+// template position of every output line, that is of its first byte.
+func (in instrumented) strip(b []byte) ([]byte, []string) {
+	out := make([]byte, 0, len(b))
+	sources := []string{}
+	current, line := "", ""
+	started := false
+
+	for len(b) > 0 {
+		chunk := b
+		if i := bytes.Index(b, []byte(sourceMark)); i >= 0 {
+			chunk = b[:i]
+		}
+		b = b[len(chunk):]
+
+		for len(chunk) > 0 {
+			if !started {
+				line, started = current, true
+			}
+
+			i := bytes.IndexByte(chunk, '\n')
+			if i < 0 {
+				out = append(out, chunk...)
+				break
+			}
+
+			out = append(out, chunk[:i+1]...)
+			chunk = chunk[i+1:]
+			sources = append(sources, line)
+			started = false
+		}
+
+		if len(b) == 0 {
+			break
+		}
+
+		// a mark: \x00pkgen:<index>\x00
+		end := bytes.IndexByte(b[len(sourceMark):], 0)
+		if end < 0 {
+			out = append(out, b...)
+			break
+		}
+		if idx, err := strconv.Atoi(string(b[len(sourceMark) : len(sourceMark)+end])); err == nil && idx < len(in.positions) {
+			current = in.positions[idx]
+		}
+		b = b[len(sourceMark)+end+1:]
+	}
+
+	if started {
+		sources = append(sources, line)
+	}
+
+	return out, sources
+}
+
+// sourceWindow bounds how far remapSources looks ahead for a line.
+const sourceWindow = 100
+
+// remapSources follows the sources of a content to a transformed version of
+// it, like the formatted one. The lines are matched ignoring white space, so
+// that the lines added, removed or reformatted keep their position.
+func remapSources(from []byte, sources []string, to []byte) []string {
+	if sources == nil {
+		return nil
+	}
+
+	a, b := splitLines(string(from)), splitLines(string(to))
+	out := make([]string, len(b))
+
+	i := 0
+	for j, line := range b {
+		norm := strings.Join(strings.Fields(line), "")
+		if norm == "" {
+			continue
+		}
+
+		for k := i; k < min(i+sourceWindow, len(a)); k++ {
+			if strings.Join(strings.Fields(a[k]), "") == norm {
+				if k < len(sources) {
+					out[j] = sources[k]
+				}
+				i = k + 1
+				break
+			}
+		}
+	}
+
+	return out
+}
+
+// sourceAt returns the template position of a 1-based line.
+func sourceAt(sources []string, line int) string {
+	if line < 1 || line > len(sources) {
+		return ""
+	}
+
+	return sources[line-1]
+}
+
+// withSources adds the template positions to the syntax errors of a Go
+// output, unless line directives already did.
+func withSources(err error, sources []string) error {
+	var list scanner.ErrorList
+	if !errors.As(err, &list) {
+		return err
+	}
+
+	found := []string{}
+	for _, e := range list {
+		if s := sourceAt(sources, e.Pos.Line); e.Pos.Filename == "" && s != "" {
+			found = append(found, fmt.Sprintf("line %d from %s", e.Pos.Line, s))
+		}
+	}
+
+	if len(found) == 0 {
+		return err
+	}
+
+	return fmt.Errorf("%w (%s)", err, strings.Join(found, ", "))
+}
+
+// lineDirectives writes a //line directive before the lines of a Go output,
+// after its package clause, whose template position does not follow the one
+// of the previous line. The lines inside raw strings and general comments are
+// left alone.
+func lineDirectives(src []byte, sources []string) ([]byte, []string) {
+	lines := strings.SplitAfter(string(src), "\n")
+	unsafe := multilineTokens(src)
+
+	out := strings.Builder{}
+	outSources := make([]string, 0, len(sources))
+	pkg := false
+	expected := "" // the position the compiler gives to the line.
+
+	for i, line := range lines {
+		s := sourceAt(sources, i+1)
+
+		if pkg && s != "" && !unsafe[i+1] && s != expected {
+			out.WriteString("//line " + s + "\n")
+			outSources = append(outSources, "")
+			expected = s
+		}
+
+		out.WriteString(line)
+		if line != "" {
+			outSources = append(outSources, s)
+		}
+
+		if expected != "" {
+			expected = nextLine(expected)
+		}
+		if strings.HasPrefix(line, "package ") {
+			pkg = true
+		}
+	}
+
+	return []byte(out.String()), outSources
+}
+
+// nextLine returns the position of the line after a "file:line" one.
+func nextLine(pos string) string {
+	i := strings.LastIndexByte(pos, ':')
+	if i < 0 {
+		return ""
+	}
+
+	line, err := strconv.Atoi(pos[i+1:])
+	if err != nil {
+		return ""
+	}
+
+	return pos[:i+1] + strconv.Itoa(line+1)
+}
+
+// multilineTokens returns the 1-based lines that start inside a raw string or
+// a general comment.
+func multilineTokens(src []byte) map[int]bool {
+	fset := token.NewFileSet()
+	file := fset.AddFile("", -1, len(src))
+
+	s := scanner.Scanner{}
+	s.Init(file, src, nil, scanner.ScanComments)
+
+	lines := map[int]bool{}
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if (tok == token.STRING || tok == token.COMMENT) && strings.Contains(lit, "\n") {
+			start := fset.Position(pos).Line
+			for l := start + 1; l <= start+strings.Count(lit, "\n"); l++ {
+				lines[l] = true
+			}
+		}
+	}
+
+	return lines
+}
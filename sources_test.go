@@ -0,0 +1,94 @@
+package pkgen
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/tools/go/packages"
+)
+
+func TestInstrument(t *testing.T) {
+	tmp := textTemplate(template.Must(template.New("t").Parse(`package {{ .Name }}
+
+const (
+{{- range .Params.names }}
+	{{ . }} = "{{ $.Name }}"
+{{- end }}
+)
+{{ template "footer" . }}
+{{- define "footer" }}
+// {{ if .Params.names }}named{{ else }}unnamed{{ end }}
+{{ end -}}
+`)))
+	tmp.Path = "t.tmpl"
+	data := map[string]any{"Name": "a", "Params": map[string]any{"names": []string{"x", "y"}}}
+
+	plain := bytes.Buffer{}
+	require.NoError(t, tmp.Text.Execute(&plain, data))
+
+	in, err := instrument(tmp)
+	require.NoError(t, err)
+
+	buf := bytes.Buffer{}
+	require.NoError(t, in.text.Execute(&buf, data))
+	content, sources := in.strip(buf.Bytes())
+
+	require.Equal(t, plain.String(), string(content))
+	require.Equal(t, "package a\n\nconst (\n\tx = \"a\"\n\ty = \"a\"\n)\n\n// named\n", string(content))
+	require.Equal(t, []string{"t.tmpl:1", "t.tmpl:2", "t.tmpl:3", "t.tmpl:5", "t.tmpl:5", "t.tmpl:7", "t.tmpl:9", "t.tmpl:10"}, sources)
+
+	// the template itself is left alone.
+	require.NotContains(t, tmp.Text.Tree.Root.String(), sourceMark)
+}
+
+func TestRemapSources(t *testing.T) {
+	from := []byte("// Code generated; DO NOT EDIT.\npackage a\nconst   A=1\n\n\n\nvar B = 2\n")
+	sources := []string{"t:1", "t:2", "t:3", "t:4", "t:5", "t:6", "t:7"}
+	to := []byte("// Copyright\n\npackage a\n\nconst A = 1\n\nvar B = 2\n")
+
+	require.Equal(t, []string{"", "", "t:2", "", "t:3", "", "t:7"}, remapSources(from, sources, to))
+	require.Nil(t, remapSources(from, nil, to))
+}
+
+func TestLineDirectives(t *testing.T) {
+	src := []byte("package a\n\nconst A = `x\ny`\n\nfunc F() {\n\treturn\n}\n")
+	sources := []string{"t:1", "t:2", "t:3", "t:4", "t:5", "t:9", "t:10", "t:11"}
+
+	got, gotSources := lineDirectives(src, sources)
+	require.Equal(t, "package a\n//line t:2\n\nconst A = `x\ny`\n\n//line t:9\nfunc F() {\n\treturn\n}\n", string(got))
+	require.Equal(t, []string{"t:1", "", "t:2", "t:3", "t:4", "t:5", "", "t:9", "t:10", "t:11"}, gotSources)
+}
+
+func TestGenerateSources(t *testing.T) {
+	pkgs := []packages.Package{{Name: "pkg", PkgPath: "example.com/pkg", Dir: "/tmp/pkg", GoFiles: []string{"/tmp/pkg/pkg.go"}}}
+	tmp := textTemplate(template.Must(template.New("t").Parse("{{/* a comment */}}\npackage {{ .Name }}\n\n{{ if true }}\nfunc F() {\n\treturn\n}\n{{ end }}\n")))
+	tmp.Path = "t.tmpl"
+
+	t.Run("sources", func(t *testing.T) {
+		files, err := Generator{FileWriter: nil}.Render(t.Context(), logger(t), pkgs, []Template{tmp}, DefaultConfig.Generate)
+		require.NoError(t, err)
+		require.Equal(t, "package pkg\n\nfunc F() {\n\treturn\n}\n", string(files[0].Content))
+		require.Equal(t, []string{"t.tmpl:2", "", "t.tmpl:5", "t.tmpl:6", "t.tmpl:7"}, files[0].Sources)
+	})
+
+	t.Run("line directives", func(t *testing.T) {
+		cnf := DefaultConfig.Generate
+		cnf.LineDirectives = true
+
+		files, err := Generator{FileWriter: nil}.Render(t.Context(), logger(t), pkgs, []Template{tmp}, cnf)
+		require.NoError(t, err)
+		require.Equal(t, "package pkg\n\n//line t.tmpl:5\nfunc F() {\n\treturn\n}\n", string(files[0].Content))
+	})
+
+	t.Run("format error", func(t *testing.T) {
+		broken := textTemplate(template.Must(template.New("broken").Parse("package {{ .Name }}\n\n{{ if true }}\nfunc {\n{{ end }}\n")))
+		broken.Path = "broken.tmpl"
+
+		_, err := Generator{FileWriter: nil}.Render(t.Context(), logger(t), pkgs, []Template{broken}, DefaultConfig.Generate)
+		require.Error(t, err)
+		require.True(t, strings.HasSuffix(err.Error(), "(line 4 from broken.tmpl:4)"), err.Error())
+	})
+}
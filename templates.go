@@ -1,13 +1,25 @@
 package pkgen
 
 import (
+	"bytes"
 	"embed"
 	"errors"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"io/fs"
+	"log/slog"
 	"os"
 	"path"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"text/template"
+
+	"github.com/samber/lo"
+	"golang.org/x/tools/go/packages"
 )
 
 //go:embed templates/*.tmpl
@@ -15,51 +27,377 @@ var templatesFS embed.FS
 
 var ErrTemplateNotFound = errors.New("template not found")
 
-type Templates struct{}
+type TemplateSource string
+
+const (
+	SourceBuiltin TemplateSource = "builtin"
+	SourceFile    TemplateSource = "file"
+	SourcePlugin  TemplateSource = "plugin"
+)
+
+// Template is a resolved template config entry. Text is set for builtin and file
+// templates, Plugin holds the executable of plugin templates.
+type Template struct {
+	Name        string
+	Version     string // only builtin templates are versioned.
+	Source      TemplateSource
+	Path        string // embedded path, file path or plugin executable.
+	Text        *template.Template
+	Plugin      string
+	FrontMatter FrontMatter
+	Params      map[string]any // front-matter defaults overlaid by the configured params.
+	Output      OutputConfig   // front-matter output overlaid by the configured one.
+}
+
+// Origin describes where the template comes from, e.g. "builtin templates/otel@v1.tmpl".
+func (t Template) Origin() string {
+	return string(t.Source) + " " + t.Path
+}
+
+func (t Template) IsPlugin() bool {
+	return t.Plugin != ""
+}
+
+type Templates struct {
+	Logger *slog.Logger
+}
+
+func (t Templates) logger() *slog.Logger {
+	if t.Logger != nil {
+		return t.Logger
+	}
+
+	return slog.Default()
+}
+
+// builtin templates are embedded as templates/<name>@v<N>.tmpl. Older versions
+// are kept so that configs can pin one using the name@vN form.
+const versionSeparator = "@"
+
+func splitVersion(name string) (string, string) {
+	base, version, _ := strings.Cut(name, versionSeparator)
+	return base, version
+}
+
+func parseVersion(v string) (int, bool) {
+	n, err := strconv.Atoi(strings.TrimPrefix(v, "v"))
+	if err != nil || !strings.HasPrefix(v, "v") {
+		return 0, false
+	}
+
+	return n, true
+}
+
+// Versions returns the embedded versions of a builtin template, oldest first.
+func (t Templates) Versions(name string) []string {
+	matches, _ := fs.Glob(templatesFS, path.Join("templates", name+versionSeparator+"v*.tmpl"))
+
+	versions := make([]string, 0, len(matches))
+	for _, m := range matches {
+		_, v := splitVersion(strings.TrimSuffix(path.Base(m), ".tmpl"))
+		if _, ok := parseVersion(v); ok {
+			versions = append(versions, v)
+		}
+	}
+
+	slices.SortFunc(versions, func(a, b string) int {
+		an, _ := parseVersion(a)
+		bn, _ := parseVersion(b)
+		return an - bn
+	})
+
+	return versions
+}
 
 func (t Templates) Get(name string) (*template.Template, error) {
-	b, err := templatesFS.ReadFile(path.Join("templates", name+".tmpl"))
+	tmp, err := t.builtin(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return tmp.Text, nil
+}
+
+func (t Templates) builtin(name string) (Template, error) {
+	base, version := splitVersion(name)
+
+	if version == "" {
+		versions := t.Versions(base)
+		if len(versions) == 0 {
+			return Template{}, fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+		}
+		version = versions[len(versions)-1]
+		t.logger().Info("builtin template is not pinned, using the latest version", slog.String("template", base), slog.String("version", version))
+	}
+
+	p := path.Join("templates", base+versionSeparator+version+".tmpl")
+	b, err := templatesFS.ReadFile(p)
+	if err != nil {
+		return Template{}, errors.Join(ErrTemplateNotFound, err)
+	}
+
+	return parseTemplate(base, version, SourceBuiltin, p, b)
+}
+
+func parseTemplate(name, version string, source TemplateSource, p string, b []byte) (Template, error) {
+	fm, err := parseFrontMatter(b)
+	if err != nil {
+		return Template{}, fmt.Errorf("front-matter of %s: %w", p, err)
+	}
+
+	tmp, err := template.New(name).Parse(string(b))
+	if err != nil {
+		return Template{}, err
+	}
+
+	return Template{
+		Name:        name,
+		Version:     version,
+		Source:      source,
+		Path:        p,
+		Text:        tmp,
+		Plugin:      "",
+		FrontMatter: fm,
+		Params:      fm.Params,
+		Output:      fm.OutputConfig,
+	}, nil
+}
+
+// SamplePackage is a fake package used to preview the templates output.
+func SamplePackage() packages.Package {
+	return packages.Package{
+		ID:      "example.com/sample/internal/sample",
+		Name:    "sample",
+		PkgPath: "example.com/sample/internal/sample",
+		Dir:     "/src/sample/internal/sample",
+		GoFiles: []string{"/src/sample/internal/sample/sample.go"},
+		Module: &packages.Module{
+			Path:      "example.com/sample",
+			Dir:       "/src/sample",
+			GoVersion: "1.26",
+			Main:      true,
+		},
+	}
+}
+
+// sampleSource is the content of the Go file of the SamplePackage, that file
+// and type scoped templates are previewed with.
+const sampleSource = `package sample
+
+import "context"
+
+// Get returns the value of a key.
+func Get(ctx context.Context, key string) (string, error) {
+	return key, nil
+}
+
+// Item is a stored value.
+type Item struct {
+	Key   string
+	Value string
+}
+
+// Len returns the length of the value.
+func (i Item) Len() int {
+	return len(i.Value)
+}
+`
+
+// Sample renders the template against the SamplePackage. Plugins are not
+// executed, so they have no sample.
+func (t Template) Sample() ([]byte, error) {
+	if t.Text == nil {
+		return nil, nil
+	}
+
+	data, err := sampleData(t)
 	if err != nil {
-		return nil, errors.Join(ErrTemplateNotFound, err)
+		return nil, err
+	}
+
+	buf := bytes.Buffer{}
+	if err := t.Text.Execute(&buf, data); err != nil {
+		return nil, err
 	}
 
-	return template.New(name).Parse(string(b))
+	return buf.Bytes(), nil
 }
 
-func (t Templates) customTemplate(filePath string) (*template.Template, error) {
+// sampleData is the data of the template for the SamplePackage. A type scoped
+// template gets every type of the sample, as if annotated without args.
+func sampleData(t Template) (TemplateData, error) {
+	data := NewTemplateData(SamplePackage(), t)
+	if t.FrontMatter.Scope != ScopeFile && t.FrontMatter.Scope != ScopeType {
+		return data, nil
+	}
+
+	fset := token.NewFileSet()
+	f, err := parseSourceFile(fset, data.GoFiles[0], []byte(sampleSource))
+	if err != nil {
+		return TemplateData{}, err
+	}
+
+	if t.FrontMatter.Scope == ScopeFile {
+		data.File = f
+		return data, nil
+	}
+
+	// without an importer the imported types are invalid, which the sample
+	// types do not use.
+	conf := types.Config{Error: func(error) {}}
+	pkg, _ := conf.Check(data.PkgPath, fset, []*ast.File{f.AST}, nil)
+
+	for _, name := range pkg.Scope().Names() {
+		if obj, ok := pkg.Scope().Lookup(name).(*types.TypeName); ok {
+			data.Types = append(data.Types, newAnnotatedType(obj, map[string]string{}, fset.Position(obj.Pos())))
+		}
+	}
+	if t.FrontMatter.PerType && len(data.Types) > 0 {
+		data.Type = data.Types[0]
+	}
+
+	return data, nil
+}
+
+// Diff renders two builtin templates (e.g. otel@v1 and otel@v2) against the
+// SamplePackage and returns the unified diff of the outputs.
+func (t Templates) Diff(a, b string) (string, error) {
+	render := func(name string) ([]byte, error) {
+		tmp, err := t.builtin(name)
+		if err != nil {
+			return nil, err
+		}
+
+		return tmp.Sample()
+	}
+
+	ab, err := render(a)
+	if err != nil {
+		return "", err
+	}
+
+	bb, err := render(b)
+	if err != nil {
+		return "", err
+	}
+
+	return unifiedDiff(a, b, ab, bb), nil
+}
+
+func (t Templates) customTemplate(filePath string) (Template, error) {
 	b, err := os.ReadFile(filepath.Clean(filePath))
 	if err != nil {
-		return nil, errors.Join(ErrTemplateNotFound, err)
+		return Template{}, errors.Join(ErrTemplateNotFound, err)
 	}
 
-	name := filepath.Base(filePath)
-	name = strings.TrimSuffix(name, filepath.Ext(name))
+	return parseTemplate(baseName(filePath), "", SourceFile, filePath, b)
+}
+
+func (t Templates) plugin(executable string) Template {
+	return Template{
+		Name:        baseName(executable),
+		Version:     "",
+		Source:      SourcePlugin,
+		Path:        executable,
+		Text:        nil,
+		Plugin:      executable,
+		FrontMatter: FrontMatter{},
+		Params:      nil,
+		Output:      OutputConfig{},
+	}
+}
 
-	return template.New(name).Parse(string(b))
+func baseName(filePath string) string {
+	name := filepath.Base(filePath)
+	return strings.TrimSuffix(name, filepath.Ext(name))
 }
 
-func (t Templates) GetAll(c TemplateConfigs) ([]*template.Template, error) {
+func (t Templates) GetAll(c TemplateConfigs) ([]Template, error) {
 	if len(c) == 0 {
-		return []*template.Template{}, nil
+		return []Template{}, nil
 	}
 
-	sl := make([]*template.Template, 0, len(c))
+	sl := make([]Template, 0, len(c))
 	for _, cnf := range c {
+		var (
+			tmp Template
+			err error
+		)
+
 		switch {
 		case cnf.Name != "":
-			t, err := t.Get(cnf.Name)
-			if err != nil {
-				return nil, err
-			}
-			sl = append(sl, t)
+			tmp, err = t.builtin(cnf.Name)
 		case cnf.CustomTemplateFile != "":
-			t, err := t.customTemplate(cnf.CustomTemplateFile)
-			if err != nil {
-				return nil, err
-			}
-			sl = append(sl, t)
+			tmp, err = t.customTemplate(cnf.CustomTemplateFile)
+		case cnf.Plugin != "":
+			tmp = t.plugin(cnf.Plugin)
+		default:
+			continue
+		}
+
+		if err != nil {
+			return nil, err
 		}
+
+		tmp.Params = mergeParams(tmp.FrontMatter.Params, cnf.Params)
+		tmp.Output = mergeOutputConfig(cnf.OutputConfig, tmp.FrontMatter.OutputConfig)
+		sl = append(sl, tmp)
 	}
 
 	return sl, nil
 }
+
+// List returns every resolvable template: all the versions of the builtin
+// templates followed by the file and plugin templates of the given configs.
+func (t Templates) List(c TemplateConfigs) ([]Template, error) {
+	matches, err := fs.Glob(templatesFS, "templates/*.tmpl")
+	if err != nil {
+		return nil, err
+	}
+
+	sl := make([]Template, 0, len(matches)+len(c))
+	for _, m := range matches {
+		tmp, err := t.builtin(strings.TrimSuffix(path.Base(m), ".tmpl"))
+		if err != nil {
+			return nil, err
+		}
+		sl = append(sl, tmp)
+	}
+
+	slices.SortStableFunc(sl, func(a, b Template) int {
+		if c := strings.Compare(a.Name, b.Name); c != 0 {
+			return c
+		}
+		an, _ := parseVersion(a.Version)
+		bn, _ := parseVersion(b.Version)
+		return an - bn
+	})
+
+	custom, err := t.GetAll(lo.Filter(c, func(cnf TemplateConfig, _ int) bool { return cnf.Name == "" }))
+	if err != nil {
+		return nil, err
+	}
+
+	return append(sl, custom...), nil
+}
+
+// Find resolves a single template by name. Builtin names (optionally pinned)
+// come first, then the names of the configured templates and finally a path to
+// a template file.
+func (t Templates) Find(name string, c TemplateConfigs) (Template, error) {
+	base, _ := splitVersion(name)
+	if len(t.Versions(base)) > 0 {
+		return t.builtin(name)
+	}
+
+	configured, err := t.GetAll(lo.Filter(c, func(cnf TemplateConfig, _ int) bool { return cnf.Name == "" }))
+	if err != nil {
+		return Template{}, err
+	}
+
+	if tmp, ok := lo.Find(configured, func(tmp Template) bool { return tmp.Name == name }); ok {
+		return tmp, nil
+	}
+
+	return t.customTemplate(name)
+}
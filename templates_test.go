@@ -36,7 +36,97 @@ package abc123
 const packagePath = "github.com/abc/a1/abc123"
 `
 
+func TestTemplates_Versions(t *testing.T) {
+	require.Equal(t, []string{"v1"}, Templates{}.Versions("otel"))
+	require.Empty(t, Templates{}.Versions("nonexistent"))
+
+	pinned, err := Templates{}.GetAll(TemplateConfigs{{Name: "pkgpath@v1", CustomTemplateFile: "", Plugin: "", Params: nil, OutputConfig: OutputConfig{}}})
+	require.NoError(t, err)
+	require.Equal(t, "pkgpath", pinned[0].Name)
+	require.Equal(t, "v1", pinned[0].Version)
+
+	latest, err := Templates{}.GetAll(TemplateConfigs{{Name: "pkgpath", CustomTemplateFile: "", Plugin: "", Params: nil, OutputConfig: OutputConfig{}}})
+	require.NoError(t, err)
+	require.Equal(t, "v1", latest[0].Version)
+
+	_, err = Templates{}.GetAll(TemplateConfigs{{Name: "pkgpath@v999", CustomTemplateFile: "", Plugin: "", Params: nil, OutputConfig: OutputConfig{}}})
+	require.ErrorIs(t, err, ErrTemplateNotFound)
+}
+
+func TestTemplates_Diff(t *testing.T) {
+	d, err := Templates{}.Diff("otel@v1", "otel@v1")
+	require.NoError(t, err)
+	require.Empty(t, d)
+
+	d, err = Templates{}.Diff("otel@v1", "oteltrace@v1")
+	require.NoError(t, err)
+	require.Contains(t, d, "--- otel@v1\n+++ oteltrace@v1\n")
+	require.Contains(t, d, "+var tracer = otel.Tracer(packagePath)\n")
+
+	_, err = Templates{}.Diff("otel@v1", "nonexistent@v1")
+	require.ErrorIs(t, err, ErrTemplateNotFound)
+}
+
+func TestTemplates_List(t *testing.T) {
+	tmpFile := t.TempDir() + "/custom.tmpl"
+	err := os.WriteFile(tmpFile, []byte("{{/*pkgen\ndescription: custom one\n*/}}"), 0o644) //nolint:gosec
+	require.NoError(t, err)
+
+	got, err := Templates{}.List(TemplateConfigs{
+		{Name: "otel", CustomTemplateFile: "", Plugin: "", Params: nil, OutputConfig: OutputConfig{}},
+		{Name: "", CustomTemplateFile: tmpFile, Plugin: "", Params: nil, OutputConfig: OutputConfig{}},
+		{Name: "", CustomTemplateFile: "", Plugin: "./bin/gen", Params: nil, OutputConfig: OutputConfig{}},
+	})
+	require.NoError(t, err)
+
+	names := make([]string, 0, len(got))
+	for _, tmp := range got {
+		names = append(names, tmp.Name+"@"+tmp.Version+":"+string(tmp.Source))
+	}
+	require.Equal(t, []string{"otel@v1:builtin", "oteltrace@v1:builtin", "pkgpath@v1:builtin", "custom@:file", "gen@:plugin"}, names)
+	require.NotEmpty(t, got[0].FrontMatter.Description)
+	require.Equal(t, "custom one", got[3].FrontMatter.Description)
+}
+
+func TestTemplates_Find(t *testing.T) {
+	tmpFile := t.TempDir() + "/custom.tmpl"
+	err := os.WriteFile(tmpFile, []byte("package {{ .Name }}\n"), 0o644) //nolint:gosec
+	require.NoError(t, err)
+
+	configs := TemplateConfigs{{Name: "", CustomTemplateFile: tmpFile, Plugin: "", Params: nil, OutputConfig: OutputConfig{}}}
+
+	got, err := Templates{}.Find("pkgpath", configs)
+	require.NoError(t, err)
+	require.Equal(t, SourceBuiltin, got.Source)
+
+	got, err = Templates{}.Find("custom", configs)
+	require.NoError(t, err)
+	require.Equal(t, SourceFile, got.Source)
+
+	sample, err := got.Sample()
+	require.NoError(t, err)
+	require.Equal(t, "package sample\n", string(sample))
+
+	got, err = Templates{}.Find(tmpFile, nil)
+	require.NoError(t, err)
+	require.Equal(t, tmpFile, got.Path)
+
+	_, err = Templates{}.Find("nonexistent", configs)
+	require.ErrorIs(t, err, ErrTemplateNotFound)
+}
+
 func TestTemplates_GetAll(t *testing.T) {
+	t.Run("output config over front-matter", func(t *testing.T) {
+		tmpFile := t.TempDir() + "/custom.tmpl"
+		err := os.WriteFile(tmpFile, []byte("{{- /*pkgen\noutput: custom.go\nformat: gofmt\n*/ -}}\npackage {{ .Name }}\n"), 0o644) //nolint:gosec
+		require.NoError(t, err)
+
+		configs := TemplateConfigs{{Name: "", CustomTemplateFile: tmpFile, Plugin: "", Params: nil, OutputConfig: OutputConfig{Output: "", Mod: 0o600, Format: "none", Region: ""}}}
+		templates, err := Templates{}.GetAll(configs)
+		require.NoError(t, err)
+		require.Equal(t, OutputConfig{Output: "custom.go", Mod: 0o600, Format: "none", Region: ""}, templates[0].Output)
+	})
+
 	t.Run("empty configs returns empty slice", func(t *testing.T) {
 		templates, err := Templates{}.GetAll(TemplateConfigs{})
 		require.NoError(t, err)
@@ -56,32 +146,35 @@ func TestTemplates_GetAll(t *testing.T) {
 			{
 				Name:               "pkgpath",
 				CustomTemplateFile: "",
+				Plugin:             "",
+				Params:             nil,
+				OutputConfig:       OutputConfig{},
 			},
 		}
 		templates, err := Templates{}.GetAll(configs)
 		require.NoError(t, err)
 		require.Len(t, templates, 1)
 		require.NotNil(t, templates[0])
-		require.Equal(t, "pkgpath", templates[0].Name())
+		require.Equal(t, "pkgpath", templates[0].Name)
 	})
 
 	t.Run("multiple templates by name", func(t *testing.T) {
 		configs := TemplateConfigs{
-			{Name: "pkgpath", CustomTemplateFile: ""},
-			{Name: "otel", CustomTemplateFile: ""},
-			{Name: "oteltrace", CustomTemplateFile: ""},
+			{Name: "pkgpath", CustomTemplateFile: "", Plugin: "", Params: nil, OutputConfig: OutputConfig{}},
+			{Name: "otel", CustomTemplateFile: "", Plugin: "", Params: nil, OutputConfig: OutputConfig{}},
+			{Name: "oteltrace", CustomTemplateFile: "", Plugin: "", Params: nil, OutputConfig: OutputConfig{}},
 		}
 		templates, err := Templates{}.GetAll(configs)
 		require.NoError(t, err)
 		require.Len(t, templates, 3)
-		require.Equal(t, "pkgpath", templates[0].Name())
-		require.Equal(t, "otel", templates[1].Name())
-		require.Equal(t, "oteltrace", templates[2].Name())
+		require.Equal(t, "pkgpath", templates[0].Name)
+		require.Equal(t, "otel", templates[1].Name)
+		require.Equal(t, "oteltrace", templates[2].Name)
 	})
 
 	t.Run("template not found by name", func(t *testing.T) {
 		configs := TemplateConfigs{
-			{Name: "nonexistent", CustomTemplateFile: ""},
+			{Name: "nonexistent", CustomTemplateFile: "", Plugin: "", Params: nil, OutputConfig: OutputConfig{}},
 		}
 		templates, err := Templates{}.GetAll(configs)
 		require.Error(t, err)
@@ -91,8 +184,8 @@ func TestTemplates_GetAll(t *testing.T) {
 
 	t.Run("error on first template stops processing", func(t *testing.T) {
 		configs := TemplateConfigs{
-			{Name: "nonexistent", CustomTemplateFile: ""},
-			{Name: "pkgpath", CustomTemplateFile: ""},
+			{Name: "nonexistent", CustomTemplateFile: "", Plugin: "", Params: nil, OutputConfig: OutputConfig{}},
+			{Name: "pkgpath", CustomTemplateFile: "", Plugin: "", Params: nil, OutputConfig: OutputConfig{}},
 		}
 		templates, err := Templates{}.GetAll(configs)
 		require.Error(t, err)
@@ -102,8 +195,8 @@ func TestTemplates_GetAll(t *testing.T) {
 
 	t.Run("error on second template stops processing", func(t *testing.T) {
 		configs := TemplateConfigs{
-			{Name: "pkgpath", CustomTemplateFile: ""},
-			{Name: "nonexistent", CustomTemplateFile: ""},
+			{Name: "pkgpath", CustomTemplateFile: "", Plugin: "", Params: nil, OutputConfig: OutputConfig{}},
+			{Name: "nonexistent", CustomTemplateFile: "", Plugin: "", Params: nil, OutputConfig: OutputConfig{}},
 		}
 		templates, err := Templates{}.GetAll(configs)
 		require.Error(t, err)
@@ -118,17 +211,17 @@ func TestTemplates_GetAll(t *testing.T) {
 		require.NoError(t, err)
 
 		configs := TemplateConfigs{
-			{Name: "", CustomTemplateFile: tmpFile},
+			{Name: "", CustomTemplateFile: tmpFile, Plugin: "", Params: nil, OutputConfig: OutputConfig{}},
 		}
 		templates, err := Templates{}.GetAll(configs)
 		require.NoError(t, err)
 		require.Len(t, templates, 1)
-		require.Equal(t, "custom", templates[0].Name())
+		require.Equal(t, "custom", templates[0].Name)
 	})
 
 	t.Run("custom template file not found", func(t *testing.T) {
 		configs := TemplateConfigs{
-			{Name: "", CustomTemplateFile: "/nonexistent/file.tmpl"},
+			{Name: "", CustomTemplateFile: "/nonexistent/file.tmpl", Plugin: "", Params: nil, OutputConfig: OutputConfig{}},
 		}
 		templates, err := Templates{}.GetAll(configs)
 		require.Error(t, err)
@@ -142,28 +235,49 @@ func TestTemplates_GetAll(t *testing.T) {
 		require.NoError(t, err)
 
 		configs := TemplateConfigs{
-			{Name: "pkgpath", CustomTemplateFile: ""},
-			{Name: "", CustomTemplateFile: tmpFile},
-			{Name: "otel", CustomTemplateFile: ""},
+			{Name: "pkgpath", CustomTemplateFile: "", Plugin: "", Params: nil, OutputConfig: OutputConfig{}},
+			{Name: "", CustomTemplateFile: tmpFile, Plugin: "", Params: nil, OutputConfig: OutputConfig{}},
+			{Name: "otel", CustomTemplateFile: "", Plugin: "", Params: nil, OutputConfig: OutputConfig{}},
 		}
 		templates, err := Templates{}.GetAll(configs)
 		require.NoError(t, err)
 		require.Len(t, templates, 3)
-		require.Equal(t, "pkgpath", templates[0].Name())
-		require.Equal(t, "custom", templates[1].Name())
-		require.Equal(t, "otel", templates[2].Name())
+		require.Equal(t, "pkgpath", templates[0].Name)
+		require.Equal(t, "custom", templates[1].Name)
+		require.Equal(t, "otel", templates[2].Name)
+	})
+
+	t.Run("plugin", func(t *testing.T) {
+		configs := TemplateConfigs{
+			{Name: "pkgpath", CustomTemplateFile: "", Plugin: "", Params: nil, OutputConfig: OutputConfig{}},
+			{Name: "", CustomTemplateFile: "", Plugin: "./bin/gen.sh", Params: nil, OutputConfig: OutputConfig{}},
+		}
+		templates, err := Templates{}.GetAll(configs)
+		require.NoError(t, err)
+		require.Len(t, templates, 2)
+		require.Equal(t, Template{Name: "gen", Version: "", Source: SourcePlugin, Path: "./bin/gen.sh", Text: nil, Plugin: "./bin/gen.sh", FrontMatter: FrontMatter{}, Params: nil, Output: OutputConfig{}}, templates[1])
+	})
+
+	t.Run("configured params overlay the front-matter ones", func(t *testing.T) {
+		tmpFile := t.TempDir() + "/custom.tmpl"
+		err := os.WriteFile(tmpFile, []byte("{{/*pkgen\nparams:\n  a: 1\n  b: default\n*/}}"), 0o644) //nolint:gosec
+		require.NoError(t, err)
+
+		templates, err := Templates{}.GetAll(TemplateConfigs{{Name: "", CustomTemplateFile: tmpFile, Plugin: "", Params: map[string]any{"b": "configured"}, OutputConfig: OutputConfig{}}})
+		require.NoError(t, err)
+		require.Equal(t, map[string]any{"a": 1, "b": "configured"}, templates[0].Params)
 	})
 
 	t.Run("empty config entry is skipped", func(t *testing.T) {
 		configs := TemplateConfigs{
-			{Name: "pkgpath", CustomTemplateFile: ""},
-			{Name: "", CustomTemplateFile: ""}, // empty config - both Name and CustomTemplateFile are empty
-			{Name: "otel", CustomTemplateFile: ""},
+			{Name: "pkgpath", CustomTemplateFile: "", Plugin: "", Params: nil, OutputConfig: OutputConfig{}},
+			{Name: "", CustomTemplateFile: "", Plugin: "", Params: nil, OutputConfig: OutputConfig{}}, // empty config - both Name and CustomTemplateFile are empty
+			{Name: "otel", CustomTemplateFile: "", Plugin: "", Params: nil, OutputConfig: OutputConfig{}},
 		}
 		templates, err := Templates{}.GetAll(configs)
 		require.NoError(t, err)
 		require.Len(t, templates, 2)
-		require.Equal(t, "pkgpath", templates[0].Name())
-		require.Equal(t, "otel", templates[1].Name())
+		require.Equal(t, "pkgpath", templates[0].Name)
+		require.Equal(t, "otel", templates[1].Name)
 	})
 }
@@ -0,0 +1,5 @@
+module example.com/m
+
+go 1.22
+
+require example.com/old v1.0.0
@@ -0,0 +1,39 @@
+// Command plugin is a minimal pkgen plugin used by the tests.
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/ifnotnil/pkgen"
+)
+
+func main() {
+	req := pkgen.PluginRequest{}
+	if err := json.NewDecoder(os.Stdin).Decode(&req); err != nil {
+		os.Stderr.WriteString(err.Error())
+		os.Exit(1)
+	}
+
+	resp := pkgen.PluginResponse{}
+	for _, p := range req.Packages {
+		if p.Name == "broken" {
+			resp.Diagnostics = append(resp.Diagnostics, pkgen.PluginDiagnostic{Severity: pkgen.SeverityError, Package: p.PkgPath, Message: "broken package"})
+			continue
+		}
+
+		dir := p.Dir
+		if p.Name == "escape" {
+			dir = filepath.Dir(dir)
+		}
+
+		resp.Files = append(resp.Files, pkgen.PluginFile{
+			Path:    filepath.Join(dir, "zz_generated."+req.Template+".go"),
+			Content: "package " + p.Name + "\n",
+			Mode:    0,
+		})
+	}
+
+	_ = json.NewEncoder(os.Stdout).Encode(resp)
+}
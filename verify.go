@@ -0,0 +1,149 @@
+package pkgen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/samber/lo"
+	"golang.org/x/tools/go/packages"
+)
+
+var ErrVerify = errors.New("generated code does not type check")
+
+const verifyMode = packages.NeedName | packages.NeedFiles | packages.NeedSyntax | packages.NeedTypes
+
+// verify reloads the packages the Go files were written in, or removed from,
+// and type checks them. It returns the dirs of the failing packages, with
+// their errors, reported once, at the template line they come from when they
+// are located in an output.
+func verify(ctx context.Context, files []File, q PackagesQueryConfig) (map[string]bool, error) {
+	generated := map[string]File{}
+	for _, f := range files {
+		if isGoFile(f.Path) && !f.isManifest() {
+			generated[f.Path] = f
+		}
+	}
+
+	dirs := lo.Uniq(lo.MapToSlice(generated, func(p string, _ File) string { return filepath.Dir(p) }))
+	if len(dirs) == 0 {
+		return nil, nil
+	}
+	slices.Sort(dirs)
+
+	cfg := &packages.Config{
+		Mode:       verifyMode,
+		Context:    ctx,
+		Tests:      true, // the _test.go outputs are checked too.
+		Dir:        firstNotEmpty(q.Dir, dirs[0]),
+		Env:        append(os.Environ(), q.Env...),
+		BuildFlags: q.BuildFlags,
+	}
+
+	pkgs, err := packages.Load(cfg, dirs...)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, ctxErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrVerify, err)
+	}
+
+	failing := map[string]bool{}
+	reported := map[string]bool{}
+	errs := []error{}
+
+	// the test variants repeat the errors of the package.
+	packages.Visit(pkgs, nil, func(p *packages.Package) {
+		if len(p.Errors) == 0 || !slices.Contains(dirs, p.Dir) {
+			return
+		}
+		failing[p.Dir] = true
+
+		for _, e := range positioned(p) {
+			msg := verifyMessage(generated, e)
+			if reported[msg] {
+				continue
+			}
+			reported[msg] = true
+
+			errs = append(errs, fmt.Errorf("%w: %s", ErrVerify, msg))
+		}
+	})
+
+	if len(errs) == 0 {
+		return nil, nil
+	}
+
+	return failing, errors.Join(errs...)
+}
+
+// positioned returns the errors of a package, with the unpositioned ones the
+// go command reports, e.g. "# p\n./a.go:3:11: undefined: C", split into one
+// per position, so that they are reported once with the type errors.
+func positioned(p *packages.Package) []packages.Error {
+	errs := []packages.Error{}
+	for _, e := range p.Errors {
+		if e.Pos != "" && e.Pos != "-" {
+			errs = append(errs, e)
+			continue
+		}
+
+		for line := range strings.Lines(e.Msg) {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "# ") {
+				continue
+			}
+
+			file, rest, ok := strings.Cut(line, ":")
+			lineCol, msg, found := strings.Cut(rest, ": ")
+			if !ok || !found || !strings.HasSuffix(file, ".go") {
+				errs = append(errs, packages.Error{Pos: e.Pos, Msg: line, Kind: e.Kind})
+				continue
+			}
+			if !filepath.IsAbs(file) {
+				file = filepath.Join(p.Dir, file)
+			}
+			errs = append(errs, packages.Error{Pos: file + ":" + lineCol, Msg: msg, Kind: e.Kind})
+		}
+	}
+
+	return errs
+}
+
+// verifyMessage reports an error located in a generated file at the template
+// line it was rendered from, and the others as they are.
+func verifyMessage(generated map[string]File, e packages.Error) string {
+	f, line, ok := generatedAt(generated, e.Pos)
+	if !ok {
+		return e.Error()
+	}
+
+	if src := sourceAt(f.Sources, line); src != "" {
+		return fmt.Sprintf("%s: %s (template %s, in %s)", src, e.Msg, f.Template, e.Pos)
+	}
+
+	return fmt.Sprintf("%s (template %s)", e.Error(), f.Template)
+}
+
+// generatedAt returns the generated file a "file:line:col" position is in,
+// and the line.
+func generatedAt(generated map[string]File, pos string) (File, int, bool) {
+	for p, f := range generated {
+		rest, ok := strings.CutPrefix(pos, p+":")
+		if !ok {
+			continue
+		}
+
+		line, _, _ := strings.Cut(rest, ":")
+		n, _ := strconv.Atoi(line)
+
+		return f, n, true
+	}
+
+	return File{}, 0, false
+}
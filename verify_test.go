@@ -0,0 +1,93 @@
+package pkgen
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"text/template"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/tools/go/packages"
+)
+
+func TestGenerateVerify(t *testing.T) {
+	t.Setenv("GOWORK", "off")
+
+	module := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(module, "go.mod"), []byte("module example.com/m\n\ngo 1.22\n"), 0o600))
+
+	pkgs := []packages.Package{}
+	for _, name := range []string{"a", "b"} {
+		dir := filepath.Join(module, name)
+		require.NoError(t, os.MkdirAll(dir, 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name+".go"), []byte("package "+name+"\n\nconst A = 1\n"), 0o600))
+		pkgs = append(pkgs, packages.Package{
+			Name:    name,
+			PkgPath: "example.com/m/" + name,
+			Dir:     dir,
+			GoFiles: []string{filepath.Join(dir, name+".go")},
+			Module:  &packages.Module{Path: "example.com/m", Dir: module},
+		})
+	}
+
+	// C is undefined, in a only.
+	tmp := textTemplate(template.Must(template.New("t").Parse(`package {{ .Name }}
+
+{{ if eq .Name "a" }}const B = C{{ else }}const B = A{{ end }}
+`)))
+
+	cnf := DefaultConfig.Generate
+	cnf.Verify = true
+	cnf.Manifest = ".pkgen.lock"
+
+	err := Generator{FileWriter: nil}.Generate(t.Context(), logger(t), pkgs, []Template{tmp}, cnf)
+	require.ErrorIs(t, err, ErrVerify)
+	require.Equal(t, "generated code does not type check: t:3: undefined: C (template t, in "+filepath.Join(module, "a", "zz_generated.t.go")+":3:11)", err.Error(), "reported once, at the template line")
+
+	_, err = os.Stat(filepath.Join(module, "a", "zz_generated.t.go"))
+	require.ErrorIs(t, err, os.ErrNotExist, "the failing package is restored")
+
+	got, err := os.ReadFile(filepath.Join(module, "b", "zz_generated.t.go"))
+	require.NoError(t, err)
+	require.Equal(t, "package b\n\nconst B = A\n", string(got))
+
+	m, err := readManifest(filepath.Join(module, ".pkgen.lock"))
+	require.NoError(t, err)
+	require.Equal(t, []string{"b/zz_generated.t.go"}, lo.Map(m.Outputs, func(e ManifestEntry, _ int) string { return e.Path }), "the manifest records the passing package only")
+
+	t.Run("passing", func(t *testing.T) {
+		tmp := textTemplate(template.Must(template.New("t").Parse("package {{ .Name }}\n\nconst B = A\n")))
+		require.NoError(t, Generator{FileWriter: nil}.Generate(t.Context(), logger(t), pkgs, []Template{tmp}, cnf))
+
+		_, err = os.Stat(filepath.Join(module, "a", "zz_generated.t.go"))
+		require.NoError(t, err)
+	})
+
+	t.Run("failing again", func(t *testing.T) {
+		tmp := textTemplate(template.Must(template.New("t").Parse("package {{ .Name }}\n\nconst B = {{ .Name }}C\n")))
+		err := Generator{FileWriter: nil}.Generate(t.Context(), logger(t), pkgs, []Template{tmp}, cnf)
+		require.ErrorIs(t, err, ErrVerify)
+
+		got, err := os.ReadFile(filepath.Join(module, "a", "zz_generated.t.go"))
+		require.NoError(t, err)
+		require.Equal(t, "package a\n\nconst B = A\n", string(got), "the previous output is restored")
+
+		m, err := readManifest(filepath.Join(module, ".pkgen.lock"))
+		require.NoError(t, err)
+		require.Len(t, m.Outputs, 2)
+		require.Equal(t, contentHash(got), m.Outputs[0].Hash, "the manifest records the previous output again")
+	})
+
+	t.Run("build flags", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(filepath.Join(module, "a", "tagged.go"), []byte("//go:build pkgen\n\npackage a\n\nconst T = 1\n"), 0o600))
+		tmp := textTemplate(template.Must(template.New("t").Parse("package {{ .Name }}\n\nconst B = {{ if eq .Name \"a\" }}T{{ else }}A{{ end }}\n")))
+
+		err := Generator{FileWriter: nil}.Generate(t.Context(), logger(t), pkgs, []Template{tmp}, cnf)
+		require.ErrorIs(t, err, ErrVerify)
+
+		cnf := cnf
+		cnf.Query.BuildFlags = []string{"-tags=pkgen"}
+		require.NoError(t, Generator{FileWriter: nil}.Generate(t.Context(), logger(t), pkgs, []Template{tmp}, cnf))
+	})
+}
@@ -0,0 +1,28 @@
+package pkgen
+
+import (
+	"runtime/debug"
+)
+
+const modulePath = "github.com/ifnotnil/pkgen"
+
+const develVersion = "(devel)"
+
+// Version returns the version of the pkgen module, as recorded in the build info.
+func Version() string {
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return develVersion
+	}
+
+	v := bi.Main.Version
+	if bi.Main.Path != modulePath {
+		for _, d := range bi.Deps {
+			if d.Path == modulePath {
+				v = d.Version
+			}
+		}
+	}
+
+	return firstNotEmpty(v, develVersion)
+}
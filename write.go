@@ -0,0 +1,256 @@
+package pkgen
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+var ErrRollback = errors.New("rollback failed")
+
+// atomicWriteFile writes to a temporary file in the same directory and renames
+// it over name, so that name is never left half written. Like os.WriteFile,
+// an existing file keeps its mode and a new one gets perm less the umask. A
+// symbolic link is followed, so that its target is written and not replaced.
+func atomicWriteFile(name string, data []byte, perm os.FileMode) error {
+	target, err := filepath.EvalSymlinks(name)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		target = name
+	case err != nil:
+		return err
+	}
+
+	st, err := os.Stat(target)
+	exists := err == nil
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	// opened with perm, the umask applies.
+	tmpName := filepath.Join(filepath.Dir(target), "."+filepath.Base(target)+".pkgen-"+rand.Text())
+	tmp, err := os.OpenFile(filepath.Clean(tmpName), os.O_RDWR|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+
+	// no-op once renamed
+	defer os.Remove(tmp.Name()) //nolint:errcheck
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+
+	if exists {
+		if err := tmp.Chmod(st.Mode().Perm()); err != nil {
+			_ = tmp.Close()
+			return err
+		}
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), target)
+}
+
+type backup struct {
+	path    string
+	existed bool
+	content []byte
+	mode    os.FileMode
+}
+
+func takeBackup(path string) (backup, error) {
+	b := backup{path: path, existed: false, content: nil, mode: 0}
+
+	st, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return b, nil
+	}
+	if err != nil {
+		return b, err
+	}
+
+	content, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return b, err
+	}
+
+	b.existed = true
+	b.content = content
+	b.mode = st.Mode().Perm()
+
+	return b, nil
+}
+
+// transaction keeps an in memory backup of every file it touches, so that all
+// of them can be restored if a later step fails.
+type transaction struct {
+	g       Generator
+	backups []backup
+	dirs    []string // the created directories, parents first.
+}
+
+// mkdirAll creates the missing parents of path, keeping track of them.
+func (t *transaction) mkdirAll(dir string, mode os.FileMode) error {
+	missing := []string{}
+	for d := dir; ; d = filepath.Dir(d) {
+		_, err := os.Stat(d)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, os.ErrNotExist) || filepath.Dir(d) == d {
+			return err
+		}
+		missing = append(missing, d)
+	}
+
+	for _, d := range slices.Backward(missing) {
+		if err := os.Mkdir(d, mode); err != nil {
+			return err
+		}
+		t.dirs = append(t.dirs, d)
+	}
+
+	return nil
+}
+
+func (t *transaction) write(f File) error {
+	if f.DirMode != 0 {
+		if err := t.mkdirAll(filepath.Dir(f.Path), f.DirMode); err != nil {
+			return err
+		}
+	}
+
+	b, err := takeBackup(f.Path)
+	if err != nil {
+		return err
+	}
+
+	if err := t.g.write(f); err != nil {
+		return err
+	}
+
+	t.backups = append(t.backups, b)
+
+	return nil
+}
+
+func (t *transaction) remove(path string) error {
+	b, err := takeBackup(path)
+	if err != nil {
+		return err
+	}
+
+	if err := t.g.remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	t.backups = append(t.backups, b)
+
+	return nil
+}
+
+// backupOf returns the backup of path taken by the transaction.
+func (t *transaction) backupOf(path string) (backup, bool) {
+	i := slices.IndexFunc(t.backups, func(b backup) bool { return b.path == path })
+	if i < 0 {
+		return backup{}, false
+	}
+
+	return t.backups[i], true
+}
+
+// rollback restores the backups in reverse order, removing the files and the
+// directories that did not exist before.
+func (t *transaction) rollback() error {
+	return t.rollbackOnly(func(string) bool { return true })
+}
+
+// rollbackOnly restores the backups of the matching paths, keeping the rest
+// of the transaction, and removes the created directories nothing is kept in.
+func (t *transaction) rollbackOnly(match func(path string) bool) error {
+	errs := []error{}
+	kept := []backup{}
+
+	for _, b := range slices.Backward(t.backups) {
+		if !match(b.path) {
+			kept = append(kept, b)
+			continue
+		}
+
+		var err error
+		if b.existed {
+			err = t.g.write(File{Path: b.path, Content: b.content, Mode: b.mode, DirMode: 0, Package: "", Template: "", Origin: "", TemplateVersion: "", ParamsHash: "", Delete: false, Sources: nil, Region: ""})
+		} else {
+			err = t.g.remove(b.path)
+			if errors.Is(err, os.ErrNotExist) {
+				err = nil
+			}
+		}
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", b.path, err))
+		}
+	}
+	slices.Reverse(kept)
+
+	keptDirs := []string{}
+	for _, d := range slices.Backward(t.dirs) {
+		if slices.ContainsFunc(kept, func(b backup) bool { return within(d, b.path) }) {
+			keptDirs = append(keptDirs, d)
+			continue
+		}
+
+		if err := os.Remove(d); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, fmt.Errorf("%s: %w", d, err))
+		}
+	}
+	slices.Reverse(keptDirs)
+
+	t.backups = kept
+	t.dirs = keptDirs
+
+	if len(errs) > 0 {
+		return errors.Join(append([]error{ErrRollback}, errs...)...)
+	}
+
+	return nil
+}
+
+// writeAll writes all the files or none of them: on a failure or a context
+// cancellation the files already written are restored.
+func (g Generator) writeAll(ctx context.Context, files []File) error {
+	_, err := g.writeTx(ctx, files)
+	return err
+}
+
+// writeTx is writeAll, returning the transaction so that the caller can still
+// roll it back, or a part of it.
+func (g Generator) writeTx(ctx context.Context, files []File) (*transaction, error) {
+	tx := &transaction{g: g, backups: nil, dirs: nil}
+
+	for _, f := range files {
+		err := ctx.Err()
+		switch {
+		case err != nil:
+		case f.Delete:
+			err = tx.remove(f.Path)
+		default:
+			err = tx.write(f)
+		}
+
+		if err != nil {
+			return nil, errors.Join(err, tx.rollback())
+		}
+	}
+
+	return tx, nil
+}
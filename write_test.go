@@ -0,0 +1,163 @@
+package pkgen
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAtomicWriteFile(t *testing.T) {
+	t.Run("existing", func(t *testing.T) {
+		dir := t.TempDir()
+		target := filepath.Join(dir, "out.go")
+
+		require.NoError(t, os.WriteFile(target, []byte("old"), 0o600))
+		require.NoError(t, atomicWriteFile(target, []byte("new"), 0o644))
+
+		got, err := os.ReadFile(target)
+		require.NoError(t, err)
+		require.Equal(t, "new", string(got))
+
+		st, err := os.Stat(target)
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0o600), st.Mode().Perm(), "the mode of an existing file is kept, like os.WriteFile")
+
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		require.Len(t, entries, 1, "no temporary file is left behind")
+	})
+
+	t.Run("created", func(t *testing.T) {
+		target := filepath.Join(t.TempDir(), "out.go")
+		require.NoError(t, atomicWriteFile(target, []byte("new"), 0o600))
+
+		st, err := os.Stat(target)
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0o600), st.Mode().Perm())
+	})
+
+	t.Run("symlink", func(t *testing.T) {
+		dir := t.TempDir()
+		target := filepath.Join(dir, "target.go")
+		link := filepath.Join(dir, "link.go")
+		require.NoError(t, os.WriteFile(target, []byte("old"), 0o600))
+		require.NoError(t, os.Symlink(target, link))
+
+		require.NoError(t, atomicWriteFile(link, []byte("new"), 0o644))
+
+		st, err := os.Lstat(link)
+		require.NoError(t, err)
+		require.Equal(t, os.ModeSymlink, st.Mode().Type(), "the link is kept")
+
+		got, err := os.ReadFile(target)
+		require.NoError(t, err)
+		require.Equal(t, "new", string(got))
+	})
+}
+
+func TestWriteAll(t *testing.T) {
+	setup := func(t *testing.T) (string, []File) {
+		t.Helper()
+
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "existing.go"), []byte("package old\n"), 0o600))
+
+		return dir, []File{
+			{Path: filepath.Join(dir, "existing.go"), Content: []byte("package a\n"), Mode: 0o644, DirMode: 0, Package: "a", Template: "t", Origin: "", TemplateVersion: "", ParamsHash: "", Delete: false, Sources: nil, Region: ""},
+			{Path: filepath.Join(dir, "created.go"), Content: []byte("package a\n"), Mode: 0o644, DirMode: 0, Package: "a", Template: "t", Origin: "", TemplateVersion: "", ParamsHash: "", Delete: false, Sources: nil, Region: ""},
+			{Path: filepath.Join(dir, "failing.go"), Content: []byte("package a\n"), Mode: 0o644, DirMode: 0, Package: "a", Template: "t", Origin: "", TemplateVersion: "", ParamsHash: "", Delete: false, Sources: nil, Region: ""},
+		}
+	}
+
+	assertUntouched := func(t *testing.T, dir string) {
+		t.Helper()
+
+		got, err := os.ReadFile(filepath.Join(dir, "existing.go"))
+		require.NoError(t, err)
+		require.Equal(t, "package old\n", string(got))
+
+		st, err := os.Stat(filepath.Join(dir, "existing.go"))
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0o600), st.Mode().Perm())
+
+		_, err = os.Stat(filepath.Join(dir, "created.go"))
+		require.ErrorIs(t, err, os.ErrNotExist)
+	}
+
+	t.Run("all written", func(t *testing.T) {
+		dir, files := setup(t)
+		require.NoError(t, Generator{}.writeAll(t.Context(), files))
+
+		for _, name := range []string{"existing.go", "created.go", "failing.go"} {
+			got, err := os.ReadFile(filepath.Join(dir, name))
+			require.NoError(t, err)
+			require.Equal(t, "package a\n", string(got))
+		}
+	})
+
+	t.Run("failure restores the written files", func(t *testing.T) {
+		dir, files := setup(t)
+
+		mockFW := NewMockFileWriter(t)
+		mockFW.EXPECT().WriteFile(filepath.Join(dir, "failing.go"), mock.Anything, mock.Anything).Return(os.ErrPermission)
+		mockFW.EXPECT().WriteFile(mock.Anything, mock.Anything, mock.Anything).RunAndReturn(atomicWriteFile)
+		mockFW.EXPECT().Remove(filepath.Join(dir, "created.go")).RunAndReturn(os.Remove)
+
+		err := Generator{FileWriter: mockFW}.writeAll(t.Context(), files)
+		require.ErrorIs(t, err, os.ErrPermission)
+		assertUntouched(t, dir)
+	})
+
+	t.Run("cancellation restores the written files", func(t *testing.T) {
+		dir, files := setup(t)
+		ctx, cancel := context.WithCancel(t.Context())
+
+		mockFW := NewMockFileWriter(t)
+		mockFW.EXPECT().WriteFile(filepath.Join(dir, "created.go"), mock.Anything, mock.Anything).RunAndReturn(func(name string, data []byte, perm os.FileMode) error {
+			cancel()
+			return atomicWriteFile(name, data, perm)
+		})
+		mockFW.EXPECT().WriteFile(mock.Anything, mock.Anything, mock.Anything).RunAndReturn(atomicWriteFile)
+		mockFW.EXPECT().Remove(filepath.Join(dir, "created.go")).RunAndReturn(os.Remove)
+
+		err := Generator{FileWriter: mockFW}.writeAll(ctx, files)
+		require.ErrorIs(t, err, context.Canceled)
+		assertUntouched(t, dir)
+	})
+}
+
+func TestWriteAllCreatedDirs(t *testing.T) {
+	dir := t.TempDir()
+	files := []File{
+		{Path: filepath.Join(dir, "gen", "a", "x.go"), Content: []byte("package a\n"), Mode: 0o644, DirMode: 0o755, Package: "a", Template: "t", Origin: "", TemplateVersion: "", ParamsHash: "", Delete: false, Sources: nil, Region: ""},
+		{Path: filepath.Join(dir, "gen", "a", "failing.go"), Content: []byte("package a\n"), Mode: 0o644, DirMode: 0o755, Package: "a", Template: "t", Origin: "", TemplateVersion: "", ParamsHash: "", Delete: false, Sources: nil, Region: ""},
+	}
+
+	mockFW := NewMockFileWriter(t)
+	mockFW.EXPECT().WriteFile(files[1].Path, mock.Anything, mock.Anything).Return(os.ErrPermission)
+	mockFW.EXPECT().WriteFile(mock.Anything, mock.Anything, mock.Anything).RunAndReturn(atomicWriteFile)
+	mockFW.EXPECT().Remove(files[0].Path).RunAndReturn(os.Remove)
+
+	err := Generator{FileWriter: mockFW}.writeAll(t.Context(), files)
+	require.ErrorIs(t, err, os.ErrPermission)
+
+	_, err = os.Stat(filepath.Join(dir, "gen"))
+	require.ErrorIs(t, err, os.ErrNotExist, "the created directories are removed")
+}
+
+func TestWriteAllRemove(t *testing.T) {
+	dir := t.TempDir()
+	files := []File{
+		{Path: filepath.Join(dir, "x.go"), Content: nil, Mode: 0, DirMode: 0, Package: "a", Template: "t", Origin: "", TemplateVersion: "", ParamsHash: "", Delete: true, Sources: nil, Region: ""},
+	}
+
+	mockFW := NewMockFileWriter(t)
+	mockFW.EXPECT().Remove(files[0].Path).Return(os.ErrPermission)
+
+	err := Generator{FileWriter: mockFW}.writeAll(t.Context(), files)
+	require.ErrorIs(t, err, os.ErrPermission)
+}